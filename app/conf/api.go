@@ -0,0 +1,496 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"appengine"
+	"appengine/datastore"
+
+	"github.com/campoy/goconf/pkg/conf"
+	"github.com/campoy/goconf/pkg/csrf"
+	"github.com/campoy/goconf/pkg/identity"
+)
+
+// apiPrefix is the path all the version 1 API endpoints are under.
+const apiPrefix = "/api/v1/"
+
+// Page sizes for the API listings.
+const (
+	defaultAPILimit = 20
+	maxAPILimit     = 100
+)
+
+// An apiError is returned by API handlers to reply with the given status.
+// It's encoded as the body of the response inside an "error" object.
+type apiError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string { return e.Message }
+
+func errBadRequest(format string, args ...interface{}) error {
+	return &apiError{http.StatusBadRequest, "bad_request", fmt.Sprintf(format, args...)}
+}
+
+func errNotFound(format string, args ...interface{}) error {
+	return &apiError{http.StatusNotFound, "not_found", fmt.Sprintf(format, args...)}
+}
+
+var (
+	errUnauthorized     = &apiError{http.StatusUnauthorized, "unauthorized", "this endpoint requires to be logged in"}
+	errNotAcceptable    = &apiError{http.StatusNotAcceptable, "not_acceptable", "responses are only available as application/json"}
+	errUnsupportedMedia = &apiError{http.StatusUnsupportedMediaType, "unsupported_media_type", "request bodies must be application/json"}
+)
+
+// An apiRequest is an API request with its matched path parameters and the
+// logged in user, if any.
+type apiRequest struct {
+	*http.Request
+	ctx    appengine.Context
+	user   *identity.Identity
+	params []string
+}
+
+// apiHandler handles an API request returning the value to be encoded as JSON
+// in the body of the response.
+type apiHandler func(r *apiRequest) (interface{}, error)
+
+// An apiRoute maps a method and a path pattern to a handler. Each "*" in the
+// pattern matches one path segment, which is passed to the handler as a
+// parameter.
+type apiRoute struct {
+	method  string
+	pattern string
+	h       apiHandler
+}
+
+var apiRoutes = []apiRoute{
+	{"GET", "conferences", apiListConfs},
+	{"GET", "conferences/*", apiGetConf},
+	{"GET", "conferences/*/tickets", apiListTickets},
+	{"POST", "tickets/*/purchase", apiBuyTicket},
+	{"GET", "me/profile", apiGetProfile},
+	{"PUT", "me/profile", apiSaveProfile},
+	{"GET", "me/tickets", apiMyTickets},
+	{"POST", "me/tickets/*/cancel", apiCancelTicket},
+}
+
+// match returns the path parameters if the path matches the pattern.
+func (rt apiRoute) match(path string) ([]string, bool) {
+	ps, ss := strings.Split(rt.pattern, "/"), strings.Split(path, "/")
+	if len(ps) != len(ss) {
+		return nil, false
+	}
+	var params []string
+	for i, p := range ps {
+		switch {
+		case p == "*" && len(ss[i]) > 0:
+			params = append(params, ss[i])
+		case p != ss[i]:
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// apiServeHTTP routes the requests under apiPrefix to their handlers and
+// encodes their results.
+func apiServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer trackRequest(r)()
+	ctx := appengine.NewContext(r)
+	v, err := serveAPI(r, ctx)
+	if err != nil {
+		ae, ok := err.(*apiError)
+		if !ok {
+			ctx.Errorf("%q: request failed: %v", r.URL.Path, err)
+			ae = &apiError{http.StatusInternalServerError, "internal", "internal error"}
+		}
+		writeJSON(w, ae.Status, struct {
+			Error *apiError `json:"error"`
+		}{ae})
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+func serveAPI(r *http.Request, ctx appengine.Context) (interface{}, error) {
+	if !acceptsJSON(r) {
+		return nil, errNotAcceptable
+	}
+	// The users are identified by their cookies, so a page from another
+	// site could make requests on their behalf, even with no body.
+	if currentUser(r) != nil {
+		if err := protector.Check(r); err == csrf.ErrNoSession || err == csrf.ErrBadToken {
+			return nil, &apiError{http.StatusForbidden, "csrf", err.Error()}
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix), "/")
+	allowed := false
+	for _, rt := range apiRoutes {
+		params, ok := rt.match(path)
+		if !ok {
+			continue
+		}
+		if rt.method != r.Method {
+			allowed = true
+			continue
+		}
+		return rt.h(&apiRequest{r, ctx, currentUser(r), params})
+	}
+	if allowed {
+		return nil, &apiError{http.StatusMethodNotAllowed, "method_not_allowed",
+			fmt.Sprintf("method %v not allowed on %v", r.Method, r.URL.Path)}
+	}
+	return nil, errNotFound("no endpoint at %v", r.URL.Path)
+}
+
+// acceptsJSON returns true if the Accept header of the request allows JSON
+// responses.
+func acceptsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if len(accept) == 0 {
+		return true
+	}
+	for _, t := range strings.Split(accept, ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(t))
+		if err != nil {
+			continue
+		}
+		switch mt {
+		case "application/json", "application/*", "*/*":
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		status = http.StatusInternalServerError
+		b = []byte(`{"error":{"code":"internal","message":"encoding response"}}`)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// decodeJSON decodes the JSON body of the request into v.
+func decodeJSON(r *apiRequest, v interface{}) error {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mt != "application/json" {
+		return errUnsupportedMedia
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return errBadRequest("bad request body: %v", err)
+	}
+	return nil
+}
+
+// limit returns the page size requested with the limit parameter.
+func (r *apiRequest) limit() (int, error) {
+	v := r.FormValue("limit")
+	if len(v) == 0 {
+		return defaultAPILimit, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 || n > maxAPILimit {
+		return 0, errBadRequest("limit must be between 1 and %v", maxAPILimit)
+	}
+	return n, nil
+}
+
+// loggedIn returns an error if there's no logged in user.
+func (r *apiRequest) loggedIn() error {
+	if r.user == nil {
+		return errUnauthorized
+	}
+	return nil
+}
+
+// can returns an error if there's no logged in user or the user doesn't have
+// the permission, see checkPermission.
+func (r *apiRequest) can(p conf.Permission, c *conf.Conference) error {
+	if err := r.loggedIn(); err != nil {
+		return err
+	}
+	err := checkPermission(r.ctx, r.user, p, c)
+	if f, ok := err.(Forbidden); ok {
+		return &apiError{http.StatusForbidden, "forbidden", string(f)}
+	}
+	return err
+}
+
+// JSON representations of the models.
+
+type confJSON struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	City         string    `json:"city"`
+	Topic        string    `json:"topic"` // deprecated, first of topics
+	Topics       []string  `json:"topics"`
+	MaxAttendees int       `json:"max_attendees"`
+	TixAvailable int       `json:"tickets_available"`
+	StartDate    time.Time `json:"start_date"`
+	EndDate      time.Time `json:"end_date"`
+	Organizer    string    `json:"organizer"`
+	Approved     bool      `json:"approved"`
+	VenueID      string    `json:"venue_id,omitempty"`
+	TimeZone     string    `json:"time_zone,omitempty"`
+}
+
+func newConfJSON(c *conf.Conference) *confJSON {
+	return &confJSON{
+		ID:           c.ID(),
+		Name:         c.Name,
+		Description:  c.Description,
+		City:         c.City,
+		Topic:        c.Topic,
+		Topics:       c.Topics,
+		MaxAttendees: c.MaxAttendees,
+		TixAvailable: c.TixAvailable,
+		StartDate:    c.StartDate,
+		EndDate:      c.EndDate,
+		Organizer:    c.Organizer,
+		Approved:     c.Approved,
+		VenueID:      c.VenueID,
+		TimeZone:     c.TimeZone,
+	}
+}
+
+type ticketJSON struct {
+	ID           string `json:"id"`
+	ConferenceID string `json:"conference_id"`
+	ConfName     string `json:"conference_name"`
+	Number       int    `json:"number"`
+	State        string `json:"state"`
+}
+
+func newTicketsJSON(ts []conf.Ticket) []*ticketJSON {
+	js := make([]*ticketJSON, len(ts))
+	for i := range ts {
+		t := &ts[i]
+		js[i] = &ticketJSON{t.ID(), t.ConferenceID(), t.ConfName, t.Number, string(t.State)}
+	}
+	return js
+}
+
+type profileJSON struct {
+	Name       string   `json:"name"`
+	Topics     []string `json:"topics"`
+	MainEmail  string   `json:"main_email"`
+	NotifEmail string   `json:"notification_email"`
+	TimeZone   string   `json:"time_zone"`
+}
+
+// conferences
+
+func apiListConfs(r *apiRequest) (interface{}, error) {
+	limit, err := r.limit()
+	if err != nil {
+		return nil, err
+	}
+	q := datastore.NewQuery(conf.ConferenceKind)
+	if topic := r.FormValue("topic"); len(topic) > 0 {
+		q = q.Filter("AllTopics =", topic)
+	}
+	if city := r.FormValue("city"); len(city) > 0 {
+		q = q.Filter("City =", city)
+	}
+	p, err := conf.LoadConfPage(r.ctx, q, r.FormValue("cursor"), limit)
+	if err != nil {
+		return nil, cursorError(err)
+	}
+
+	res := struct {
+		Conferences []*confJSON `json:"conferences"`
+		NextCursor  string      `json:"next_cursor,omitempty"`
+	}{make([]*confJSON, len(p.Conferences)), p.Next}
+	for i := range p.Conferences {
+		res.Conferences[i] = newConfJSON(&p.Conferences[i])
+	}
+	return res, nil
+}
+
+// cursorError returns a bad request API error if err is about a malformed
+// cursor, and err otherwise.
+func cursorError(err error) error {
+	if _, ok := err.(*conf.CursorError); ok {
+		return errBadRequest("%v", err)
+	}
+	return err
+}
+
+// notFound returns true if err, returned loading the entity with the given
+// id, means that there's no such entity.
+func notFound(id string, err error) bool {
+	if err == datastore.ErrNoSuchEntity {
+		return true
+	}
+	_, kerr := datastore.DecodeKey(id)
+	return kerr != nil
+}
+
+// loadConf loads the conference with the given id, failing with a not found
+// API error if it doesn't exist.
+func loadConf(ctx appengine.Context, id string) (*conf.Conference, error) {
+	c, err := conf.LoadConference(ctx, id)
+	if err != nil {
+		if notFound(id, err) {
+			return nil, errNotFound("conference %v not found", id)
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+func apiGetConf(r *apiRequest) (interface{}, error) {
+	c, err := loadConf(r.ctx, r.params[0])
+	if err != nil {
+		return nil, err
+	}
+	return newConfJSON(c), nil
+}
+
+// tickets
+
+func apiListTickets(r *apiRequest) (interface{}, error) {
+	limit, err := r.limit()
+	if err != nil {
+		return nil, err
+	}
+	c, err := loadConf(r.ctx, r.params[0])
+	if err != nil {
+		return nil, err
+	}
+	p, err := c.AvailableTicketsPage(r.ctx, r.FormValue("cursor"), limit)
+	if err != nil {
+		return nil, cursorError(err)
+	}
+	return struct {
+		Tickets    []*ticketJSON `json:"tickets"`
+		NextCursor string        `json:"next_cursor,omitempty"`
+	}{newTicketsJSON(p.Tickets), p.Next}, nil
+}
+
+func apiBuyTicket(r *apiRequest) (interface{}, error) {
+	if err := r.can(conf.PermBuyTicket, nil); err != nil {
+		return nil, err
+	}
+	t, err := loadTicket(r.ctx, r.params[0])
+	if err != nil {
+		return nil, err
+	}
+	errUnavailable := &apiError{http.StatusConflict, "ticket_unavailable", "the ticket is not available"}
+	if t.State != conf.TicketAvailable {
+		return nil, errUnavailable
+	}
+	if err := t.SellTo(r.ctx, r.user.Email); err != nil {
+		if err == conf.ErrTicketUnavailable || err == datastore.ErrConcurrentTransaction {
+			// Someone else bought it since it was loaded.
+			return nil, errUnavailable
+		}
+		return nil, err
+	}
+	return newTicketsJSON([]conf.Ticket{*t})[0], nil
+}
+
+// loadTicket loads the ticket with the given id, failing with a not found
+// API error if it doesn't exist.
+func loadTicket(ctx appengine.Context, id string) (*conf.Ticket, error) {
+	t, err := conf.LoadTicket(ctx, id)
+	if err != nil {
+		if notFound(id, err) {
+			return nil, errNotFound("ticket %v not found", id)
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+// user profile
+
+func apiGetProfile(r *apiRequest) (interface{}, error) {
+	if err := r.loggedIn(); err != nil {
+		return nil, err
+	}
+	up, err := conf.LoadUserProfile(r.ctx, r.user.Email)
+	if err != nil {
+		return nil, err
+	}
+	return &profileJSON{up.Name, up.Topics, up.MainEmail, up.NotifEmail, up.TimeZone}, nil
+}
+
+func apiSaveProfile(r *apiRequest) (interface{}, error) {
+	if err := r.loggedIn(); err != nil {
+		return nil, err
+	}
+	var p profileJSON
+	if err := decodeJSON(r, &p); err != nil {
+		return nil, err
+	}
+	up := &conf.UserProfile{
+		MainEmail:  r.user.Email,
+		Name:       p.Name,
+		NotifEmail: p.NotifEmail,
+		Topics:     p.Topics,
+		TimeZone:   p.TimeZone,
+	}
+	if err := up.Save(r.ctx); err != nil {
+		if _, ok := err.(conf.ValidationError); ok {
+			return nil, errBadRequest("%v", err)
+		}
+		return nil, err
+	}
+	return &profileJSON{up.Name, up.Topics, up.MainEmail, up.NotifEmail, up.TimeZone}, nil
+}
+
+func apiMyTickets(r *apiRequest) (interface{}, error) {
+	if err := r.loggedIn(); err != nil {
+		return nil, err
+	}
+	up, err := conf.LoadUserProfile(r.ctx, r.user.Email)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Tickets []*ticketJSON `json:"tickets"`
+	}{newTicketsJSON(up.Tickets())}, nil
+}
+
+func apiCancelTicket(r *apiRequest) (interface{}, error) {
+	if err := r.loggedIn(); err != nil {
+		return nil, err
+	}
+	t, err := loadTicket(r.ctx, r.params[0])
+	if err != nil {
+		return nil, err
+	}
+	if t.Owner != r.user.Email {
+		return nil, errNotFound("ticket %v not found", r.params[0])
+	}
+	if err := t.Cancel(r.ctx); err != nil {
+		if err == conf.ErrTicketNotSold || err == datastore.ErrConcurrentTransaction {
+			// It was cancelled or changed since it was loaded.
+			return nil, &apiError{http.StatusConflict, "ticket_not_sold", "the ticket is not sold"}
+		}
+		return nil, err
+	}
+	return newTicketsJSON([]conf.Ticket{*t})[0], nil
+}
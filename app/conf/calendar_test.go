@@ -0,0 +1,182 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+//go:build appengine
+// +build appengine
+
+package conf
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"appengine"
+	"appengine/aetest"
+
+	"code.google.com/p/google-api-go-client/calendar/v3"
+	"github.com/campoy/goconf/pkg/auth"
+	"github.com/campoy/goconf/pkg/auth/authtest"
+	"github.com/campoy/goconf/pkg/identity"
+	"github.com/campoy/goconf/pkg/session"
+	"github.com/campoy/goconf/pkg/tmpl"
+)
+
+// calendarTest serves calendarInfoHandler with a fake Google, whose calendar
+// API has a single event.
+//
+// These tests don't run anywhere yet: they need aetest from the App Engine
+// SDK, whose toolchain can't build the packages they use, like pkg/auth,
+// authtest and golang.org/x/oauth2. They document how the handler should
+// behave. The token flows it relies on are tested in pkg/auth, which runs with
+// the standard toolchain.
+type calendarTest struct {
+	ctx aetest.Context
+	srv *authtest.Server
+	r   *http.Request // signed in as user
+	u   *identity.Identity
+}
+
+func newCalendarTest(t *testing.T) *calendarTest {
+	ctx, err := aetest.NewContext(&aetest.Options{StronglyConsistentDatastore: true})
+	if err != nil {
+		t.Fatalf("new context: %v", err)
+	}
+	t.Cleanup(func() { ctx.Close() })
+	if err := tmpl.ParseTemplates("../templates/*.tmpl"); err != nil {
+		t.Fatalf("parse templates: %v", err)
+	}
+
+	srv := authtest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.ClientID, srv.ClientSecret = google.ClientID, google.ClientSecret
+	srv.Resource("/calendar/v3/calendars/primary/events", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"items": [{
+			"summary": "Gophercon",
+			"organizer": {"email": "organizer@example.com"},
+			"start": {"date": "2030-01-02"}
+		}]}`)
+	}), calendar.CalendarReadonlyScope)
+
+	oldContext, oldKeys, oldAuthenticator := oauth2Context, auth.DefaultManager.Tokens.Keys, authenticator
+	t.Cleanup(func() {
+		oauth2Context, auth.DefaultManager.Tokens.Keys, authenticator = oldContext, oldKeys, oldAuthenticator
+	})
+	oauth2Context = func(c appengine.Context) context.Context {
+		return auth.WithTransport(auth.NewContext(c), srv.Transport())
+	}
+	auth.DefaultManager.Tokens.Keys = [][]byte{[]byte("0123456789abcdef")}
+	dev := &identity.Dev{Store: &identity.SessionStore{Sessions: &session.Manager{
+		Keys:  [][]byte{[]byte("0123456789abcdef0123456789abcdef")},
+		Store: &session.MemoryStore{},
+	}}}
+	authenticator = dev
+
+	login := httptest.NewRequest("POST", identity.LoginPath,
+		strings.NewReader(url.Values{"email": {"gopher@example.com"}}.Encode()))
+	login.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	dev.ServeHTTP(w, login)
+	// The session cookie is cleared before it's set, so the last one counts.
+	cookies := make(map[string]*http.Cookie)
+	for _, c := range w.Result().Cookies() {
+		cookies[c.Name] = c
+	}
+	r := httptest.NewRequest("GET", "/calendarinfo", nil)
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	u, err := dev.Current(r)
+	if err != nil || u == nil {
+		t.Fatalf("sign in: got %v, %v", u, err)
+	}
+	return &calendarTest{ctx, srv, r, u}
+}
+
+// authorize grants the calendar scope to the application as the user, with
+// the device authorization flow.
+func (c *calendarTest) authorize(t *testing.T) {
+	ctx := oauth2Context(c.ctx)
+	da, err := auth.DeviceAuth(ctx, google, calendar.CalendarReadonlyScope)
+	if err != nil {
+		t.Fatalf("device authorization: %v", err)
+	}
+	if err := c.srv.ApproveDevice(da.UserCode); err != nil {
+		t.Fatalf("approve device: %v", err)
+	}
+	if err := auth.WaitDevice(ctx, c.u.Email, google, da, calendar.CalendarReadonlyScope); err != nil {
+		t.Fatalf("wait device: %v", err)
+	}
+}
+
+// grant returns the grant saved for the user.
+func (c *calendarTest) grant(t *testing.T) *auth.Grant {
+	g, err := auth.DefaultManager.Tokens.Grant(oauth2Context(c.ctx), c.u.Email, google.Name)
+	if err != nil {
+		t.Fatalf("grant: %v", err)
+	}
+	return g
+}
+
+func (c *calendarTest) serve() (string, error) {
+	var b bytes.Buffer
+	err := calendarInfoHandler(&b, c.r, c.ctx, c.u)
+	return b.String(), err
+}
+
+func TestCalendarInfo(t *testing.T) {
+	c := newCalendarTest(t)
+	// The tokens expire before they're used, so they're refreshed.
+	c.srv.TokenLifetime = time.Second
+	c.authorize(t)
+	g := c.grant(t)
+
+	body, err := c.serve()
+	if err != nil {
+		t.Fatalf("calendar info: %v", err)
+	}
+	for _, want := range []string{"gopher@example.com", "Gophercon", "organizer@example.com", "2030-01-02"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("calendar info doesn't show %q:\n%s", want, body)
+		}
+	}
+	if refreshed := c.grant(t); refreshed.AccessToken == g.AccessToken {
+		t.Errorf("refreshed access token wasn't saved")
+	}
+}
+
+func TestCalendarInfoRevoked(t *testing.T) {
+	c := newCalendarTest(t)
+	c.srv.TokenLifetime = time.Second
+	c.authorize(t)
+
+	c.srv.FailNext(authtest.TokenPath, "invalid_grant")
+	_, err := c.serve()
+	if err != RedirectTo("/calendarinfo") {
+		t.Fatalf("revoked grant: got %v, want a redirect to authorize again", err)
+	}
+	if g := c.grant(t); g != nil {
+		t.Errorf("revoked grant %+v wasn't deleted", g)
+	}
+}
+
+func TestCalendarInfoRejected(t *testing.T) {
+	c := newCalendarTest(t)
+	c.authorize(t)
+
+	c.srv.ExpireTokens()
+	if _, err := c.serve(); err == nil || !strings.Contains(err.Error(), "get calendar events") {
+		t.Errorf("rejected token: got %v, want the error of the calendar API", err)
+	}
+	if c.grant(t) == nil {
+		t.Errorf("grant deleted after the calendar API rejected its token")
+	}
+}
@@ -1,62 +1,36 @@
 package conf
 
 import (
+	"io"
+	"sync"
 	"text/template"
+)
 
-	"appengine/datastore"
+// Notification email data
+const emailSender = "campoy@golang.org"
 
-	"github.com/campoy/goconf/pkg/conf"
-)
+var emailSubjectTmpl = template.Must(template.New("subject").Parse("Conference you might be interested in: {{.Name}}"))
+var emailBodyTmpl = &fileTemplate{file: "templates/email.tmpl"}
 
-var topicList = []string{
-	"Medical Innovations",
-	"Programming Languages",
-	"Web Technologies",
-	"Movie Making",
-}
+// Recommendations digest email data
+const digestSubject = "Conferences recommended for you"
 
-var cityList = []string{
-	"London",
-	"Chicago",
-	"San Francisco",
-	"Paris",
-}
+var digestBodyTmpl = &fileTemplate{file: "templates/digest.tmpl"}
 
-// List of all conference lists to display
-var conferenceLists = [...]struct {
-	title string
-	query *datastore.Query
-}{
-	{
-		"All Conferences",
-		datastore.NewQuery(conf.ConferenceKind),
-	},
-	{
-		"All Conferences Sorted Alphabetically",
-		datastore.NewQuery(conf.ConferenceKind).
-			Order("Name"),
-	},
-	{
-		"All Conferences In London sorted Alphabetically",
-		datastore.NewQuery(conf.ConferenceKind).
-			Filter("City =", "London").
-			Order("Name"),
-	},
-	{
-		"All Conferences About Medical Innovations In London",
-		datastore.NewQuery(conf.ConferenceKind).
-			Filter("City =", "London").
-			Filter("Topic =", "Medical Innovations"),
-	},
-	{
-		"All conferences With 50 or more attendees",
-		datastore.NewQuery(conf.ConferenceKind).
-			Filter("MaxAttendees >", 50),
-	},
+// A fileTemplate is parsed from its file the first time it's executed, so the
+// package can be loaded where the templates can't be found, like in its
+// tests.
+type fileTemplate struct {
+	file string
+	once sync.Once
+	t    *template.Template
+	err  error
 }
 
-// Notification email data
-const emailSender = "campoy@golang.org"
-
-var emailSubjectTmpl = template.Must(template.New("subject").Parse("Conference you might be interested in: {{.Name}}"))
-var emailBodyTmpl = template.Must(template.ParseFiles("templates/email.tmpl"))
+func (f *fileTemplate) Execute(w io.Writer, data interface{}) error {
+	f.once.Do(func() { f.t, f.err = template.ParseFiles(f.file) })
+	if f.err != nil {
+		return f.err
+	}
+	return f.t.Execute(w, data)
+}
@@ -0,0 +1,552 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package conf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+
+	"appengine"
+	"appengine/datastore"
+
+	"github.com/campoy/goconf/pkg/conf"
+	"github.com/campoy/goconf/pkg/csrf"
+	"github.com/campoy/goconf/pkg/identity"
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+const graphqlSchema = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+type Query {
+	conference(id: ID!): Conference
+	conferences(topic: String, city: String, first: Int, after: String): ConferencePage!
+	ticket(id: ID!): Ticket
+	me: UserProfile
+	announcement: Announcement
+}
+
+type Mutation {
+	scheduleConference(input: ConferenceInput!): Conference!
+	buyTicket(id: ID!): Ticket!
+}
+
+type Conference {
+	id: ID!
+	name: String!
+	description: String!
+	city: String!
+	topic: String!
+	topics: [String!]!
+	maxAttendees: Int!
+	ticketsAvailable: Int!
+	startDate: String!
+	endDate: String!
+	timeZone: String!
+	approved: Boolean!
+	organizer: UserProfile!
+	availableTickets(first: Int, after: String): TicketPage!
+}
+
+type ConferencePage {
+	conferences: [Conference!]!
+	nextCursor: String
+}
+
+type TicketPage {
+	tickets: [Ticket!]!
+	nextCursor: String
+}
+
+type Ticket {
+	id: ID!
+	number: Int!
+	state: String!
+	conference: Conference!
+}
+
+# The email and tickets of a user are only visible to the user.
+type UserProfile {
+	name: String!
+	email: String
+	topics: [String!]!
+	tickets: [Ticket!]
+}
+
+type Announcement {
+	message: String!
+	time: String!
+}
+
+input ConferenceInput {
+	name: String!
+	description: String!
+	city: String!
+	topic: String
+	topics: [String!]
+	maxAttendees: Int!
+	startDate: String!
+	endDate: String!
+	timeZone: String
+}
+`
+
+var schema = graphql.MustParseSchema(graphqlSchema, &gqlRoot{})
+
+// A gqlRequest holds the state of a GraphQL request shared by all its resolvers.
+type gqlRequest struct {
+	ctx    appengine.Context
+	user   *identity.Identity
+	loader *conf.Loader
+	get    bool // whether the request was a GET, which can't run mutations
+
+	mu      sync.Mutex
+	profile *conf.UserProfile // of the user, with the tickets
+}
+
+// userProfile returns the profile of the user, loading it the first time.
+func (req *gqlRequest) userProfile() (*conf.UserProfile, error) {
+	req.mu.Lock()
+	defer req.mu.Unlock()
+	if req.profile == nil {
+		up, err := conf.LoadUserProfile(req.ctx, req.user.Email)
+		if err != nil {
+			return nil, err
+		}
+		req.profile = up
+	}
+	return req.profile, nil
+}
+
+// errInternal is returned by the resolvers instead of the errors that would
+// disclose internal details, which are logged.
+var errInternal = errors.New("internal error")
+
+// error returns the error to return from a resolver for an error of the conf
+// package: the ones caused by the query, like invalid arguments or missing
+// permissions, are returned as they are, and any other is logged and
+// returned as errInternal.
+func (req *gqlRequest) error(err error) error {
+	switch err.(type) {
+	case conf.ValidationError, *conf.CursorError, Forbidden:
+		return err
+	}
+	req.ctx.Errorf("graphql: %v", err)
+	return errInternal
+}
+
+// gqlLimit returns the page size requested with a first argument.
+func gqlLimit(first *int32) (int, error) {
+	if first == nil {
+		return defaultAPILimit, nil
+	}
+	if *first <= 0 || *first > maxAPILimit {
+		return 0, fmt.Errorf("first must be between 1 and %v", maxAPILimit)
+	}
+	return int(*first), nil
+}
+
+// mutating returns an error if the request can't run mutations. Only POST
+// requests, which are checked against cross-site request forgery, can.
+func (req *gqlRequest) mutating() error {
+	if req.get {
+		return fmt.Errorf("mutations must be sent with POST")
+	}
+	return nil
+}
+
+// isUser returns true if the profile is the one of the user.
+func (req *gqlRequest) isUser(up *conf.UserProfile) bool {
+	return req.user != nil && req.user.Email == up.MainEmail
+}
+
+type gqlKey int
+
+// gqlReq returns the gqlRequest stored in the context of the resolvers.
+func gqlReq(ctx context.Context) *gqlRequest {
+	return ctx.Value(gqlKey(0)).(*gqlRequest)
+}
+
+// graphqlHandler executes the GraphQL queries sent either as the query
+// parameter of a GET request or as the JSON body of a POST request. The POST
+// requests of signed in users need a CSRF token in the csrf.HeaderName
+// header.
+func graphqlHandler(w http.ResponseWriter, r *http.Request) {
+	defer trackRequest(r)()
+	var params struct {
+		Query         string                 `json:"query"`
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+	}
+	switch r.Method {
+	case "GET":
+		params.Query = r.FormValue("query")
+		params.OperationName = r.FormValue("operationName")
+		if v := r.FormValue("variables"); len(v) > 0 {
+			if err := json.Unmarshal([]byte(v), &params.Variables); err != nil {
+				http.Error(w, "bad variables: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	case "POST":
+		if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mt != "application/json" {
+			http.Error(w, "request bodies must be application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+		if currentUser(r) != nil {
+			if err := protector.Check(r); err == csrf.ErrNoSession || err == csrf.ErrBadToken {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			} else if err != nil {
+				appengine.NewContext(r).Errorf("check CSRF token: %v", err)
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			http.Error(w, "bad request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "unsupported method "+r.Method, http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := appengine.NewContext(r)
+	req := &gqlRequest{ctx: ctx, user: currentUser(r), loader: conf.NewLoader(ctx), get: r.Method == "GET"}
+	gctx := context.WithValue(context.Background(), gqlKey(0), req)
+	res := schema.Exec(gctx, params.Query, params.OperationName, params.Variables)
+	writeJSON(w, http.StatusOK, res)
+}
+
+// gqlRoot resolves the queries and mutations.
+type gqlRoot struct{}
+
+func (gqlRoot) Conference(ctx context.Context, args struct{ ID graphql.ID }) (*gqlConf, error) {
+	req := gqlReq(ctx)
+	c, err := req.loader.Conference(string(args.ID))
+	if err != nil {
+		return nil, req.error(err)
+	}
+	if c == nil {
+		return nil, nil
+	}
+	return &gqlConf{c}, nil
+}
+
+func (gqlRoot) Conferences(ctx context.Context, args struct {
+	Topic, City, After *string
+	First              *int32
+}) (*gqlConfPage, error) {
+	req := gqlReq(ctx)
+	q := datastore.NewQuery(conf.ConferenceKind)
+	if args.Topic != nil {
+		q = q.Filter("AllTopics =", *args.Topic)
+	}
+	if args.City != nil {
+		q = q.Filter("City =", *args.City)
+	}
+	limit, err := gqlLimit(args.First)
+	if err != nil {
+		return nil, err
+	}
+	cursor := ""
+	if args.After != nil {
+		cursor = *args.After
+	}
+
+	p, err := conf.LoadConfPage(req.ctx, q, cursor, limit)
+	if err != nil {
+		return nil, req.error(err)
+	}
+
+	// Load all the organizers at once.
+	req.loader.PrimeConferences(p.Conferences)
+	orgs := make([]string, len(p.Conferences))
+	for i, c := range p.Conferences {
+		orgs[i] = c.Organizer
+	}
+	if _, err := req.loader.Profiles(orgs); err != nil {
+		return nil, req.error(err)
+	}
+	return &gqlConfPage{p}, nil
+}
+
+func (gqlRoot) Ticket(ctx context.Context, args struct{ ID graphql.ID }) (*gqlTicket, error) {
+	req := gqlReq(ctx)
+	id := string(args.ID)
+	t, err := conf.LoadTicket(req.ctx, id)
+	if err != nil {
+		if notFound(id, err) {
+			return nil, nil
+		}
+		return nil, req.error(err)
+	}
+	return &gqlTicket{t}, nil
+}
+
+func (gqlRoot) Me(ctx context.Context) (*gqlProfile, error) {
+	req := gqlReq(ctx)
+	if req.user == nil {
+		return nil, nil
+	}
+	up, err := req.userProfile()
+	if err != nil {
+		return nil, req.error(err)
+	}
+	return &gqlProfile{up}, nil
+}
+
+func (gqlRoot) Announcement(ctx context.Context) (*gqlAnnouncement, error) {
+	req := gqlReq(ctx)
+	a, err := conf.LatestAnnouncement(req.ctx)
+	if err != nil {
+		return nil, req.error(err)
+	}
+	if a == nil {
+		return nil, nil
+	}
+	return &gqlAnnouncement{a}, nil
+}
+
+type gqlConfInput struct {
+	Name, Description, City string
+	Topic                   *string
+	Topics                  *[]string
+	MaxAttendees            int32
+	StartDate, EndDate      string
+	TimeZone                *string
+}
+
+func (gqlRoot) ScheduleConference(ctx context.Context, args struct{ Input gqlConfInput }) (*gqlConf, error) {
+	req := gqlReq(ctx)
+	if err := req.mutating(); err != nil {
+		return nil, err
+	}
+	if req.user == nil {
+		return nil, fmt.Errorf("scheduling a conference requires to be logged in")
+	}
+	if err := checkPermission(req.ctx, req.user, conf.PermScheduleConference, nil); err != nil {
+		return nil, req.error(err)
+	}
+	in := args.Input
+	c := &conf.Conference{
+		Name:         in.Name,
+		Description:  in.Description,
+		City:         in.City,
+		MaxAttendees: int(in.MaxAttendees),
+		TixAvailable: int(in.MaxAttendees),
+		Organizer:    req.user.Email,
+	}
+	if in.Topics != nil {
+		c.Topics = *in.Topics
+	} else if in.Topic != nil {
+		c.Topics = []string{*in.Topic}
+	}
+	if in.TimeZone != nil {
+		c.TimeZone = *in.TimeZone
+	}
+	if err := c.ParseDates(req.ctx, in.StartDate, in.EndDate); err != nil {
+		return nil, req.error(err)
+	}
+	if err := scheduleConf(req.ctx, c); err != nil {
+		return nil, req.error(err)
+	}
+	return &gqlConf{c}, nil
+}
+
+func (gqlRoot) BuyTicket(ctx context.Context, args struct{ ID graphql.ID }) (*gqlTicket, error) {
+	req := gqlReq(ctx)
+	if err := req.mutating(); err != nil {
+		return nil, err
+	}
+	if req.user == nil {
+		return nil, fmt.Errorf("buying a ticket requires to be logged in")
+	}
+	if err := checkPermission(req.ctx, req.user, conf.PermBuyTicket, nil); err != nil {
+		return nil, req.error(err)
+	}
+	id := string(args.ID)
+	t, err := conf.LoadTicket(req.ctx, id)
+	if err != nil {
+		if notFound(id, err) {
+			return nil, fmt.Errorf("ticket %v not found", id)
+		}
+		return nil, req.error(err)
+	}
+	if err := t.SellTo(req.ctx, req.user.Email); err != nil {
+		if err == conf.ErrTicketUnavailable || err == datastore.ErrConcurrentTransaction {
+			return nil, errors.New("the ticket is not available")
+		}
+		return nil, req.error(err)
+	}
+	return &gqlTicket{t}, nil
+}
+
+// gqlConf resolves the fields of a conference.
+type gqlConf struct{ c *conf.Conference }
+
+func (r *gqlConf) ID() graphql.ID          { return graphql.ID(r.c.ID()) }
+func (r *gqlConf) Name() string            { return r.c.Name }
+func (r *gqlConf) Description() string     { return r.c.Description }
+func (r *gqlConf) City() string            { return r.c.City }
+func (r *gqlConf) Topic() string           { return r.c.Topic }
+func (r *gqlConf) MaxAttendees() int32     { return int32(r.c.MaxAttendees) }
+func (r *gqlConf) TicketsAvailable() int32 { return int32(r.c.TixAvailable) }
+func (r *gqlConf) StartDate() string       { return r.c.StartDate.Format(time.RFC3339) }
+func (r *gqlConf) EndDate() string         { return r.c.EndDate.Format(time.RFC3339) }
+func (r *gqlConf) TimeZone() string        { return r.c.TimeZone }
+func (r *gqlConf) Approved() bool          { return r.c.Approved }
+
+func (r *gqlConf) Topics() []string {
+	if r.c.Topics == nil {
+		return []string{}
+	}
+	return r.c.Topics
+}
+
+func (r *gqlConf) Organizer(ctx context.Context) (*gqlProfile, error) {
+	req := gqlReq(ctx)
+	up, err := req.loader.Profile(r.c.Organizer)
+	if err != nil {
+		return nil, req.error(err)
+	}
+	return &gqlProfile{up}, nil
+}
+
+func (r *gqlConf) AvailableTickets(ctx context.Context, args struct {
+	First *int32
+	After *string
+}) (*gqlTicketPage, error) {
+	req := gqlReq(ctx)
+	limit, err := gqlLimit(args.First)
+	if err != nil {
+		return nil, err
+	}
+	cursor := ""
+	if args.After != nil {
+		cursor = *args.After
+	}
+	p, err := req.loader.AvailableTickets(r.c, cursor, limit)
+	if err != nil {
+		return nil, req.error(err)
+	}
+	return &gqlTicketPage{p}, nil
+}
+
+// gqlConfPage resolves the fields of a page of conferences.
+type gqlConfPage struct{ p *conf.ConfPage }
+
+func (r *gqlConfPage) Conferences() []*gqlConf {
+	cs := make([]*gqlConf, len(r.p.Conferences))
+	for i := range r.p.Conferences {
+		cs[i] = &gqlConf{&r.p.Conferences[i]}
+	}
+	return cs
+}
+
+func (r *gqlConfPage) NextCursor() *string {
+	if len(r.p.Next) == 0 {
+		return nil
+	}
+	return &r.p.Next
+}
+
+// gqlTicketPage resolves the fields of a page of tickets.
+type gqlTicketPage struct{ p *conf.TicketPage }
+
+func (r *gqlTicketPage) Tickets() []*gqlTicket { return gqlTickets(r.p.Tickets) }
+
+func (r *gqlTicketPage) NextCursor() *string {
+	if len(r.p.Next) == 0 {
+		return nil
+	}
+	return &r.p.Next
+}
+
+// gqlTicket resolves the fields of a ticket.
+type gqlTicket struct{ t *conf.Ticket }
+
+func gqlTickets(ts []conf.Ticket) []*gqlTicket {
+	res := make([]*gqlTicket, len(ts))
+	for i := range ts {
+		res[i] = &gqlTicket{&ts[i]}
+	}
+	return res
+}
+
+func (r *gqlTicket) ID() graphql.ID { return graphql.ID(r.t.ID()) }
+func (r *gqlTicket) Number() int32  { return int32(r.t.Number) }
+func (r *gqlTicket) State() string  { return string(r.t.State) }
+
+func (r *gqlTicket) Conference(ctx context.Context) (*gqlConf, error) {
+	req := gqlReq(ctx)
+	c, err := req.loader.Conference(r.t.ConferenceID())
+	if err == nil && c == nil {
+		err = fmt.Errorf("conference of ticket %v not found", r.t.ID())
+	}
+	if err != nil {
+		return nil, req.error(err)
+	}
+	return &gqlConf{c}, nil
+}
+
+// gqlProfile resolves the fields of a user profile.
+type gqlProfile struct{ up *conf.UserProfile }
+
+func (r *gqlProfile) Name() string { return r.up.Name }
+
+func (r *gqlProfile) Email(ctx context.Context) *string {
+	if !gqlReq(ctx).isUser(r.up) {
+		return nil
+	}
+	return &r.up.MainEmail
+}
+
+func (r *gqlProfile) Topics() []string {
+	if r.up.Topics == nil {
+		return []string{}
+	}
+	return r.up.Topics
+}
+
+func (r *gqlProfile) Tickets(ctx context.Context) (*[]*gqlTicket, error) {
+	req := gqlReq(ctx)
+	if !req.isUser(r.up) {
+		return nil, nil
+	}
+	// The profiles of the loader don't have the tickets.
+	up, err := req.userProfile()
+	if err != nil {
+		return nil, req.error(err)
+	}
+
+	// Load the conferences of all the tickets at once.
+	ts := up.Tickets()
+	ids := make([]string, len(ts))
+	for i := range ts {
+		ids[i] = ts[i].ConferenceID()
+	}
+	if _, err := req.loader.Conferences(ids); err != nil {
+		return nil, req.error(err)
+	}
+	res := gqlTickets(ts)
+	return &res, nil
+}
+
+// gqlAnnouncement resolves the fields of an announcement.
+type gqlAnnouncement struct{ a *conf.Announcement }
+
+func (r *gqlAnnouncement) Message() string { return r.a.Message }
+func (r *gqlAnnouncement) Time() string    { return r.a.Time.Format(time.RFC3339) }
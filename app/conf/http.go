@@ -2,27 +2,29 @@ package conf
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"appengine"
 	"appengine/datastore"
+	"appengine/mail"
 	"appengine/taskqueue"
 	"appengine/urlfetch"
-	"appengine/user"
 
 	"code.google.com/p/google-api-go-client/calendar/v3"
 	"github.com/campoy/goconf/pkg/auth"
 	"github.com/campoy/goconf/pkg/conf"
+	"github.com/campoy/goconf/pkg/identity"
 	"github.com/campoy/goconf/pkg/tmpl"
 )
 
-var calendarConfig = config(calendar.CalendarScope)
-
 func init() {
 	tmpl.ParseTemplates("templates/*.tmpl")
 
@@ -30,30 +32,60 @@ func init() {
 	http.Handle("/", handler(homeHandler))
 
 	// conferences
-	http.Handle("/scheduleconference", handler(scheduleConfHandler))
-	http.Handle("/saveconference", authHandler(saveConfHandler))
+	http.Handle("/scheduleconference", permHandler{conf.PermScheduleConference, scheduleConfHandler})
+	http.Handle("/saveconference", permHandler{conf.PermScheduleConference, saveConfHandler})
+	http.Handle("/editconference", authHandler(editConfHandler))
 	http.Handle("/listconferences", authHandler(listConfsHandler))
 	http.Handle("/notifyinterestedusers", handler(notifyInterestedUsersHandler))
-	http.Handle("/reviewconferences", handler(reviewConfsHandler))
+	http.Handle("/precomputerecommendations", handler(precomputeRecommendationsHandler))
+	http.Handle("/reviewconferences", permHandler{conf.PermReviewConference, reviewConfsHandler})
+	http.Handle("/reindexconferences", handler(reindexConfsHandler))
+	http.Handle(incomingMailPath, handler(incomingMailHandler))
+
+	http.Handle("/nearby", handler(nearbyConfsHandler))
+	http.Handle("/dashboard", authHandler(dashboardHandler))
 
 	// admin page
-	http.Handle("/developer", handler(developerHandler))
+	http.Handle("/developer", permHandler{conf.PermManageSite, developerHandler})
+	http.Handle("/venues", permHandler{conf.PermManageSite, venuesHandler})
+	http.Handle("/roles", permHandler{conf.PermGrantRoles, rolesHandler})
+
+	// events and webhooks
+	http.Handle(conf.EventProcessPath, handler(processEventsHandler))
+	http.Handle(conf.TicketCreationPath, handler(createTicketsHandler))
+	http.Handle(conf.WebhookDeliveryPath, handler(deliverWebhookHandler))
 
 	// tickets
 	http.Handle("/showtickets", handler(showTicketsHandler))
-	http.Handle("/buyticket", authHandler(buyTicketHandler))
+	http.Handle("/buyticket", permHandler{conf.PermBuyTicket, buyTicketHandler})
 
 	// user profile
 	http.Handle("/userprofile", authHandler(userProfileHandler))
 	http.Handle("/saveprofile", authHandler(saveProfileHandler))
-	auth.Handle("/calendarinfo", handler(calendarInfoHandler), calendarConfig)
+	auth.Handle("/calendarinfo", authHandler(calendarInfoHandler), google, calendar.CalendarReadonlyScope)
+
+	// JSON API
+	http.HandleFunc(apiPrefix, apiServeHTTP)
+	http.HandleFunc("/graphql", graphqlHandler)
 }
 
 // home
 
+// numRecommendations is the number of conferences recommended to a user.
+const numRecommendations = 5
+
 func homeHandler(w io.Writer, r *http.Request) error {
 	ctx := appengine.NewContext(r)
-	p, err := NewPage(ctx, "home", nil)
+
+	var recs []conf.Recommendation
+	if u := currentUser(r); u != nil {
+		var err error
+		if recs, err = recommend(ctx, u.Email); err != nil {
+			ctx.Errorf("recommend: %v", err)
+		}
+	}
+
+	p, err := NewPage(ctx, r, "home", recs)
 	if err != nil {
 		fmt.Errorf("create home page: %v", err)
 	}
@@ -62,9 +94,12 @@ func homeHandler(w io.Writer, r *http.Request) error {
 
 // conferences
 
-func scheduleConfHandler(w io.Writer, r *http.Request) error {
-	ctx := appengine.NewContext(r)
-	p, err := NewPage(ctx, "scheduleconf", nil)
+func scheduleConfHandler(w io.Writer, r *http.Request, ctx appengine.Context, u *identity.Identity) error {
+	vs, err := conf.LoadVenues(ctx)
+	if err != nil {
+		return err
+	}
+	p, err := NewPage(ctx, r, "scheduleconf", vs)
 	if err != nil {
 		return fmt.Errorf("create scheduleconf page: %v", err)
 	}
@@ -76,45 +111,110 @@ func confFromRequest(r *http.Request) (*conf.Conference, error) {
 	if err != nil {
 		return nil, fmt.Errorf("bad max_attendees value: %q", r.FormValue("max_attendees"))
 	}
-	start, err := time.Parse("2006-01-02", r.FormValue("start_date"))
-	if err != nil {
-		return nil, fmt.Errorf("bad start_date value: %q", r.FormValue("start_date"))
-	}
-	end, err := time.Parse("2006-01-02", r.FormValue("end_date"))
-	if err != nil {
-		return nil, fmt.Errorf("bad end_date value: %q", r.FormValue("end_date"))
-	}
 	confName := r.FormValue("conf_name")
+	ctx := appengine.NewContext(r)
 	email := ""
-	if u := user.Current(appengine.NewContext(r)); u != nil {
+	if u := currentUser(r); u != nil {
 		email = u.Email
 	}
 
-	return &conf.Conference{
+	c := &conf.Conference{
 		Name:         confName,
 		Description:  r.FormValue("conf_desc"),
 		City:         r.FormValue("city"),
-		Topic:        r.FormValue("topic"),
+		VenueID:      r.FormValue("venue"),
+		Topics:       r.Form["topics"],
 		MaxAttendees: int(nAtt),
 		TixAvailable: int(nAtt),
-		StartDate:    start,
-		EndDate:      end,
+		TimeZone:     r.FormValue("time_zone"),
 		Organizer:    email,
-	}, nil
+	}
+	if err := c.ParseDates(ctx, r.FormValue("start_date"), r.FormValue("end_date")); err != nil {
+		return nil, err
+	}
+	return c, nil
 }
 
-func saveConfHandler(w io.Writer, r *http.Request, ctx appengine.Context, u *user.User) error {
+func saveConfHandler(w io.Writer, r *http.Request, ctx appengine.Context, u *identity.Identity) error {
+	if r.Method != "POST" {
+		return RedirectTo("/scheduleconference")
+	}
 	c, err := confFromRequest(r)
 	if err != nil {
 		return fmt.Errorf("conf from request: %v", err)
 	}
+	if err := scheduleConf(ctx, c); err != nil {
+		return err
+	}
+	return RedirectTo("/showtickets?conf_id=" + url.QueryEscape(c.ID()))
+}
+
+// editConfHandler shows the form to edit a conference, and saves it when the
+// form is submitted. Only the organizers of the conference can edit it.
+func editConfHandler(w io.Writer, r *http.Request, ctx appengine.Context, u *identity.Identity) error {
+	c, err := conf.LoadConference(ctx, r.FormValue("conf_id"))
+	if err != nil {
+		return fmt.Errorf("load conference: %v", err)
+	}
+	if err := checkPermission(ctx, u, conf.PermEditConference, c); err != nil {
+		return err
+	}
 
-	err = datastore.RunInTransaction(ctx, func(ctx appengine.Context) error {
-		// Save the conference and generate the tickets
+	if r.Method == "POST" {
+		c.Name = r.FormValue("conf_name")
+		c.Description = r.FormValue("conf_desc")
+		c.City = r.FormValue("city")
+		c.VenueID = r.FormValue("venue")
+		c.Topics = r.Form["topics"]
+		c.TimeZone = r.FormValue("time_zone")
+		if err := c.ParseDates(ctx, r.FormValue("start_date"), r.FormValue("end_date")); err != nil {
+			return err
+		}
 		if err := c.Save(ctx); err != nil {
 			return fmt.Errorf("save conference: %v", err)
 		}
-		if err := c.CreateAndSaveTickets(ctx); err != nil {
+		return RedirectTo("/dashboard")
+	}
+
+	vs, err := conf.LoadVenues(ctx)
+	if err != nil {
+		return err
+	}
+	loc, err := c.Location()
+	if err != nil {
+		return err
+	}
+	data := struct {
+		Conf               *conf.Conference
+		Venues             []conf.Venue
+		Selected           map[string]bool
+		StartDate, EndDate string
+	}{c, vs, make(map[string]bool),
+		c.StartDate.In(loc).Format(conf.DateLayout),
+		c.EndDate.In(loc).Format(conf.DateLayout)}
+	for _, t := range c.Topics {
+		data.Selected[t] = true
+	}
+	p, err := NewPage(ctx, r, "editconf", data)
+	if err != nil {
+		return fmt.Errorf("create editconf page: %v", err)
+	}
+	return p.Render(w)
+}
+
+// scheduleConf saves a new conference, announces it, and queues the tasks to
+// create its tickets, to notify the interested users and to review it.
+func scheduleConf(ctx appengine.Context, c *conf.Conference) error {
+	if err := c.Validate(ctx); err != nil {
+		return err
+	}
+	return conf.RunInTransaction(ctx, func(ctx appengine.Context) error {
+		// Save the conference and queue the generation of the tickets,
+		// which can be too many for a transaction.
+		if err := c.Save(ctx); err != nil {
+			return fmt.Errorf("save conference: %v", err)
+		}
+		if err := c.QueueTickets(ctx); err != nil {
 			return fmt.Errorf("generate tickets: %v", err)
 		}
 
@@ -131,7 +231,7 @@ func saveConfHandler(w io.Writer, r *http.Request, ctx appengine.Context, u *use
 			"/notifyinterestedusers",
 			url.Values{"conf_id": []string{c.ID()}},
 		)
-		if _, err = taskqueue.Add(ctx, task, ""); err != nil {
+		if _, err := taskqueue.Add(ctx, task, ""); err != nil {
 			return fmt.Errorf("add task to default queue: %v", err)
 		}
 
@@ -140,45 +240,151 @@ func saveConfHandler(w io.Writer, r *http.Request, ctx appengine.Context, u *use
 			Method:  "PULL",
 			Payload: []byte(c.ID()),
 		}
-		task, err := taskqueue.Add(ctx, task, "review-conference-queue")
-		if err != nil {
+		if _, err := taskqueue.Add(ctx, task, "review-conference-queue"); err != nil {
 			return fmt.Errorf("add task to review queue: %v", err)
 		}
 		return nil
-	}, &datastore.TransactionOptions{XG: true})
+	})
+}
+
+// filterFromRequest builds a conference filter from the values of the search
+// form.
+func filterFromRequest(r *http.Request) (*conf.ConfFilter, error) {
+	f := &conf.ConfFilter{
+		Topic:     r.FormValue("topic"),
+		City:      r.FormValue("city"),
+		Available: r.FormValue("available") == "on",
+		Text:      r.FormValue("text"),
+		Sort:      r.FormValue("sort"),
+		Desc:      r.FormValue("desc") == "on",
+	}
+	var err error
+	if v := r.FormValue("from"); len(v) > 0 {
+		if f.From, err = time.Parse("2006-01-02", v); err != nil {
+			return nil, fmt.Errorf("bad from value: %q", v)
+		}
+	}
+	if v := r.FormValue("to"); len(v) > 0 {
+		if f.To, err = time.Parse("2006-01-02", v); err != nil {
+			return nil, fmt.Errorf("bad to value: %q", v)
+		}
+	}
+	return f, nil
+}
+
+func listConfsHandler(w io.Writer, r *http.Request, ctx appengine.Context, u *identity.Identity) error {
+	f, err := filterFromRequest(r)
 	if err != nil {
 		return err
 	}
 
-	return RedirectTo("/showtickets?conf_id=" + url.QueryEscape(c.ID()))
+	data := struct {
+		Form  url.Values
+		Sorts []string
+		Page  *conf.ConfPage
+		Hits  []conf.ConfHit
+		Pager *pager
+	}{Form: r.Form, Sorts: conf.SortFields}
+
+	if len(f.Text) > 0 {
+		// Text searches use the full-text index and show the most relevant
+		// conferences in a single page.
+		data.Hits, err = conf.SearchConferenceText(ctx, f, pageSize(r))
+		if err != nil {
+			return fmt.Errorf("search conferences: %v", err)
+		}
+		data.Pager = newPager(r, "/listconferences", "")
+	} else {
+		data.Page, err = conf.SearchConferences(ctx, f, r.FormValue("cursor"), pageSize(r))
+		if err != nil {
+			return fmt.Errorf("search conferences: %v", err)
+		}
+		data.Pager = newPager(r, "/listconferences", data.Page.Next)
+	}
+
+	p, err := NewPage(ctx, r, "listconfs", data)
+	if err != nil {
+		return fmt.Errorf("create listconfs page: %v", err)
+	}
+	return p.Render(w)
 }
 
-func listConfsHandler(w io.Writer, r *http.Request, ctx appengine.Context, u *user.User) error {
-	data := []*conf.ConfList{}
+// defaultNearbyKm is the default distance of the nearby conferences.
+const defaultNearbyKm = 50
+
+func nearbyConfsHandler(w io.Writer, r *http.Request) error {
+	ctx := appengine.NewContext(r)
 
-	for _, c := range conferenceLists {
-		l, err := conf.LoadConfList(ctx, c.title, c.query)
+	// Use the position given in the form, or the one App Engine guesses
+	// from the IP of the user.
+	pos := r.FormValue("lat") + "," + r.FormValue("lng")
+	if pos == "," {
+		pos = r.Header.Get("X-AppEngine-CityLatLong")
+	}
+	data := struct {
+		Lat, Lng, Km float64
+		Located      bool
+		Confs        []conf.NearbyConf
+	}{Km: defaultNearbyKm}
+	if _, err := fmt.Sscanf(pos, "%g,%g", &data.Lat, &data.Lng); err == nil {
+		data.Located = true
+	}
+	if km, err := strconv.ParseFloat(r.FormValue("km"), 64); err == nil && km > 0 {
+		data.Km = km
+	}
+
+	if data.Located {
+		var err error
+		data.Confs, err = conf.ConferencesNear(ctx, data.Lat, data.Lng, data.Km)
 		if err != nil {
-			return err
+			return fmt.Errorf("conferences near: %v", err)
 		}
-		data = append(data, l)
 	}
 
-	l, err := conf.LoadConfList(ctx,
-		"All conferences About Medical Innovations in London with "+u.Email,
-		datastore.NewQuery(conf.ConferenceKind).
-			Filter("City =", "London").
-			Filter("Topic =", "Medical Innovations").
-			Filter("Organizer =", u.Email),
-	)
+	p, err := NewPage(ctx, r, "nearby", data)
 	if err != nil {
-		return err
+		return fmt.Errorf("create nearby page: %v", err)
 	}
-	data = append(data, l)
+	return p.Render(w)
+}
 
-	p, err := NewPage(ctx, "listconfs", data)
+// dashboardHandler shows the sales of the conferences the user organizes or
+// co-organizes, among those the user is allowed to view the sales of.
+func dashboardHandler(w io.Writer, r *http.Request, ctx appengine.Context, u *identity.Identity) error {
+	cs, err := conf.OrganizerConferences(ctx, u.Email)
 	if err != nil {
-		return fmt.Errorf("create listconfs page: %v", err)
+		return err
+	}
+	ids, err := conf.CoOrganizedConferences(ctx, u.Email)
+	if err != nil {
+		return err
+	}
+	co, err := conf.NewLoader(ctx).Conferences(ids)
+	if err != nil {
+		return err
+	}
+	for _, c := range co {
+		if c != nil && c.Organizer != u.Email {
+			cs = append(cs, *c)
+		}
+	}
+	var reports []*conf.SalesReport
+	for i := range cs {
+		if err := checkPermission(ctx, u, conf.PermViewSales, &cs[i]); err != nil {
+			if _, ok := err.(Forbidden); ok {
+				continue
+			}
+			return err
+		}
+		report, err := conf.LoadSalesReport(ctx, &cs[i])
+		if err != nil {
+			return fmt.Errorf("sales of %v: %v", cs[i].Name, err)
+		}
+		reports = append(reports, report)
+	}
+	p, err := NewPage(ctx, r, "dashboard", reports)
+	if err != nil {
+		return fmt.Errorf("create dashboard page: %v", err)
 	}
 	return p.Render(w)
 }
@@ -201,6 +407,118 @@ func notifyInterestedUsersHandler(w io.Writer, r *http.Request) error {
 	return conf.MailNotifications(ctx, emailSender, subject.String(), body.String())
 }
 
+// recommend returns the recommendations precomputed for the user. If there
+// are none yet, it queues a task to precompute them and returns none, since
+// computing them takes too long to do it in the request.
+func recommend(ctx appengine.Context, email string) ([]conf.Recommendation, error) {
+	recs, err := conf.LoadRecommendations(ctx, email, numRecommendations)
+	if recs != nil || err != nil {
+		return recs, err
+	}
+	task := taskqueue.NewPOSTTask("/precomputerecommendations", url.Values{"email": {email}})
+	if _, err := taskqueue.Add(ctx, task, ""); err != nil {
+		return nil, fmt.Errorf("add task to default queue: %v", err)
+	}
+	return nil, nil
+}
+
+// recommendationsBatch is the number of users processed by each request of
+// precomputeRecommendationsHandler.
+const recommendationsBatch = 50
+
+// precomputeRecommendationsHandler precomputes the recommendations for a
+// batch of users, and queues a task to process the next batch. If the digest
+// parameter is set the users are sent an email with their recommendations.
+// If the email parameter is set, only the recommendations of that user are
+// precomputed.
+// The digests that can't be sent are logged and skipped, so the users before
+// them in the batch aren't sent theirs again when the task is retried.
+func precomputeRecommendationsHandler(w io.Writer, r *http.Request) error {
+	ctx := appengine.NewContext(r)
+	if email := r.FormValue("email"); len(email) > 0 {
+		return conf.PrecomputeUserRecommendations(ctx, email, numRecommendations)
+	}
+	digest := len(r.FormValue("digest")) > 0
+
+	var mailDigest func(*conf.UserProfile, []conf.Recommendation) error
+	if digest {
+		site := "http://" + appengine.DefaultVersionHostname(ctx) + "/"
+		mailDigest = func(up *conf.UserProfile, recs []conf.Recommendation) error {
+			if len(recs) == 0 {
+				return nil
+			}
+			var body bytes.Buffer
+			err := digestBodyTmpl.Execute(&body, struct {
+				Profile         *conf.UserProfile
+				Recommendations []conf.Recommendation
+				URL             string
+			}{up, recs, site})
+			if err != nil {
+				return err
+			}
+			to := up.NotifEmail
+			if len(to) == 0 {
+				to = up.MainEmail
+			}
+			msg := &mail.Message{
+				Sender:  emailSender,
+				To:      []string{to},
+				Subject: digestSubject,
+				Body:    body.String(),
+			}
+			if err := mail.Send(ctx, msg); err != nil {
+				ctx.Errorf("send digest to %v: %v", to, err)
+			}
+			return nil
+		}
+	}
+
+	next, err := conf.PrecomputeRecommendations(ctx, r.FormValue("cursor"),
+		recommendationsBatch, numRecommendations, mailDigest)
+	if err != nil {
+		return err
+	}
+	if len(next) == 0 {
+		return nil
+	}
+	v := url.Values{"cursor": {next}}
+	if digest {
+		v.Set("digest", "1")
+	}
+	task := taskqueue.NewPOSTTask("/precomputerecommendations", v)
+	if _, err := taskqueue.Add(ctx, task, ""); err != nil {
+		return fmt.Errorf("add task to default queue: %v", err)
+	}
+	return nil
+}
+
+// reindexBatch is the number of conferences indexed by each request of
+// reindexConfsHandler.
+const reindexBatch = 100
+
+// reindexConfsHandler adds a batch of conferences to the full-text index,
+// and queues a task to index the next batch.
+func reindexConfsHandler(w io.Writer, r *http.Request) error {
+	ctx := appengine.NewContext(r)
+	next, err := conf.ReindexConferences(ctx, r.FormValue("cursor"), reindexBatch)
+	if err != nil {
+		return err
+	}
+	if len(next) == 0 {
+		return nil
+	}
+	return queueReindex(ctx, next)
+}
+
+// queueReindex queues a task to index the conferences starting at cursor.
+func queueReindex(ctx appengine.Context, cursor string) error {
+	task := taskqueue.NewPOSTTask("/reindexconferences", url.Values{"cursor": {cursor}})
+	if _, err := taskqueue.Add(ctx, task, ""); err != nil {
+		return fmt.Errorf("add task to default queue: %v", err)
+	}
+	return nil
+}
+
 func leaseConfs(ctx appengine.Context) (ts []*taskqueue.Task, err error) {
 	for i, t := 0, 1; i < 3; i, t = i+1, 2*t {
 		ts, err = taskqueue.Lease(ctx, 4, "review-conference-queue", 10)
@@ -213,24 +531,48 @@ func leaseConfs(ctx appengine.Context) (ts []*taskqueue.Task, err error) {
 	return
 }
 
-func reviewConfsHandler(w io.Writer, r *http.Request) error {
+// reviewConf is a conference pending review together with the conversation
+// with its organizer.
+type reviewConf struct {
+	*conf.Conference
+	Messages []conf.Message
+}
+
+func reviewConfsHandler(w io.Writer, r *http.Request, ctx appengine.Context, u *identity.Identity) error {
 	data := struct {
 		Message string
-		Confs   map[string]*conf.Conference
-	}{Confs: make(map[string]*conf.Conference)}
+		Confs   map[string]*reviewConf
+	}{Confs: make(map[string]*reviewConf)}
 
-	ctx := appengine.NewContext(r)
-	if taskName := r.FormValue("task_name"); len(taskName) > 0 {
-		err := &taskqueue.Task{Name: taskName}
+	if body := r.PostFormValue("mail_body"); len(body) > 0 {
+		c, err := conf.LoadConference(ctx, r.FormValue("conf_id"))
+		if err != nil {
+			return fmt.Errorf("load conf to mail: %v", err)
+		}
+		subject := "About your conference " + c.Name
+		if err := c.MailOrganizer(ctx, emailSender, mailDomain(ctx), subject, body); err != nil {
+			return fmt.Errorf("mail organizer: %v", err)
+		}
+		data.Message = fmt.Sprintf("Your message has been sent to %v.", c.Organizer)
+	}
+	if taskName := r.PostFormValue("task_name"); len(taskName) > 0 {
+		err := taskqueue.Delete(ctx, &taskqueue.Task{Name: taskName}, "review-conference-queue")
 		if err != nil {
 			data.Message = fmt.Sprintf("Conference %v was not reviewed and approved. "+
 				"Perhaps someone else already approved it?", r.FormValue("conf_name"))
 		} else {
+			c, err := conf.LoadConference(ctx, r.FormValue("conf_id"))
+			if err != nil {
+				return fmt.Errorf("load conf to approve: %v", err)
+			}
+			if err := c.Approve(ctx); err != nil {
+				return fmt.Errorf("approve conf: %v", err)
+			}
 			data.Message = fmt.Sprintf("Conference %v has been reviewed and approved.",
 				r.FormValue("conf_name"))
 		}
 	}
-	if len(r.FormValue("reviewconference")) > 0 {
+	if len(r.PostFormValue("reviewconference")) > 0 {
 		ts, err := leaseConfs(ctx)
 		if err != nil {
 			return fmt.Errorf("retrieve conferences to review: %v", err)
@@ -242,11 +584,15 @@ func reviewConfsHandler(w io.Writer, r *http.Request) error {
 				ctx.Errorf("load conf %v to review: %v", id, err)
 				continue
 			}
-			data.Confs[t.Name] = c
+			ms, err := c.Messages(ctx)
+			if err != nil {
+				ctx.Errorf("load messages for conf %v: %v", id, err)
+			}
+			data.Confs[t.Name] = &reviewConf{c, ms}
 		}
 	}
 
-	p, err := NewPage(ctx, "reviewconfs", data)
+	p, err := NewPage(ctx, r, "reviewconfs", data)
 	if err != nil {
 		return fmt.Errorf("create reviewconfs page: %v", err)
 	}
@@ -263,11 +609,36 @@ func deleteAll(ctx appengine.Context, kind string) error {
 	return datastore.DeleteMulti(ctx, keys)
 }
 
-func developerHandler(w io.Writer, r *http.Request) error {
-	ctx := appengine.NewContext(r)
-
+func developerHandler(w io.Writer, r *http.Request, ctx appengine.Context, u *identity.Identity) error {
 	if r.Method == "GET" {
-		p, err := NewPage(ctx, "developer", nil)
+		hs, err := conf.LoadWebhooks(ctx)
+		if err != nil {
+			return err
+		}
+		ds, err := conf.LoadDeliveries(ctx, 50)
+		if err != nil {
+			return err
+		}
+		type taxonomy struct {
+			Kind  string
+			Terms []conf.Term
+		}
+		var txs []taxonomy
+		for _, kind := range []string{conf.TopicKind, conf.CityKind} {
+			ts, err := conf.LoadTerms(ctx, kind)
+			if err != nil {
+				return err
+			}
+			txs = append(txs, taxonomy{kind, ts})
+		}
+		data := struct {
+			Events     []string
+			Webhooks   []conf.Webhook
+			Deliveries []conf.Delivery
+			Taxonomies []taxonomy
+		}{conf.WebhookEventTypes, hs, ds, txs}
+
+		p, err := NewPage(ctx, r, "developer", data)
 		if err != nil {
 			return fmt.Errorf("create developer page: %v", err)
 		}
@@ -287,15 +658,157 @@ func developerHandler(w io.Writer, r *http.Request) error {
 		if err := datastore.DeleteMulti(ctx, keys); err != nil {
 			return fmt.Errorf("delete keys: %v", err)
 		}
+	case r.FormValue("reindex") == "yes":
+		if err := queueReindex(ctx, ""); err != nil {
+			return err
+		}
 	case len(r.FormValue("announcement")) > 0:
 		a := conf.NewAnnouncement(r.FormValue("announcement"))
 		if err := a.Save(ctx); err != nil {
 			return err
 		}
+	case len(r.FormValue("webhook_url")) > 0:
+		h := &conf.Webhook{
+			URL:     r.FormValue("webhook_url"),
+			Secret:  r.FormValue("webhook_secret"),
+			Events:  r.Form["webhook_events"],
+			Owner:   u.Email,
+			Created: time.Now(),
+		}
+		if err := h.Save(ctx); err != nil {
+			return err
+		}
+	case len(r.FormValue("delete_webhook")) > 0:
+		if err := conf.DeleteWebhook(ctx, r.FormValue("delete_webhook")); err != nil {
+			return fmt.Errorf("delete webhook: %v", err)
+		}
+	case len(r.FormValue("term_kind")) > 0:
+		kind, name, to := r.FormValue("term_kind"), r.FormValue("term_name"), r.FormValue("term_to")
+		var err error
+		switch r.FormValue("term_action") {
+		case "create":
+			err = conf.CreateTerm(ctx, kind, name)
+		case "rename":
+			err = conf.RenameTerm(ctx, kind, name, to)
+		case "merge":
+			err = conf.MergeTerms(ctx, kind, name, to)
+		case "archive":
+			err = conf.ArchiveTerm(ctx, kind, name, true)
+		case "restore":
+			err = conf.ArchiveTerm(ctx, kind, name, false)
+		default:
+			err = fmt.Errorf("unknown action %q", r.FormValue("term_action"))
+		}
+		if err != nil {
+			return fmt.Errorf("update term: %v", err)
+		}
 	}
 	return RedirectTo("/developer")
 }
 
+// events and webhooks
+
+func processEventsHandler(w io.Writer, r *http.Request) error {
+	return conf.ProcessEvents(appengine.NewContext(r))
+}
+
+func createTicketsHandler(w io.Writer, r *http.Request) error {
+	ctx := appengine.NewContext(r)
+	c, err := conf.LoadConference(ctx, r.FormValue("conf_id"))
+	if err != nil {
+		return fmt.Errorf("load conference: %v", err)
+	}
+	return c.CreateAndSaveTickets(ctx)
+}
+
+func deliverWebhookHandler(w io.Writer, r *http.Request) error {
+	ctx := appengine.NewContext(r)
+	payload, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("read event: %v", err)
+	}
+	// The retry count starts at 0 on the first execution of the task.
+	retries, _ := strconv.Atoi(r.Header.Get("X-AppEngine-TaskRetryCount"))
+	client := &http.Client{Transport: &urlfetch.Transport{Context: ctx}}
+	id, typ := r.Header.Get(conf.WebhookIDHeader), r.Header.Get(conf.WebhookEventHeader)
+	return conf.DeliverWebhook(ctx, client, id, typ, payload, retries+1)
+}
+
+func rolesHandler(w io.Writer, r *http.Request, ctx appengine.Context, u *identity.Identity) error {
+	if r.Method == "POST" {
+		if id := r.FormValue("revoke"); len(id) > 0 {
+			if err := conf.RevokeGrant(ctx, id); err != nil {
+				return fmt.Errorf("revoke grant: %v", err)
+			}
+			return RedirectTo("/roles")
+		}
+		g := &conf.Grant{
+			Email:     r.FormValue("email"),
+			Role:      conf.Role(r.FormValue("role")),
+			ConfID:    r.FormValue("conf_id"),
+			GrantedBy: u.Email,
+			Time:      time.Now(),
+		}
+		if err := g.Save(ctx); err != nil {
+			return err
+		}
+		return RedirectTo("/roles")
+	}
+
+	gs, err := conf.LoadGrants(ctx)
+	if err != nil {
+		return err
+	}
+	data := struct {
+		Roles  []conf.Role
+		Grants []conf.Grant
+	}{conf.Roles, gs}
+	p, err := NewPage(ctx, r, "roles", data)
+	if err != nil {
+		return fmt.Errorf("create roles page: %v", err)
+	}
+	return p.Render(w)
+}
+
+func venuesHandler(w io.Writer, r *http.Request, ctx appengine.Context, u *identity.Identity) error {
+	if r.Method == "POST" {
+		v := &conf.Venue{}
+		if id := r.FormValue("venue_id"); len(id) > 0 {
+			var err error
+			if v, err = conf.LoadVenue(ctx, id); err != nil {
+				return fmt.Errorf("load venue: %v", err)
+			}
+		}
+		v.Name = r.FormValue("name")
+		v.Address = r.FormValue("address")
+		v.TimeZone = r.FormValue("time_zone")
+		var err error
+		if v.Lat, err = strconv.ParseFloat(r.FormValue("lat"), 64); err != nil {
+			return fmt.Errorf("bad lat value: %q", r.FormValue("lat"))
+		}
+		if v.Lng, err = strconv.ParseFloat(r.FormValue("lng"), 64); err != nil {
+			return fmt.Errorf("bad lng value: %q", r.FormValue("lng"))
+		}
+		if v.Capacity, err = strconv.Atoi(r.FormValue("capacity")); err != nil {
+			return fmt.Errorf("bad capacity value: %q", r.FormValue("capacity"))
+		}
+		if err := v.Save(ctx); err != nil {
+			return err
+		}
+		return RedirectTo("/venues")
+	}
+
+	vs, err := conf.LoadVenues(ctx)
+	if err != nil {
+		return err
+	}
+	p, err := NewPage(ctx, r, "venues", vs)
+	if err != nil {
+		return fmt.Errorf("create venues page: %v", err)
+	}
+	return p.Render(w)
+}
+
 // tickets
 
 func showTicketsHandler(w io.Writer, r *http.Request) error {
@@ -305,24 +818,29 @@ func showTicketsHandler(w io.Writer, r *http.Request) error {
 		return fmt.Errorf("load conference: %v", err)
 	}
 
-	ts, err := c.AvailableTickets(ctx)
+	ts, err := c.AvailableTicketsPage(ctx, r.FormValue("cursor"), pageSize(r))
 	if err != nil {
 		return fmt.Errorf("available tickets: %v", err)
 	}
 
 	data := struct {
 		ConfName string
+		ConfID   string
 		Tickets  []conf.Ticket
-	}{c.Name, ts}
+		Pager    *pager
+	}{c.Name, c.ID(), ts.Tickets, newPager(r, "/showtickets", ts.Next)}
 
-	p, err := NewPage(ctx, "tickets", data)
+	p, err := NewPage(ctx, r, "tickets", data)
 	if err != nil {
 		return fmt.Errorf("create tickets page: %v", err)
 	}
 	return p.Render(w)
 }
 
-func buyTicketHandler(w io.Writer, r *http.Request, ctx appengine.Context, u *user.User) error {
+func buyTicketHandler(w io.Writer, r *http.Request, ctx appengine.Context, u *identity.Identity) error {
+	if r.Method != "POST" {
+		return fmt.Errorf("unsupported method %v", r.Method)
+	}
 	t, err := conf.LoadTicket(ctx, r.FormValue("ticket_key_str"))
 	if err != nil {
 		return fmt.Errorf("load ticket: %v", err)
@@ -337,20 +855,20 @@ func buyTicketHandler(w io.Writer, r *http.Request, ctx appengine.Context, u *us
 
 // user profile
 
-func userProfileHandler(w io.Writer, r *http.Request, ctx appengine.Context, u *user.User) error {
-	up, err := conf.LoadUserProfile(ctx, u.Email)
+func userProfileHandler(w io.Writer, r *http.Request, ctx appengine.Context, u *identity.Identity) error {
+	up, err := userProfile(ctx, r, u.Email)
 	if err != nil {
 		return fmt.Errorf("load user profile: %v", err)
 	}
 
-	p, err := NewPage(ctx, "userprofile", up)
+	p, err := NewPage(ctx, r, "userprofile", up)
 	if err != nil {
 		return fmt.Errorf("create userprofile page: %v", err)
 	}
 	return p.Render(w)
 }
 
-func saveProfileHandler(w io.Writer, r *http.Request, ctx appengine.Context, u *user.User) error {
+func saveProfileHandler(w io.Writer, r *http.Request, ctx appengine.Context, u *identity.Identity) error {
 	if r.Method != "POST" {
 		return RedirectTo("/userprofile")
 	}
@@ -359,6 +877,7 @@ func saveProfileHandler(w io.Writer, r *http.Request, ctx appengine.Context, u *
 		Name:       r.FormValue("person_name"),
 		NotifEmail: r.FormValue("notification_email"),
 		Topics:     r.Form["topics"],
+		TimeZone:   r.FormValue("time_zone"),
 	}
 
 	if err := up.Save(ctx); err != nil {
@@ -367,9 +886,8 @@ func saveProfileHandler(w io.Writer, r *http.Request, ctx appengine.Context, u *
 	return RedirectTo("/userprofile")
 }
 
-func calendarInfoHandler(w io.Writer, r *http.Request) error {
-	ctx := appengine.NewContext(r)
-	client, err := auth.Client(r, &urlfetch.Transport{Context: ctx}, calendarConfig)
+func calendarInfoHandler(w io.Writer, r *http.Request, ctx appengine.Context, u *identity.Identity) error {
+	client, err := auth.Client(oauth2Context(ctx), u.Email, google, calendar.CalendarReadonlyScope)
 	if err != nil {
 		return fmt.Errorf("oauth2 client: %v", err)
 	}
@@ -382,12 +900,15 @@ func calendarInfoHandler(w io.Writer, r *http.Request) error {
 		MaxResults(10).
 		TimeMin("2013-05-28T00:00:00-08:00").
 		Do()
-
+	if errors.Is(err, auth.ErrNoToken) {
+		// The grant was revoked, send the user to authorize it again.
+		return RedirectTo(r.URL.RequestURI())
+	}
 	if err != nil {
 		return fmt.Errorf("get calendar events: %v", err)
 	}
 
-	p, err := NewPage(ctx, "showcalendar", evts)
+	p, err := NewPage(ctx, r, "showcalendar", evts)
 	if err != nil {
 		fmt.Errorf("create showcalendar page: %v", err)
 	}
@@ -402,12 +923,41 @@ func (r RedirectTo) Error() string { return string(r) }
 
 type handler func(io.Writer, *http.Request) error
 
+// ServeHTTP serves the request with f. Requests with unsafe methods are
+// rejected if they lack a valid CSRF token, unless they were made by App
+// Engine, which doesn't send them. The session of the user, if any, is
+// extended.
 func (f handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer trackRequest(r)()
+	if appEngineRequest(r) {
+		f.serve(w, r)
+		return
+	}
+	protector.Protect(http.HandlerFunc(f.serve)).ServeHTTP(w, r)
+}
+
+// appEngineRequest returns whether the request was made by App Engine: by
+// cron, a task queue or the incoming mail service. App Engine removes the
+// headers it sets from the requests made by users.
+func appEngineRequest(r *http.Request) bool {
+	return len(r.Header.Get("X-AppEngine-Cron")) > 0 ||
+		len(r.Header.Get("X-AppEngine-QueueName")) > 0 ||
+		strings.HasPrefix(r.URL.Path, "/_ah/")
+}
+
+func (f handler) serve(w http.ResponseWriter, r *http.Request) {
+	if err := touchSession(w, r); err != nil {
+		appengine.NewContext(r).Errorf("touch session: %v", err)
+	}
 	b := &bytes.Buffer{}
 	err := f(b, r)
 	if err != nil {
 		if red, ok := err.(RedirectTo); ok {
-			http.Redirect(w, r, string(red), http.StatusMovedPermanently)
+			http.Redirect(w, r, string(red), http.StatusFound)
+			return
+		}
+		if f, ok := err.(Forbidden); ok {
+			http.Error(w, string(f), http.StatusForbidden)
 			return
 		}
 		msg := fmt.Sprintf("%q: request failed: %v", r.URL.Path, err)
@@ -418,11 +968,28 @@ func (f handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Write(b.Bytes())
 }
 
-type authHandler func(io.Writer, *http.Request, appengine.Context, *user.User) error
+// Forbidden is returned by handlers when the user is not allowed to perform
+// the requested operation.
+type Forbidden string
+
+func (f Forbidden) Error() string { return string(f) }
+
+type authHandler func(io.Writer, *http.Request, appengine.Context, *identity.Identity) error
 
 func (f authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer trackRequest(r)()
 	c := appengine.NewContext(r)
-	u := user.Current(c)
+	u := currentUser(r)
+	if u == nil && r.Method == "GET" {
+		url, err := authenticator.LoginURL(r, r.URL.RequestURI())
+		if err != nil {
+			c.Errorf("login URL: %v", err)
+			http.Error(w, "login failed", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, url, http.StatusFound)
+		return
+	}
 	if u == nil {
 		http.Error(w, r.URL.Path+" requires to be logged in", http.StatusForbidden)
 		return
@@ -431,3 +998,35 @@ func (f authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return f(w, r, c, u)
 	}).ServeHTTP(w, r)
 }
+
+// permHandler is an authHandler that only serves the users with a permission.
+type permHandler struct {
+	perm conf.Permission
+	f    authHandler
+}
+
+func (h permHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	authHandler(func(w io.Writer, r *http.Request, ctx appengine.Context, u *identity.Identity) error {
+		if err := checkPermission(ctx, u, h.perm, nil); err != nil {
+			return err
+		}
+		return h.f(w, r, ctx, u)
+	}).ServeHTTP(w, r)
+}
+
+// checkPermission returns Forbidden if the user doesn't have the permission,
+// on the given conference for the permissions on conferences.
+// The administrators of the application have all the permissions.
+func checkPermission(ctx appengine.Context, u *identity.Identity, p conf.Permission, c *conf.Conference) error {
+	if u.Admin {
+		return nil
+	}
+	ok, err := conf.Can(ctx, u.Email, p, c)
+	if err != nil {
+		return fmt.Errorf("check permission: %v", err)
+	}
+	if !ok {
+		return Forbidden(fmt.Sprintf("%v is not allowed to %v", u.Email, p))
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package conf
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"appengine"
+	"appengine/urlfetch"
+
+	"github.com/campoy/goconf/pkg/csrf"
+	"github.com/campoy/goconf/pkg/identity"
+	"github.com/campoy/goconf/pkg/session"
+)
+
+// sessions are the sessions of the users, which keep them signed in with the
+// oidc and dev providers, and which their CSRF tokens belong to. They're kept
+// in the datastore and their cookies are encrypted with the keys in the
+// SESSION_KEYS environment variable: base64 encoded AES keys separated by
+// spaces, the newest first. Outside the development server their cookies are
+// only sent over HTTPS.
+var sessions = &session.Manager{
+	Keys:   envKeys("SESSION_KEYS"),
+	Store:  requestStore{session.Datastore{}},
+	Secure: !appengine.IsDevAppServer(),
+}
+
+// protector protects the requests of the users against cross-site request
+// forgery, with tokens belonging to their sessions.
+var protector = &csrf.Protector{Sessions: sessions}
+
+// authenticator identifies the users of the application. The provider is
+// chosen with the IDENTITY_PROVIDER environment variable set in app.yaml:
+// "appengine", the default, "oidc" or "dev".
+var authenticator = newAuthenticator()
+
+func init() {
+	if h, ok := authenticator.(http.Handler); ok {
+		http.Handle(identity.Prefix, h)
+	}
+	http.Handle("/deletesessions", handler(deleteSessionsHandler))
+}
+
+func newAuthenticator() identity.Authenticator {
+	p := os.Getenv("IDENTITY_PROVIDER")
+	if p == "" || p == "appengine" {
+		return identity.AppEngine{}
+	}
+
+	store := &identity.SessionStore{Sessions: sessions}
+
+	switch p {
+	case "oidc":
+		return &identity.OIDC{
+			Issuer:       os.Getenv("OIDC_ISSUER"),
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+			Admins:       strings.Fields(os.Getenv("OIDC_ADMINS")),
+			TrustEmails:  os.Getenv("OIDC_TRUST_EMAILS") == "true",
+			Key:          []byte(os.Getenv("IDENTITY_KEY")),
+			Store:        store,
+			Client: func(r *http.Request) *http.Client {
+				return urlfetch.Client(appengine.NewContext(r))
+			},
+		}
+	case "dev":
+		if !appengine.IsDevAppServer() {
+			panic("IDENTITY_PROVIDER dev is only allowed in the development server")
+		}
+		return &identity.Dev{Store: store}
+	default:
+		panic("unknown IDENTITY_PROVIDER " + p)
+	}
+}
+
+// envKeys returns the keys in the environment variable with the given name:
+// base64 encoded keys separated by spaces.
+func envKeys(name string) [][]byte {
+	var keys [][]byte
+	for _, v := range strings.Fields(os.Getenv(name)) {
+		k, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			panic(fmt.Sprintf("bad key in %v: %v", name, err))
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// touchSession extends the session of the request, if it has one.
+func touchSession(w http.ResponseWriter, r *http.Request) error {
+	return sessions.Touch(w, r)
+}
+
+// deleteSessionsHandler deletes the sessions not seen for longer than the idle
+// timeout, which have expired. It's run by cron.
+func deleteSessionsHandler(w io.Writer, r *http.Request) error {
+	ctx := appengine.NewContext(r)
+	n, err := session.DeleteExpired(ctx, time.Now().Add(-session.DefaultIdleTimeout))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "deleted %v sessions", n)
+	return nil
+}
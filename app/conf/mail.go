@@ -0,0 +1,102 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package conf
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"appengine"
+
+	"github.com/campoy/goconf/pkg/conf"
+)
+
+// incomingMailPath is the path App Engine posts incoming email to, followed
+// by the address the email was sent to.
+const incomingMailPath = "/_ah/mail/"
+
+// mailDomain returns the domain the application receives email on.
+func mailDomain(ctx appengine.Context) string {
+	return appengine.AppID(ctx) + ".appspotmail.com"
+}
+
+// incomingMailHandler threads the replies of organizers to the conversation of
+// the conference their reply-to address belongs to.
+func incomingMailHandler(w io.Writer, r *http.Request) error {
+	ctx := appengine.NewContext(r)
+	msg, err := mail.ReadMessage(r.Body)
+	if err != nil {
+		return fmt.Errorf("read message: %v", err)
+	}
+
+	to := strings.TrimPrefix(r.URL.Path, incomingMailPath)
+	from := msg.Header.Get("From")
+	c, err := conf.ConferenceForReply(ctx, to, from)
+	if err != nil {
+		// Retrying won't help, drop the message.
+		ctx.Warningf("dropping mail from %q to %q: %v", from, to, err)
+		return nil
+	}
+
+	body, err := textBody(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		return fmt.Errorf("read body: %v", err)
+	}
+
+	return c.AddMessage(ctx, &conf.Message{
+		From:    from,
+		To:      to,
+		Subject: msg.Header.Get("Subject"),
+		Body:    body,
+		Time:    time.Now(),
+	})
+}
+
+// textBody returns the plain text contained in a MIME body with the given
+// content type and transfer encoding. For multipart bodies the first text/plain
+// part is used.
+func textBody(contentType, encoding string, body io.Reader) (string, error) {
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("bad content type %q: %v", contentType, err)
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				return "", fmt.Errorf("no text part found")
+			}
+			if err != nil {
+				return "", err
+			}
+			text, err := textBody(p.Header.Get("Content-Type"), p.Header.Get("Content-Transfer-Encoding"), p)
+			if err == nil {
+				return text, nil
+			}
+		}
+	}
+	if mediaType != "text/plain" {
+		return "", fmt.Errorf("unsupported content type %q", mediaType)
+	}
+
+	if strings.EqualFold(encoding, "quoted-printable") {
+		body = quotedprintable.NewReader(body)
+	}
+	b, err := ioutil.ReadAll(body)
+	return string(b), err
+}
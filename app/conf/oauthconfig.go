@@ -5,23 +5,47 @@
 package conf
 
 import (
+	"context"
+	"net/http"
+
 	"appengine"
 
-	"code.google.com/p/goauth2/oauth"
+	"github.com/campoy/goconf/pkg/auth"
 )
 
-func config(scope string) *oauth.Config {
-	redirect := "https://go-conf.appspot.com/oauth2callback"
-	if appengine.IsDevAppServer() {
-		redirect = "http://localhost:8080/oauth2callback"
+var google = auth.Google(
+	"client-id: you should change this",
+	"client-secret: change this too",
+	redirectURL(),
+)
+
+func init() {
+	// The tokens are encrypted with the keys in the TOKEN_KEYS environment
+	// variable: base64 encoded AES keys separated by spaces, the newest first.
+	auth.DefaultManager.Tokens = &auth.TokenStore{
+		Backend: auth.DatastoreBackend{},
+		Keys:    envKeys("TOKEN_KEYS"),
+	}
+	auth.DefaultManager.Wrap = trackRequests
+	auth.DefaultManager.UserID = func(r *http.Request) string {
+		if u := currentUser(r); u != nil {
+			return u.Email
+		}
+		return ""
 	}
+	auth.DefaultManager.Context = func(r *http.Request) context.Context {
+		return oauth2Context(appengine.NewContext(r))
+	}
+}
 
-	return &oauth.Config{
-		ClientId:     "client-id: you should change this",
-		ClientSecret: "client-secret: change this too",
-		Scope:        scope,
-		AuthURL:      "https://accounts.google.com/o/oauth2/auth",
-		TokenURL:     "https://accounts.google.com/o/oauth2/token",
-		RedirectURL:  redirect,
+// oauth2Context returns the context to access the tokens of the users and to
+// make the requests to the providers and their APIs. The tests replace it to
+// talk to a fake provider.
+var oauth2Context = auth.NewContext
+
+func redirectURL() string {
+	if appengine.IsDevAppServer() {
+		return "http://localhost:8080" + auth.CallbackPath
 	}
+	return "https://go-conf.appspot.com" + auth.CallbackPath
 }
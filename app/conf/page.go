@@ -1,12 +1,14 @@
 package conf
 
 import (
+	"fmt"
 	"io"
+	"net/http"
 
 	"appengine"
-	"appengine/user"
 
 	"github.com/campoy/goconf/pkg/conf"
+	"github.com/campoy/goconf/pkg/identity"
 	"github.com/campoy/goconf/pkg/tmpl"
 )
 
@@ -15,23 +17,32 @@ type Page struct {
 	Content string      // Name of the embedded template
 	Data    interface{} // Data for the embedded template
 
-	User         *user.User
+	User         *identity.Identity
 	LogoutURL    string
 	LoginURL     string
 	Topics       []string
 	Cities       []string
 	Announcement string
+	TimeZone     string // time zone chosen by the user, UTC if empty
+	CSRFToken    string // token to send in the forms, see csrfField
 }
 
 // NewPage returns a new Page initialized embedding the template with the
-// given name and data, the current user for the given context, and the
-// latest announcement.
-func NewPage(ctx appengine.Context, name string, data interface{}) (*Page, error) {
+// given name and data, the user making the request, and the latest
+// announcement.
+func NewPage(ctx appengine.Context, r *http.Request, name string, data interface{}) (*Page, error) {
 	p := &Page{
-		Content: name,
-		Data:    data,
-		Topics:  topicList,
-		Cities:  cityList,
+		Content:   name,
+		Data:      data,
+		CSRFToken: protector.Token(r),
+	}
+
+	var err error
+	if p.Topics, err = conf.ActiveTerms(ctx, conf.TopicKind); err != nil {
+		return nil, fmt.Errorf("load topics: %v", err)
+	}
+	if p.Cities, err = conf.ActiveTerms(ctx, conf.CityKind); err != nil {
+		return nil, fmt.Errorf("load cities: %v", err)
 	}
 
 	a, err := conf.LatestAnnouncement(ctx)
@@ -42,11 +53,14 @@ func NewPage(ctx appengine.Context, name string, data interface{}) (*Page, error
 		p.Announcement = a.Message
 	}
 
-	if u := user.Current(ctx); u != nil {
+	if u := currentUser(r); u != nil {
 		p.User = u
-		p.LogoutURL, err = user.LogoutURL(ctx, "/")
+		if p.TimeZone, err = userTimeZone(ctx, r, u.Email); err != nil {
+			ctx.Errorf("user time zone: %v", err)
+		}
+		p.LogoutURL, err = authenticator.LogoutURL(r, "/")
 	} else {
-		p.LoginURL, err = user.LoginURL(ctx, "/")
+		p.LoginURL, err = authenticator.LoginURL(r, "/")
 	}
 
 	return p, err
@@ -0,0 +1,81 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package conf
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Page sizes of the paginated listings, which can be chosen with the
+// page_size parameter.
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pageSize returns the page size requested with the page_size parameter.
+func pageSize(r *http.Request) int {
+	n, err := strconv.Atoi(r.FormValue("page_size"))
+	if err != nil || n <= 0 {
+		return defaultPageSize
+	}
+	if n > maxPageSize {
+		return maxPageSize
+	}
+	return n
+}
+
+// A pager contains the links to the pages next to the current one, and to
+// the first one, in a paginated listing. The current page starts at the
+// cursor parameter.
+//
+// Datastore cursors only move forward, so the cursor of the previous page is
+// carried in the prev parameter. Only the previous page is linked: the
+// cursors of the pages before it are not kept, so the URLs don't grow with
+// every page.
+type pager struct {
+	FirstURL string
+	PrevURL  string
+	NextURL  string
+	Sizes    []int
+	Size     int
+}
+
+// newPager returns the pager for the listing at path given the request for the
+// current page and the cursor of the next page, empty if there's none.
+func newPager(r *http.Request, path, next string) *pager {
+	p := &pager{Sizes: []int{10, 20, 50, 100}, Size: pageSize(r)}
+
+	cur, prev := r.FormValue("cursor"), r.FormValue("prev")
+	if len(next) > 0 {
+		q := copyValues(r.Form)
+		q.Set("cursor", next)
+		q.Set("prev", cur)
+		p.NextURL = path + "?" + q.Encode()
+	}
+	if len(cur) > 0 {
+		q := copyValues(r.Form)
+		q.Del("cursor")
+		q.Del("prev")
+		p.FirstURL = path + "?" + q.Encode()
+	}
+	if len(prev) > 0 {
+		q := copyValues(r.Form)
+		q.Set("cursor", prev)
+		q.Del("prev")
+		p.PrevURL = path + "?" + q.Encode()
+	}
+	return p
+}
+
+func copyValues(v url.Values) url.Values {
+	c := make(url.Values, len(v))
+	for k, vs := range v {
+		c[k] = vs
+	}
+	return c
+}
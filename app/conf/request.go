@@ -0,0 +1,171 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package conf
+
+import (
+	"net/http"
+	"sync"
+
+	"appengine"
+
+	"github.com/campoy/goconf/pkg/conf"
+	"github.com/campoy/goconf/pkg/identity"
+	"github.com/campoy/goconf/pkg/session"
+)
+
+// requests keeps what was loaded while serving each request tracked by
+// trackRequest, so it's loaded once per request. App Engine identifies the
+// requests by their pointer, so the state can't be kept in their context.
+var requests = struct {
+	sync.Mutex
+	m map[*http.Request]*requestState
+}{m: make(map[*http.Request]*requestState)}
+
+// requestState is what was loaded while serving a request. The fields are
+// guarded by mu, since a request can be served by several goroutines, but
+// it isn't held while loading them.
+type requestState struct {
+	mu         sync.Mutex
+	user       *identity.Identity // making the request, nil if not signed in
+	userLoaded bool               // whether user was loaded
+	session    *session.Session   // last loaded or saved by requestStore
+	profile    *conf.UserProfile  // of the user making the request, with the tickets
+}
+
+// trackRequest keeps the state of the request until the returned function is
+// called, once the request is served. Nested calls share the state of the
+// outermost one, whose function forgets it.
+func trackRequest(r *http.Request) (forget func()) {
+	requests.Lock()
+	defer requests.Unlock()
+	if _, ok := requests.m[r]; ok {
+		return func() {}
+	}
+	requests.m[r] = &requestState{}
+	return func() {
+		requests.Lock()
+		delete(requests.m, r)
+		requests.Unlock()
+	}
+}
+
+// trackRequests returns a handler serving the requests with h, keeping their
+// state while they're served.
+func trackRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer trackRequest(r)()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// stateOf returns the state of the request. The requests that aren't tracked
+// get a new one every time, so nothing is kept for them.
+func stateOf(r *http.Request) *requestState {
+	requests.Lock()
+	defer requests.Unlock()
+	if s, ok := requests.m[r]; ok {
+		return s
+	}
+	return &requestState{}
+}
+
+// currentUser returns the user making the request, nil if not signed in.
+func currentUser(r *http.Request) *identity.Identity {
+	s := stateOf(r)
+	s.mu.Lock()
+	u, ok := s.user, s.userLoaded
+	s.mu.Unlock()
+	if ok {
+		return u
+	}
+	u, err := authenticator.Current(r)
+	if err != nil {
+		appengine.NewContext(r).Errorf("current user: %v", err)
+		u = nil
+	}
+	s.mu.Lock()
+	s.user, s.userLoaded = u, true
+	s.mu.Unlock()
+	return u
+}
+
+// userProfile loads the profile of the user with the given email, who makes
+// the request, keeping it for the rest of the request.
+func userProfile(ctx appengine.Context, r *http.Request, email string) (*conf.UserProfile, error) {
+	s := stateOf(r)
+	s.mu.Lock()
+	up := s.profile
+	s.mu.Unlock()
+	if up != nil && up.MainEmail == email {
+		return up, nil
+	}
+	up, err := conf.LoadUserProfile(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.profile = up
+	s.mu.Unlock()
+	return up, nil
+}
+
+// userTimeZone returns the time zone chosen by the user with the given email,
+// who makes the request, from the profile if it was loaded already.
+func userTimeZone(ctx appengine.Context, r *http.Request, email string) (string, error) {
+	s := stateOf(r)
+	s.mu.Lock()
+	up := s.profile
+	s.mu.Unlock()
+	if up != nil && up.MainEmail == email {
+		return up.TimeZone, nil
+	}
+	return conf.UserTimeZone(ctx, email)
+}
+
+// requestStore is a session.Store keeping the last session it loaded or
+// saved in the state of the request, so the session is loaded once per
+// request even if it's read to identify the user and again to touch it.
+type requestStore struct {
+	session.Store
+}
+
+func (s requestStore) Get(r *http.Request, id string) (*session.Session, error) {
+	st := stateOf(r)
+	st.mu.Lock()
+	sess := st.session
+	st.mu.Unlock()
+	if sess != nil && sess.ID == id {
+		return sess, nil
+	}
+	sess, err := s.Store.Get(r, id)
+	if err != nil || sess == nil {
+		return sess, err
+	}
+	st.mu.Lock()
+	st.session = sess
+	st.mu.Unlock()
+	return sess, nil
+}
+
+func (s requestStore) Put(r *http.Request, sess *session.Session) error {
+	if err := s.Store.Put(r, sess); err != nil {
+		return err
+	}
+	st := stateOf(r)
+	st.mu.Lock()
+	st.session = sess
+	st.mu.Unlock()
+	return nil
+}
+
+func (s requestStore) Delete(r *http.Request, id string) error {
+	st := stateOf(r)
+	st.mu.Lock()
+	if st.session != nil && st.session.ID == id {
+		st.session = nil
+	}
+	st.mu.Unlock()
+	return s.Store.Delete(r, id)
+}
@@ -0,0 +1,52 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package conf
+
+import (
+	"context"
+	"net/http"
+
+	"appengine"
+
+	"google.golang.org/grpc"
+
+	"github.com/campoy/goconf/pkg/confrpc"
+	confpb "github.com/campoy/goconf/proto"
+)
+
+// rpcServer serves the ConferenceService gRPC service under the path of the
+// service. gRPC needs HTTP/2 from the client to the application, so it's
+// only reachable where the front end forwards it.
+//
+// The calls authenticate as the web requests do, with the session cookie
+// or the App Engine users service. They aren't checked for CSRF tokens:
+// browsers can't send the application/grpc requests the server accepts
+// without a CORS preflight.
+var rpcServer = grpc.NewServer()
+
+func init() {
+	confpb.RegisterConferenceServiceServer(rpcServer, &confrpc.Server{
+		Backend: confrpc.DatastoreBackend{
+			Context:  rpcContext,
+			Schedule: scheduleConf,
+		},
+		Authenticator: authenticator,
+		Errorf: func(ctx context.Context, format string, args ...interface{}) {
+			rpcContext(ctx).Errorf(format, args...)
+		},
+	})
+	http.HandleFunc("/"+confpb.ConferenceService_ServiceDesc.ServiceName+"/", rpcServeHTTP)
+}
+
+// rpcContext returns the App Engine context of a call.
+func rpcContext(ctx context.Context) appengine.Context {
+	return appengine.NewContext(confrpc.Request(ctx))
+}
+
+// rpcServeHTTP serves a gRPC call, keeping the request in the context of the
+// call so the App Engine context and the user are taken from it.
+func rpcServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rpcServer.ServeHTTP(w, r.WithContext(confrpc.NewContext(r.Context(), r)))
+}
@@ -0,0 +1,76 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build appengine
+// +build appengine
+
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"appengine"
+	"appengine/datastore"
+	"appengine/urlfetch"
+)
+
+// TokenKind is the datastore kind of the tokens kept by DatastoreBackend.
+const TokenKind = "OAuthToken"
+
+// appEngineKey is the context key of the App Engine context.
+type appEngineKey int
+
+// NewContext returns a context carrying the App Engine context, used by
+// DatastoreBackend, and making the requests to the oauth2 providers with
+// urlfetch.
+func NewContext(c appengine.Context) context.Context {
+	ctx := context.WithValue(context.Background(), appEngineKey(0), c)
+	return WithTransport(ctx, &urlfetch.Transport{Context: c})
+}
+
+func appEngineContext(ctx context.Context) (appengine.Context, error) {
+	c, ok := ctx.Value(appEngineKey(0)).(appengine.Context)
+	if !ok {
+		return nil, fmt.Errorf("no App Engine context, use NewContext")
+	}
+	return c, nil
+}
+
+// DatastoreBackend keeps the tokens in the App Engine datastore.
+type DatastoreBackend struct{}
+
+type storedToken struct {
+	Data []byte `datastore:",noindex"`
+}
+
+func (DatastoreBackend) Get(ctx context.Context, key string) ([]byte, error) {
+	c, err := appEngineContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var t storedToken
+	err = datastore.Get(c, datastore.NewKey(c, TokenKind, key, 0, nil), &t)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, nil
+	}
+	return t.Data, err
+}
+
+func (DatastoreBackend) Put(ctx context.Context, key string, data []byte) error {
+	c, err := appEngineContext(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = datastore.Put(c, datastore.NewKey(c, TokenKind, key, 0, nil), &storedToken{data})
+	return err
+}
+
+func (DatastoreBackend) Delete(ctx context.Context, key string) error {
+	c, err := appEngineContext(ctx)
+	if err != nil {
+		return err
+	}
+	return datastore.Delete(c, datastore.NewKey(c, TokenKind, key, 0, nil))
+}
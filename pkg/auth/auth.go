@@ -5,86 +5,109 @@
 // The auth package provides support for oauth2-authenticated
 // HTTP handlers. Specially when multiple authentication configurations
 // are needed.
+//
+// Each handler is registered with the Provider and scopes it needs. When a
+// user without a token with those scopes makes a request to the handler, the
+// user is sent to the consent page of the provider, asking only for the
+// missing scopes if the provider supports it, and back to the handler once
+// they're granted.
+//
+// The handlers are registered on a Manager, which serves the callback of the
+// authentication server. The package level functions use DefaultManager,
+// which is served on http.DefaultServeMux.
+//
+// The tokens obtained are kept in a TokenStore, so they can be used to make
+// requests on behalf of the users later, outside the callback request. They
+// are refreshed automatically when they expire.
+//
+// The package is built on golang.org/x/oauth2: the authorization code flow
+// uses PKCE, Client and TokenSource take a context, and programs without a
+// browser can get tokens with the device authorization flow.
 package auth
 
 import (
-	"fmt"
+	"context"
 	"net/http"
-	"net/url"
-	"sync"
 
-	"code.google.com/p/goauth2/oauth"
+	"golang.org/x/oauth2"
 )
 
-// CallbackPath is the path that the RedirectURL field in the config file should have.
+// CallbackPath is the path that the RedirectURL field of the providers should have.
 // If they differ, Handle and HandleFunc will return an error.
 const CallbackPath = "/oauth2callback"
 
-var (
-	mutex    sync.RWMutex
-	handlers = make(map[string]http.HandlerFunc)
-)
+// DefaultManager is the Manager used by the package level functions. Its
+// Tokens and UserID must be set before serving requests.
+var DefaultManager = NewManager(CallbackPath)
+
+// transportKey is the context key of the transport set by WithTransport.
+type transportKey int
+
+// WithTransport returns a context in which the requests to the oauth2
+// providers are made with the given transport.
+func WithTransport(ctx context.Context, t http.RoundTripper) context.Context {
+	return context.WithValue(ctx, transportKey(0), t)
+}
+
+// httpClient returns a client making the requests with the transport of the
+// context, http.DefaultTransport if it has none.
+func httpClient(ctx context.Context) *http.Client {
+	if t, ok := ctx.Value(transportKey(0)).(http.RoundTripper); ok {
+		return &http.Client{Transport: t}
+	}
+	return http.DefaultClient
+}
+
+// oauth2Context returns a context in which the oauth2 package makes the
+// requests to the providers with the transport of ctx.
+func oauth2Context(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, httpClient(ctx))
+}
 
 func init() {
-	http.HandleFunc(CallbackPath, callback)
+	http.Handle(CallbackPath, DefaultManager)
 }
 
 // Handle register the passed http.Handler to be executed when
-// a request matches path. The handler will receive the oauth2
-// code corresponding to the passed oauth.Config as form values.
-func Handle(path string, h http.Handler, cfg *oauth.Config) error {
-	return HandleFunc(path, h.ServeHTTP, cfg)
+// a request matches path, once the user has granted the scopes
+// on the provider.
+// It's registered on DefaultManager, which serves path on http.DefaultServeMux.
+func Handle(path string, h http.Handler, p *Provider, scopes ...string) error {
+	return HandleFunc(path, h.ServeHTTP, p, scopes...)
 }
 
 // Handle register the passed http.HandleFunc to be executed when
-// a request matches path. The HandleFunc will receive the oauth2
-// code corresponding to the passed oauth.Config as form values.
-func HandleFunc(path string, h http.HandlerFunc, cfg *oauth.Config) error {
-	mutex.Lock()
-	defer mutex.Unlock()
-
-	u, err := url.Parse(cfg.RedirectURL)
-	if err != nil {
-		return fmt.Errorf("bad redirect URL: %v", err)
-	}
-	if u.Path != CallbackPath {
-		return fmt.Errorf("RedirectURL has to point to %q, it points to %q", CallbackPath, u.Path)
+// a request matches path, once the user has granted the scopes
+// on the provider.
+// It's registered on DefaultManager, which serves path on http.DefaultServeMux.
+func HandleFunc(path string, h http.HandlerFunc, p *Provider, scopes ...string) error {
+	if err := DefaultManager.HandleFunc(path, h, p, scopes...); err != nil {
+		return err
 	}
-
-	handlers[path] = h
-	rh := http.RedirectHandler(cfg.AuthCodeURL(path), http.StatusFound)
-	http.Handle(path, rh)
+	http.Handle(path, DefaultManager)
 	return nil
 }
 
-// Client creates an authenticated http.Client given an http.Request
-// containing an oauth code.
-func Client(r *http.Request, transport http.RoundTripper, cfg *oauth.Config) (*http.Client, error) {
-	if errp := r.FormValue("error"); len(errp) > 0 {
-		return nil, fmt.Errorf("error in oauth2 response: %q", errp)
-	}
-	t := &oauth.Transport{
-		Config:    cfg,
-		Transport: transport,
-	}
-	_, err := t.Exchange(r.FormValue("code"))
-	if err != nil {
-		return nil, err
-	}
-	return t.Client(), nil
+// Client creates an authenticated http.Client for the provider with the
+// token of the user saved by DefaultManager. See Manager.Client.
+func Client(ctx context.Context, userID string, p *Provider, scopes ...string) (*http.Client, error) {
+	return DefaultManager.Client(ctx, userID, p, scopes...)
 }
 
-// callback handles the response from the authentication server and redirects
-// it to the corresponding handler.
-func callback(w http.ResponseWriter, r *http.Request) {
-	mutex.RLock()
-	defer mutex.RUnlock()
-
-	state := r.FormValue("state")
-	h, ok := handlers[state]
-	if !ok {
-		http.Error(w, "unexpected state "+state, http.StatusBadRequest)
-		return
-	}
-	h(w, r)
+// TokenSource returns the tokens of the user for the provider saved by
+// DefaultManager. See Manager.TokenSource.
+func TokenSource(ctx context.Context, userID string, p *Provider, scopes ...string) (oauth2.TokenSource, error) {
+	return DefaultManager.TokenSource(ctx, userID, p, scopes...)
+}
+
+// DeviceAuth starts the device authorization flow on DefaultManager. See
+// Manager.DeviceAuth.
+func DeviceAuth(ctx context.Context, p *Provider, scopes ...string) (*oauth2.DeviceAuthResponse, error) {
+	return DefaultManager.DeviceAuth(ctx, p, scopes...)
+}
+
+// WaitDevice completes the device authorization flow on DefaultManager. See
+// Manager.WaitDevice.
+func WaitDevice(ctx context.Context, userID string, p *Provider, da *oauth2.DeviceAuthResponse, scopes ...string) error {
+	return DefaultManager.WaitDevice(ctx, userID, p, da, scopes...)
 }
@@ -0,0 +1,562 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package authtest provides a fake OAuth2 and OpenID Connect authorization
+// server, so the code using the auth and identity packages can be tested
+// offline.
+//
+// The Server runs on a local httptest.Server. Its signed in user grants every
+// authorization immediately, and the tests can make the next request to an
+// endpoint fail with FailNext. The endpoints have the paths of the Google
+// ones, so the code using Google endpoints talks to the Server when its
+// requests are made with Transport.
+//
+// The clients only refresh the access tokens that they see expired, which
+// golang.org/x/oauth2 does ten seconds before the expiry the Server sends, so
+// a TokenLifetime of a few seconds makes them refresh the tokens every time
+// they're used. ExpireTokens instead makes the Server reject the tokens it
+// issued while the clients still take them for valid, as providers do with
+// the tokens they revoke.
+package authtest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/campoy/goconf/pkg/auth"
+	"golang.org/x/oauth2"
+)
+
+// The paths of the endpoints of the Server.
+const (
+	DiscoveryPath = "/.well-known/openid-configuration"
+	AuthorizePath = "/o/oauth2/auth"
+	TokenPath     = "/token"
+	DevicePath    = "/device/code"
+	UserInfoPath  = "/v1/userinfo"
+	JWKSPath      = "/oauth2/v3/certs"
+	LogoutPath    = "/logout"
+)
+
+// The lifetimes of the codes issued by the Server.
+const (
+	codeLifetime   = 10 * time.Minute
+	deviceLifetime = 10 * time.Minute
+)
+
+// A User is a user of the Server.
+type User struct {
+	Subject string
+	Email   string
+	Name    string
+}
+
+// A Server is a fake authorization server. Its URL is its issuer.
+type Server struct {
+	*httptest.Server
+	// ClientID and ClientSecret are the credentials of the only client.
+	ClientID     string
+	ClientSecret string
+	// User is the user signed in on the server, who grants every
+	// authorization.
+	User User
+	// TokenLifetime is the time the access tokens are valid for, at least a
+	// second. The clients refresh the tokens that expire in less than ten
+	// seconds.
+	TokenLifetime time.Duration
+	// ScopeSeparator separates the scopes in the token responses. It's a
+	// space if empty, as in the specification, but GitHub uses commas.
+	ScopeSeparator string
+	// IDTokenClaims, if not nil, edits the claims of the ID tokens before
+	// they're signed, to test how the clients check them.
+	IDTokenClaims func(claims map[string]interface{})
+
+	key *rsa.PrivateKey
+	kid string
+	mux *http.ServeMux
+
+	mu       sync.Mutex
+	codes    map[string]*grant   // by authorization code
+	access   map[string]*grant   // by access token
+	refresh  map[string]*grant   // by refresh token
+	devices  map[string]*device  // by device code
+	granted  map[string][]string // scopes granted by each user, by subject
+	failures map[string][]string // error codes of the next requests, by path
+}
+
+// grant is an authorization of a user, kept for its code or tokens.
+type grant struct {
+	user      User
+	scopes    []string
+	redirect  string // redirect URI the code was issued for
+	challenge string // PKCE challenge of the code
+	nonce     string
+	expires   time.Time
+}
+
+// device is a device authorization, granted once approved.
+type device struct {
+	userCode string
+	scopes   []string
+	user     *User
+	expires  time.Time
+}
+
+// NewServer starts and returns a Server, with "client" and "secret" as the
+// client credentials, test@example.com as its user and an hour as the
+// lifetime of the tokens. It should be closed when done.
+func NewServer() *Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(fmt.Sprintf("authtest: generate key: %v", err))
+	}
+	s := &Server{
+		ClientID:      "client",
+		ClientSecret:  "secret",
+		User:          User{Subject: "1", Email: "test@example.com", Name: "Test User"},
+		TokenLifetime: time.Hour,
+		key:           key,
+		kid:           randomString(8),
+		mux:           http.NewServeMux(),
+		codes:         make(map[string]*grant),
+		access:        make(map[string]*grant),
+		refresh:       make(map[string]*grant),
+		devices:       make(map[string]*device),
+		granted:       make(map[string][]string),
+		failures:      make(map[string][]string),
+	}
+	s.mux.HandleFunc(DiscoveryPath, s.discovery)
+	s.mux.HandleFunc(AuthorizePath, s.authorize)
+	s.mux.HandleFunc(TokenPath, s.token)
+	s.mux.HandleFunc(DevicePath, s.device)
+	s.mux.HandleFunc(UserInfoPath, s.userInfo)
+	s.mux.HandleFunc(JWKSPath, s.jwks)
+	s.mux.HandleFunc(LogoutPath, s.logout)
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Provider returns an auth.Provider with the given name for the Server.
+// Like Google, it adds the scopes already granted to the new tokens. The
+// client credentials are sent in the Authorization header, so a failure of
+// the token endpoint isn't retried with them in the body.
+func (s *Server) Provider(name, redirectURL string) *auth.Provider {
+	return &auth.Provider{
+		Name: name,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:       s.URL + AuthorizePath,
+			TokenURL:      s.URL + TokenPath,
+			DeviceAuthURL: s.URL + DevicePath,
+			AuthStyle:     oauth2.AuthStyleInHeader,
+		},
+		ClientID:     s.ClientID,
+		ClientSecret: s.ClientSecret,
+		RedirectURL:  redirectURL,
+		Incremental:  true,
+	}
+}
+
+// Transport returns an http.RoundTripper sending every request to the
+// Server, whatever its host.
+func (s *Server) Transport() http.RoundTripper {
+	return roundTripper(func(r *http.Request) (*http.Response, error) {
+		r = r.Clone(r.Context())
+		r.URL.Scheme = "http"
+		r.URL.Host = s.Listener.Addr().String()
+		r.Host = ""
+		return s.Client().Transport.RoundTrip(r)
+	})
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// Resource serves h on path to the requests with an access token issued by
+// the Server with the given scopes, like the APIs of a provider do.
+func (s *Server) Resource(path string, h http.Handler, scopes ...string) {
+	s.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		g, code := s.bearer(r)
+		if g == nil {
+			writeError(w, code)
+			return
+		}
+		if len(missing(g.scopes, scopes)) > 0 {
+			writeError(w, "insufficient_scope")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// FailNext makes the next request to the endpoint or resource on path fail
+// with the given OAuth2 error code, such as "access_denied",
+// "invalid_grant" or "server_error". The authorization endpoint redirects
+// the user back with the error, the other ones respond with it.
+func (s *Server) FailNext(path, code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[path] = append(s.failures[path], code)
+}
+
+// ExpireTokens makes the access tokens issued so far expire, so the
+// resources reject them with invalid_token. The clients aren't told, so
+// they keep using them until their own expiry: to test refreshes, use a
+// short TokenLifetime instead.
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, g := range s.access {
+		g.expires = time.Now().Add(-time.Second)
+	}
+}
+
+// ApproveDevice approves the device authorization with the given user code
+// as the signed in user.
+func (s *Server) ApproveDevice(userCode string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range s.devices {
+		if d.userCode == userCode {
+			u := s.User
+			d.user = &u
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown user code %q", userCode)
+}
+
+// Granted returns the scopes granted by the user with the given subject.
+func (s *Server) Granted(subject string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.granted[subject]...)
+}
+
+// serve serves the request, failing it if FailNext asked to.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	var code string
+	if f := s.failures[r.URL.Path]; len(f) > 0 {
+		code, s.failures[r.URL.Path] = f[0], f[1:]
+	}
+	s.mu.Unlock()
+	if len(code) == 0 {
+		s.mux.ServeHTTP(w, r)
+		return
+	}
+	if r.URL.Path == AuthorizePath {
+		redirectError(w, r, code)
+		return
+	}
+	writeError(w, code)
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.URL,
+		"authorization_endpoint":                s.URL + AuthorizePath,
+		"token_endpoint":                        s.URL + TokenPath,
+		"device_authorization_endpoint":         s.URL + DevicePath,
+		"userinfo_endpoint":                     s.URL + UserInfoPath,
+		"jwks_uri":                              s.URL + JWKSPath,
+		"end_session_endpoint":                  s.URL + LogoutPath,
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+// authorize grants the authorization as the signed in user, redirecting
+// back with a code.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != s.ClientID {
+		http.Error(w, "unknown client", http.StatusBadRequest)
+		return
+	}
+	if _, err := url.Parse(q.Get("redirect_uri")); err != nil || len(q.Get("redirect_uri")) == 0 {
+		http.Error(w, "bad redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if q.Get("response_type") != "code" {
+		redirectError(w, r, "unsupported_response_type")
+		return
+	}
+	if m := q.Get("code_challenge_method"); len(m) > 0 && m != "S256" {
+		redirectError(w, r, "invalid_request")
+		return
+	}
+
+	s.mu.Lock()
+	scopes := strings.Fields(q.Get("scope"))
+	sub := s.User.Subject
+	s.granted[sub] = union(s.granted[sub], scopes)
+	if q.Get("include_granted_scopes") == "true" {
+		scopes = s.granted[sub]
+	}
+	code := randomString(16)
+	s.codes[code] = &grant{
+		user:      s.User,
+		scopes:    scopes,
+		redirect:  q.Get("redirect_uri"),
+		challenge: q.Get("code_challenge"),
+		nonce:     q.Get("nonce"),
+		expires:   time.Now().Add(codeLifetime),
+	}
+	s.mu.Unlock()
+
+	redirect(w, r, url.Values{"code": {code}, "state": {q.Get("state")}})
+}
+
+// token issues tokens for codes, refresh tokens and approved devices.
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, "invalid_request")
+		return
+	}
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if id != s.ClientID || secret != s.ClientSecret {
+		writeError(w, "invalid_client")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.PostFormValue("grant_type") {
+	case "authorization_code":
+		code := r.PostFormValue("code")
+		g, ok := s.codes[code]
+		delete(s.codes, code)
+		switch {
+		case !ok, time.Now().After(g.expires), r.PostFormValue("redirect_uri") != g.redirect:
+			writeError(w, "invalid_grant")
+		case len(g.challenge) > 0 && oauth2.S256ChallengeFromVerifier(r.PostFormValue("code_verifier")) != g.challenge:
+			writeError(w, "invalid_grant")
+		default:
+			s.issue(w, g, true)
+		}
+	case "refresh_token":
+		g, ok := s.refresh[r.PostFormValue("refresh_token")]
+		if !ok {
+			writeError(w, "invalid_grant")
+			return
+		}
+		s.issue(w, &grant{user: g.user, scopes: g.scopes}, false)
+	case "urn:ietf:params:oauth:grant-type:device_code":
+		code := r.PostFormValue("device_code")
+		d, ok := s.devices[code]
+		switch {
+		case !ok:
+			writeError(w, "invalid_grant")
+		case time.Now().After(d.expires):
+			delete(s.devices, code)
+			writeError(w, "expired_token")
+		case d.user == nil:
+			writeError(w, "authorization_pending")
+		default:
+			delete(s.devices, code)
+			s.granted[d.user.Subject] = union(s.granted[d.user.Subject], d.scopes)
+			s.issue(w, &grant{user: *d.user, scopes: d.scopes}, true)
+		}
+	default:
+		writeError(w, "unsupported_grant_type")
+	}
+}
+
+// issue responds with a new access token for the grant, and a refresh token
+// if asked for. Like Google, a refresh doesn't issue a new refresh token.
+// It must be called with s.mu held.
+func (s *Server) issue(w http.ResponseWriter, g *grant, withRefresh bool) {
+	now := time.Now()
+	at := &grant{user: g.user, scopes: g.scopes, expires: now.Add(s.TokenLifetime)}
+	tok := randomString(24)
+	s.access[tok] = at
+	res := map[string]interface{}{
+		"access_token": tok,
+		"token_type":   "Bearer",
+		"expires_in":   int64(s.TokenLifetime / time.Second),
+		"scope":        strings.Join(g.scopes, s.scopeSeparator()),
+	}
+	if withRefresh {
+		rt := randomString(24)
+		s.refresh[rt] = &grant{user: g.user, scopes: g.scopes}
+		res["refresh_token"] = rt
+	}
+	if contains(g.scopes, "openid") {
+		idt, err := s.idToken(g.user, g.nonce, now)
+		if err != nil {
+			writeError(w, "server_error")
+			return
+		}
+		res["id_token"] = idt
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) scopeSeparator() string {
+	if len(s.ScopeSeparator) == 0 {
+		return " "
+	}
+	return s.ScopeSeparator
+}
+
+// device starts a device authorization, approved with ApproveDevice.
+func (s *Server) device(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, "invalid_request")
+		return
+	}
+	if r.PostFormValue("client_id") != s.ClientID {
+		writeError(w, "invalid_client")
+		return
+	}
+	code, userCode := randomString(24), strings.ToUpper(randomString(6))
+	s.mu.Lock()
+	s.devices[code] = &device{
+		userCode: userCode,
+		scopes:   strings.Fields(r.PostFormValue("scope")),
+		expires:  time.Now().Add(deviceLifetime),
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"device_code":      code,
+		"user_code":        userCode,
+		"verification_uri": s.URL + DevicePath,
+		"expires_in":       int64(deviceLifetime / time.Second),
+		"interval":         1,
+	})
+}
+
+func (s *Server) userInfo(w http.ResponseWriter, r *http.Request) {
+	g, code := s.bearer(r)
+	if g == nil {
+		writeError(w, code)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"sub":            g.user.Subject,
+		"email":          g.user.Email,
+		"email_verified": true,
+		"name":           g.user.Name,
+	})
+}
+
+func (s *Server) logout(w http.ResponseWriter, r *http.Request) {
+	if u := r.FormValue("post_logout_redirect_uri"); len(u) > 0 {
+		http.Redirect(w, r, u, http.StatusFound)
+		return
+	}
+	fmt.Fprintln(w, "signed out")
+}
+
+// bearer returns the grant of the access token of the request, or the error
+// code to reject it with.
+func (s *Server) bearer(r *http.Request) (*grant, string) {
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return nil, "invalid_request"
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.access[strings.TrimPrefix(h, "Bearer ")]
+	if !ok || time.Now().After(g.expires) {
+		return nil, "invalid_token"
+	}
+	return g, ""
+}
+
+// redirect redirects the user back to the redirect URI of the authorization
+// request, with the given parameters.
+func redirect(w http.ResponseWriter, r *http.Request, v url.Values) {
+	u, err := url.Parse(r.URL.Query().Get("redirect_uri"))
+	if err != nil || len(u.String()) == 0 {
+		http.Error(w, "bad redirect_uri", http.StatusBadRequest)
+		return
+	}
+	q := u.Query()
+	for k, vs := range v {
+		q[k] = vs
+	}
+	u.RawQuery = q.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func redirectError(w http.ResponseWriter, r *http.Request, code string) {
+	redirect(w, r, url.Values{"error": {code}, "state": {r.URL.Query().Get("state")}})
+}
+
+// writeError responds with the OAuth2 error code, with the status the
+// endpoints of a provider use for it.
+func writeError(w http.ResponseWriter, code string) {
+	status := http.StatusBadRequest
+	switch code {
+	case "invalid_client", "invalid_token":
+		status = http.StatusUnauthorized
+	case "insufficient_scope":
+		status = http.StatusForbidden
+	case "server_error":
+		status = http.StatusInternalServerError
+	case "temporarily_unavailable":
+		status = http.StatusServiceUnavailable
+	}
+	if status == http.StatusUnauthorized || status == http.StatusForbidden {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer error=%q", code))
+	}
+	writeJSON(w, status, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// randomString returns n random bytes, hex encoded.
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("authtest: read random bytes: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+func contains(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// union returns the scopes in a or b.
+func union(a, b []string) []string {
+	return append(append([]string(nil), a...), missing(a, b)...)
+}
+
+// missing returns the scopes in b not in a.
+func missing(a, b []string) []string {
+	var m []string
+	for _, s := range b {
+		if !contains(a, s) {
+			m = append(m, s)
+		}
+	}
+	return m
+}
@@ -0,0 +1,69 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package authtest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// idToken returns an RS256 ID token for the user, issued now for the client.
+func (s *Server) idToken(u User, nonce string, now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	h, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": s.kid})
+	if err != nil {
+		return "", err
+	}
+	cl := map[string]interface{}{
+		"iss":            s.URL,
+		"sub":            u.Subject,
+		"aud":            s.ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(s.TokenLifetime).Unix(),
+		"email":          u.Email,
+		"email_verified": true,
+		"name":           u.Name,
+	}
+	if len(nonce) > 0 {
+		cl["nonce"] = nonce
+	}
+	if s.IDTokenClaims != nil {
+		s.IDTokenClaims(cl)
+	}
+	c, err := json.Marshal(cl)
+	if err != nil {
+		return "", err
+	}
+	signed := enc.EncodeToString(h) + "." + enc.EncodeToString(c)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + enc.EncodeToString(sig), nil
+}
+
+// jwks serves the public key signing the ID tokens.
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	enc := base64.RawURLEncoding
+	k := s.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": s.kid,
+			"n":   enc.EncodeToString(k.N.Bytes()),
+			"e":   enc.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}},
+	})
+}
@@ -0,0 +1,46 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/oauth2"
+)
+
+// The device authorization flow lets users grant scopes to programs that
+// can't receive the callback, like command line tools, by entering a code on
+// the provider from another device.
+
+// DeviceAuth starts the device authorization flow asking for the scopes on
+// the provider. The user has to enter the UserCode of the response at its
+// VerificationURI, while WaitDevice waits for them to grant the scopes.
+func (m *Manager) DeviceAuth(ctx context.Context, p *Provider, scopes ...string) (*oauth2.DeviceAuthResponse, error) {
+	if len(p.Endpoint.DeviceAuthURL) == 0 {
+		return nil, fmt.Errorf("provider %q has no device authorization endpoint", p.Name)
+	}
+	da, err := p.config(scopes).DeviceAuth(oauth2Context(ctx), oauth2.AccessTypeOffline)
+	if err != nil {
+		return nil, fmt.Errorf("device authorization: %v", err)
+	}
+	return da, nil
+}
+
+// WaitDevice polls the provider until the user grants the scopes asked for
+// by DeviceAuth, the code expires or ctx is done, and saves the token for
+// the user. The scopes must be the ones passed to DeviceAuth.
+func (m *Manager) WaitDevice(ctx context.Context, userID string, p *Provider, da *oauth2.DeviceAuthResponse, scopes ...string) error {
+	tok, err := p.config(scopes).DeviceAccessToken(oauth2Context(ctx), da)
+	if err != nil {
+		return fmt.Errorf("device access token: %v", err)
+	}
+	if len(tok.RefreshToken) == 0 {
+		if old, err := m.Tokens.Grant(ctx, userID, p.Name); err == nil && old != nil {
+			tok.RefreshToken = old.RefreshToken
+		}
+	}
+	return m.Tokens.SaveGrant(ctx, userID, p.Name, &Grant{tok, grantedScopes(tok, scopes)})
+}
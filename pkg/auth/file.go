@@ -0,0 +1,60 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// FileBackend keeps each token in a file in a directory, readable only by
+// the user running the process.
+type FileBackend struct {
+	Dir string
+}
+
+func (f FileBackend) path(key string) string {
+	return filepath.Join(f.Dir, key+".token")
+}
+
+func (f FileBackend) Get(ctx context.Context, key string) ([]byte, error) {
+	b, err := ioutil.ReadFile(f.path(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return b, err
+}
+
+// Put writes the token to a temporary file and renames it, so concurrent
+// readers never see a partially written token.
+func (f FileBackend) Put(ctx context.Context, key string, data []byte) error {
+	if err := os.MkdirAll(f.Dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(f.Dir, key+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path(key))
+}
+
+func (f FileBackend) Delete(ctx context.Context, key string) error {
+	err := os.Remove(f.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,247 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/oauth2"
+)
+
+// A Manager is an http.Handler serving the oauth2 authorization of the
+// handlers registered on it. It must be mounted on its callback path and on
+// the paths of the handlers, in any http.ServeMux.
+type Manager struct {
+	// Tokens keeps the tokens of the users.
+	Tokens *TokenStore
+	// UserID returns the id of the user making the request, empty if not
+	// signed in. The handlers are served without authorization to the users
+	// not signed in, so they can ask them to sign in.
+	UserID func(r *http.Request) string
+	// Context returns the context used to access Tokens and to make
+	// requests to the providers in a request, r.Context() if nil.
+	Context func(r *http.Request) context.Context
+	// Wrap, if not nil, wraps the serving of every request, the callback
+	// and the handlers, as the application wraps its own handlers, so the
+	// state it keeps for a request is shared by UserID and the handlers.
+	Wrap func(h http.Handler) http.Handler
+
+	callbackPath string
+
+	mu        sync.RWMutex
+	handlers  map[string]registration
+	providers map[string]*Provider // providers of the handlers, by name
+}
+
+// registration is a handler registered on a Manager.
+type registration struct {
+	h        http.HandlerFunc
+	provider *Provider
+	scopes   []string
+}
+
+// NewManager returns a Manager serving the callback on the given path, which
+// the RedirectURL of the providers of its handlers should have.
+func NewManager(callbackPath string) *Manager {
+	return &Manager{
+		callbackPath: callbackPath,
+		handlers:     make(map[string]registration),
+		providers:    make(map[string]*Provider),
+	}
+}
+
+// CallbackPath returns the path on which the Manager serves the callback.
+func (m *Manager) CallbackPath() string { return m.callbackPath }
+
+func (m *Manager) context(r *http.Request) context.Context {
+	if m.Context == nil {
+		return r.Context()
+	}
+	return m.Context(r)
+}
+
+// Handle registers the passed http.Handler to be executed when the Manager
+// serves a request for path, once the user has granted the scopes on the
+// provider. The handler can then get a client with Client.
+func (m *Manager) Handle(path string, h http.Handler, p *Provider, scopes ...string) error {
+	return m.HandleFunc(path, h.ServeHTTP, p, scopes...)
+}
+
+// HandleFunc registers the passed http.HandlerFunc as Handle does.
+func (m *Manager) HandleFunc(path string, h http.HandlerFunc, p *Provider, scopes ...string) error {
+	u, err := url.Parse(p.RedirectURL)
+	if err != nil {
+		return fmt.Errorf("bad redirect URL: %v", err)
+	}
+	if u.Path != m.callbackPath {
+		return fmt.Errorf("RedirectURL has to point to %q, it points to %q", m.callbackPath, u.Path)
+	}
+	if path == m.callbackPath {
+		return fmt.Errorf("can't register a handler on the callback path %q", path)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if other, ok := m.providers[p.Name]; ok && other != p {
+		return fmt.Errorf("another provider is named %q", p.Name)
+	}
+	m.providers[p.Name] = p
+	m.handlers[path] = registration{h, p, scopes}
+	return nil
+}
+
+// TokenSource returns the tokens of the user for the provider, refreshing
+// them and saving them again when they expire. It returns ErrNoToken if the
+// user hasn't granted all the scopes, in which case the user should be sent
+// to a handler registered with them. The tokens returned fail with
+// ErrNoToken too if the provider refuses to refresh them, and the grant is
+// deleted.
+func (m *Manager) TokenSource(ctx context.Context, userID string, p *Provider, scopes ...string) (oauth2.TokenSource, error) {
+	g, err := m.Tokens.Grant(ctx, userID, p.Name)
+	if err != nil {
+		return nil, err
+	}
+	if g == nil || len(missing(g.Scopes, scopes)) > 0 {
+		return nil, ErrNoToken
+	}
+	return &savingSource{
+		ctx:      ctx,
+		store:    m.Tokens,
+		userID:   userID,
+		provider: p.Name,
+		scopes:   g.Scopes,
+		src:      p.config(g.Scopes).TokenSource(oauth2Context(ctx), g.Token),
+		last:     g.AccessToken,
+	}, nil
+}
+
+// Client creates an authenticated http.Client for the provider with the
+// token of the user, see TokenSource. The requests of the client, and the
+// ones refreshing the token, are made with the transport of ctx.
+func (m *Manager) Client(ctx context.Context, userID string, p *Provider, scopes ...string) (*http.Client, error) {
+	ts, err := m.TokenSource(ctx, userID, p, scopes...)
+	if err != nil {
+		return nil, err
+	}
+	return oauth2.NewClient(oauth2Context(ctx), ts), nil
+}
+
+// ServeHTTP handles the callback of the authentication server, and serves
+// the requests for the paths of the registered handlers, sending the users
+// who haven't granted the scopes of the handler to the consent page first.
+func (m *Manager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if m.Wrap != nil {
+		m.Wrap(http.HandlerFunc(m.serve)).ServeHTTP(w, r)
+		return
+	}
+	m.serve(w, r)
+}
+
+func (m *Manager) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == m.callbackPath {
+		m.callback(w, r)
+		return
+	}
+	m.mu.RLock()
+	reg, ok := m.handlers[r.URL.Path]
+	m.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	userID := m.UserID(r)
+	if len(userID) == 0 {
+		reg.h(w, r)
+		return
+	}
+	g, err := m.Tokens.Grant(m.context(r), userID, reg.provider.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var granted []string
+	if g != nil {
+		granted = g.Scopes
+	}
+	need := missing(granted, reg.scopes)
+	if len(need) == 0 {
+		reg.h(w, r)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "authorization required, retry with GET", http.StatusForbidden)
+		return
+	}
+	m.authorize(w, r, userID, reg.provider, granted, need)
+}
+
+// callback handles the response from the authentication server, saves the
+// token with the scopes granted and redirects the user to the path and query
+// of the request that started the authorization.
+func (m *Manager) callback(w http.ResponseWriter, r *http.Request) {
+	a, err := m.takeAttempt(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errp := r.FormValue("error"); len(errp) > 0 {
+		http.Error(w, fmt.Sprintf("authorization denied: %q", errp), http.StatusForbidden)
+		return
+	}
+	if m.UserID(r) != a.User {
+		http.Error(w, "the authorization was started by another user", http.StatusBadRequest)
+		return
+	}
+	m.mu.RLock()
+	p, ok := m.providers[a.Provider]
+	m.mu.RUnlock()
+	if !ok {
+		http.Error(w, "unknown provider "+a.Provider, http.StatusBadRequest)
+		return
+	}
+
+	ctx := m.context(r)
+	tok, err := p.config(a.Scopes).Exchange(oauth2Context(ctx), r.FormValue("code"), oauth2.VerifierOption(a.Verifier))
+	if err != nil {
+		http.Error(w, "oauth2 exchange: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(tok.RefreshToken) == 0 {
+		// Providers only send the refresh token the first time.
+		if old, err := m.Tokens.Grant(ctx, a.User, p.Name); err == nil && old != nil {
+			tok.RefreshToken = old.RefreshToken
+		}
+	}
+	if err := m.Tokens.SaveGrant(ctx, a.User, p.Name, &Grant{tok, grantedScopes(tok, a.Scopes)}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	dest := a.Path
+	if len(a.Query) > 0 {
+		dest += "?" + a.Query
+	}
+	http.Redirect(w, r, dest, http.StatusFound)
+}
+
+// grantedScopes returns the scopes granted to the token, which the provider
+// sends when they differ from the requested ones, as users may grant only
+// some of them. They're separated by spaces, or by commas as GitHub does.
+func grantedScopes(tok *oauth2.Token, requested []string) []string {
+	s, _ := tok.Extra("scope").(string)
+	if scopes := strings.FieldsFunc(s, isScopeSeparator); len(scopes) > 0 {
+		return scopes
+	}
+	return requested
+}
+
+func isScopeSeparator(r rune) bool { return r == ',' || unicode.IsSpace(r) }
@@ -0,0 +1,362 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/campoy/goconf/pkg/auth"
+	"github.com/campoy/goconf/pkg/auth/authtest"
+)
+
+// testApp is an application serving, on a Manager, handlers that read the
+// resources of an authtest.Server with the tokens of their users. The users
+// are identified by the user cookie of the browser.
+type testApp struct {
+	srv     *authtest.Server
+	app     *httptest.Server
+	m       *auth.Manager
+	p       *auth.Provider
+	browser *http.Client
+}
+
+func newTestApp(t *testing.T) *testApp {
+	srv := authtest.NewServer()
+	t.Cleanup(srv.Close)
+
+	m := auth.NewManager("/callback")
+	m.Tokens = &auth.TokenStore{
+		Backend: &auth.MemoryBackend{},
+		Keys:    [][]byte{[]byte("0123456789abcdef")},
+	}
+	m.UserID = func(r *http.Request) string {
+		if c, err := r.Cookie("user"); err == nil {
+			return c.Value
+		}
+		return ""
+	}
+	m.Context = func(r *http.Request) context.Context {
+		return auth.WithTransport(r.Context(), srv.Transport())
+	}
+	app := httptest.NewServer(m)
+	t.Cleanup(app.Close)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &testApp{
+		srv:     srv,
+		app:     app,
+		m:       m,
+		p:       srv.Provider("test", app.URL+"/callback"),
+		browser: &http.Client{Jar: jar},
+	}
+	a.signIn("gopher")
+	for _, scope := range []string{"calendar", "contacts"} {
+		srv.Resource("/"+scope, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "your "+r.URL.Path[1:])
+		}), scope)
+		if err := m.HandleFunc("/"+scope, a.read(scope), a.p, scope); err != nil {
+			t.Fatalf("handle %v: %v", scope, err)
+		}
+	}
+	return a
+}
+
+// signIn sets the user cookie of the browser.
+func (a *testApp) signIn(user string) {
+	u, _ := url.Parse(a.app.URL)
+	a.browser.Jar.SetCookies(u, []*http.Cookie{{Name: "user", Value: user}})
+}
+
+// read returns a handler reading the resource of the provider with the scope
+// as its path, sending the user to authorize again if the grant was revoked.
+func (a *testApp) read(scope string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := a.m.Context(r)
+		c, err := a.m.Client(ctx, a.m.UserID(r), a.p, scope)
+		var res *http.Response
+		if err == nil {
+			res, err = c.Get("https://provider.example.com/" + scope)
+		}
+		if errors.Is(err, auth.ErrNoToken) {
+			http.Redirect(w, r, r.URL.Path, http.StatusFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			http.Error(w, "provider: "+res.Status, http.StatusBadGateway)
+			return
+		}
+		io.Copy(w, res.Body)
+	}
+}
+
+// get makes a GET request to the application with the browser, following
+// the redirects, and returns the status and body of the response.
+func (a *testApp) get(t *testing.T, path string) (int, string) {
+	t.Helper()
+	res, err := a.browser.Get(a.app.URL + path)
+	if err != nil {
+		t.Fatalf("get %v: %v", path, err)
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("read %v: %v", path, err)
+	}
+	return res.StatusCode, string(b)
+}
+
+// wantGet checks that a GET request to path succeeds with the given body.
+func (a *testApp) wantGet(t *testing.T, path, body string) {
+	t.Helper()
+	if status, got := a.get(t, path); status != http.StatusOK || got != body {
+		t.Fatalf("get %v: got %v %q, want %q", path, status, got, body)
+	}
+}
+
+// grant returns the grant saved for the user.
+func (a *testApp) grant(t *testing.T, user string) *auth.Grant {
+	t.Helper()
+	g, err := a.m.Tokens.Grant(context.Background(), user, a.p.Name)
+	if err != nil {
+		t.Fatalf("grant of %v: %v", user, err)
+	}
+	return g
+}
+
+func TestCodeFlow(t *testing.T) {
+	a := newTestApp(t)
+	a.wantGet(t, "/calendar", "your calendar")
+
+	g := a.grant(t, "gopher")
+	if g == nil || len(g.RefreshToken) == 0 || !reflect.DeepEqual(g.Scopes, []string{"calendar"}) {
+		t.Fatalf("got grant %+v, want one with a refresh token for calendar", g)
+	}
+	if got := a.srv.Granted("1"); !reflect.DeepEqual(got, []string{"calendar"}) {
+		t.Errorf("granted on the server %v, want calendar", got)
+	}
+
+	// The token is still valid, so it's used as it was saved.
+	a.wantGet(t, "/calendar", "your calendar")
+	if again := a.grant(t, "gopher"); again.AccessToken != g.AccessToken {
+		t.Errorf("access token changed from %q to %q", g.AccessToken, again.AccessToken)
+	}
+}
+
+func TestIncrementalScopes(t *testing.T) {
+	a := newTestApp(t)
+	a.wantGet(t, "/calendar", "your calendar")
+	a.wantGet(t, "/contacts", "your contacts")
+	if g := a.grant(t, "gopher"); !reflect.DeepEqual(g.Scopes, []string{"calendar", "contacts"}) {
+		t.Errorf("got scopes %v, want calendar and contacts", g.Scopes)
+	}
+}
+
+func TestGrantedScopes(t *testing.T) {
+	a := newTestApp(t)
+	a.signIn("first")
+	a.wantGet(t, "/contacts", "your contacts")
+
+	// The server user granted contacts already, so the token of another
+	// user of the application asking only for calendar has both.
+	a.signIn("second")
+	a.wantGet(t, "/calendar", "your calendar")
+	if g := a.grant(t, "second"); !reflect.DeepEqual(g.Scopes, []string{"contacts", "calendar"}) {
+		t.Errorf("got scopes %v, want the ones reported by the server", g.Scopes)
+	}
+}
+
+func TestCommaSeparatedScopes(t *testing.T) {
+	a := newTestApp(t)
+	// Like GitHub, the server separates the scopes with commas.
+	a.srv.ScopeSeparator = ","
+	a.wantGet(t, "/calendar", "your calendar")
+	a.wantGet(t, "/contacts", "your contacts")
+	g := a.grant(t, "gopher")
+	if !reflect.DeepEqual(g.Scopes, []string{"calendar", "contacts"}) {
+		t.Fatalf("got scopes %q, want calendar and contacts", g.Scopes)
+	}
+
+	// Both scopes are granted, so there's no need to authorize again.
+	a.wantGet(t, "/calendar", "your calendar")
+	if again := a.grant(t, "gopher"); again.AccessToken != g.AccessToken {
+		t.Errorf("authorized again with the scopes %q granted", g.Scopes)
+	}
+}
+
+func TestFailures(t *testing.T) {
+	for _, tt := range []struct {
+		path, code string
+		status     int
+		body       string
+	}{
+		{authtest.AuthorizePath, "access_denied", http.StatusForbidden, "authorization denied"},
+		{authtest.TokenPath, "server_error", http.StatusBadRequest, "oauth2 exchange"},
+		{authtest.TokenPath, "invalid_grant", http.StatusBadRequest, "oauth2 exchange"},
+	} {
+		a := newTestApp(t)
+		a.srv.FailNext(tt.path, tt.code)
+		status, body := a.get(t, "/calendar")
+		if status != tt.status || !strings.Contains(body, tt.body) {
+			t.Errorf("%v failing with %v: got %v %q, want %v %q", tt.path, tt.code, status, body, tt.status, tt.body)
+		}
+		if g := a.grant(t, "gopher"); g != nil {
+			t.Errorf("%v failing with %v: saved grant %+v", tt.path, tt.code, g)
+		}
+
+		// The next attempt succeeds.
+		a.wantGet(t, "/calendar", "your calendar")
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	a := newTestApp(t)
+	// The tokens expire before the margin of the clients, so they're
+	// refreshed every time they're used.
+	a.srv.TokenLifetime = time.Second
+	a.wantGet(t, "/calendar", "your calendar")
+	g := a.grant(t, "gopher")
+
+	a.wantGet(t, "/calendar", "your calendar")
+	refreshed := a.grant(t, "gopher")
+	if refreshed.AccessToken == g.AccessToken {
+		t.Errorf("access token %q wasn't refreshed", g.AccessToken)
+	}
+	if refreshed.RefreshToken != g.RefreshToken || !reflect.DeepEqual(refreshed.Scopes, g.Scopes) {
+		t.Errorf("refreshed grant %+v, want the refresh token and scopes of %+v", refreshed, g)
+	}
+
+	// A refresh failing for other reasons keeps the grant.
+	a.srv.FailNext(authtest.TokenPath, "server_error")
+	if status, _ := a.get(t, "/calendar"); status != http.StatusInternalServerError {
+		t.Errorf("refresh failing with server_error: got status %v", status)
+	}
+	if a.grant(t, "gopher") == nil {
+		t.Errorf("grant deleted after a server error")
+	}
+}
+
+func TestRevokedGrant(t *testing.T) {
+	a := newTestApp(t)
+	a.srv.TokenLifetime = time.Second
+	a.wantGet(t, "/calendar", "your calendar")
+
+	a.srv.FailNext(authtest.TokenPath, "invalid_grant")
+	ctx := auth.WithTransport(context.Background(), a.srv.Transport())
+	ts, err := a.m.TokenSource(ctx, "gopher", a.p, "calendar")
+	if err != nil {
+		t.Fatalf("token source: %v", err)
+	}
+	if _, err := ts.Token(); err != auth.ErrNoToken {
+		t.Fatalf("refreshing a revoked grant: got %v, want ErrNoToken", err)
+	}
+	if g := a.grant(t, "gopher"); g != nil {
+		t.Fatalf("revoked grant %+v wasn't deleted", g)
+	}
+
+	// The handler sends the user to authorize again.
+	a.wantGet(t, "/calendar", "your calendar")
+	if a.grant(t, "gopher") == nil {
+		t.Errorf("no grant after authorizing again")
+	}
+}
+
+func TestExpireTokens(t *testing.T) {
+	a := newTestApp(t)
+	a.wantGet(t, "/calendar", "your calendar")
+
+	// The client doesn't know the token expired, so it's rejected.
+	a.srv.ExpireTokens()
+	if status, _ := a.get(t, "/calendar"); status != http.StatusBadGateway {
+		t.Errorf("expired token: got status %v, want it rejected by the provider", status)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	a := newTestApp(t)
+	var mu sync.Mutex
+	serving := make(map[*http.Request]bool)
+	a.m.Wrap = func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			serving[r] = true
+			mu.Unlock()
+			h.ServeHTTP(w, r)
+			mu.Lock()
+			delete(serving, r)
+			mu.Unlock()
+		})
+	}
+	userID := a.m.UserID
+	unwrapped := 0
+	a.m.UserID = func(r *http.Request) string {
+		mu.Lock()
+		if !serving[r] {
+			unwrapped++
+		}
+		mu.Unlock()
+		return userID(r)
+	}
+
+	// The handler and the callback are served wrapped.
+	a.wantGet(t, "/calendar", "your calendar")
+	if unwrapped > 0 {
+		t.Errorf("the user of %v requests was identified out of Wrap", unwrapped)
+	}
+}
+
+func TestDeviceFlow(t *testing.T) {
+	a := newTestApp(t)
+	ctx := auth.WithTransport(context.Background(), a.srv.Transport())
+
+	a.srv.FailNext(authtest.DevicePath, "server_error")
+	if _, err := a.m.DeviceAuth(ctx, a.p, "calendar"); err == nil {
+		t.Errorf("device authorization failing with server_error succeeded")
+	}
+
+	da, err := a.m.DeviceAuth(ctx, a.p, "calendar")
+	if err != nil {
+		t.Fatalf("device authorization: %v", err)
+	}
+	if err := a.srv.ApproveDevice(da.UserCode); err != nil {
+		t.Fatalf("approve device: %v", err)
+	}
+	if err := a.m.WaitDevice(ctx, "tool", a.p, da, "calendar"); err != nil {
+		t.Fatalf("wait device: %v", err)
+	}
+	c, err := a.m.Client(ctx, "tool", a.p, "calendar")
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+	res, err := c.Get("https://provider.example.com/calendar")
+	if err != nil {
+		t.Fatalf("get calendar: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("get calendar: got status %v", res.Status)
+	}
+	if _, err := a.m.Client(ctx, "tool", a.p, "contacts"); err != auth.ErrNoToken {
+		t.Errorf("client for a scope not granted: got %v, want ErrNoToken", err)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+)
+
+// A Provider is an oauth2 authorization server, with the credentials of the
+// application on it.
+type Provider struct {
+	// Name identifies the provider, and the tokens of the users on it.
+	Name string
+	// Endpoint has the URLs of the provider. The device authorization flow
+	// is only available if its DeviceAuthURL is set.
+	Endpoint     oauth2.Endpoint
+	ClientID     string
+	ClientSecret string
+	// RedirectURL must point to the callback path of the Manager.
+	RedirectURL string
+	// Incremental is true if the provider adds the scopes already granted
+	// to the new tokens when asked to, as Google does. Only the missing
+	// scopes are requested from those providers, and all the needed ones
+	// from the rest.
+	Incremental bool
+}
+
+// Google returns the Provider named "google" for Google accounts.
+func Google(clientID, clientSecret, redirectURL string) *Provider {
+	return &Provider{
+		Name:         "google",
+		Endpoint:     endpoints.Google,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Incremental:  true,
+	}
+}
+
+// GitHub returns the Provider named "github" for GitHub accounts.
+func GitHub(clientID, clientSecret, redirectURL string) *Provider {
+	return &Provider{
+		Name:         "github",
+		Endpoint:     endpoints.GitHub,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+	}
+}
+
+// Discover returns a Provider with the given name for the OpenID Connect
+// issuer, with the endpoints in its discovery document.
+func Discover(ctx context.Context, name, issuer, clientID, clientSecret, redirectURL string) (*Provider, error) {
+	u := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("discover %v: %v", issuer, err)
+	}
+	res, err := httpClient(ctx).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("discover %v: %v", issuer, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discover %v: %v", issuer, res.Status)
+	}
+	var d struct {
+		AuthorizationEndpoint       string `json:"authorization_endpoint"`
+		TokenEndpoint               string `json:"token_endpoint"`
+		DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&d); err != nil {
+		return nil, fmt.Errorf("decode discovery document of %v: %v", issuer, err)
+	}
+	return &Provider{
+		Name: name,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:       d.AuthorizationEndpoint,
+			TokenURL:      d.TokenEndpoint,
+			DeviceAuthURL: d.DeviceAuthorizationEndpoint,
+		},
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+	}, nil
+}
+
+// config returns the oauth2.Config requesting the given scopes.
+func (p *Provider) config(scopes []string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		Endpoint:     p.Endpoint,
+		RedirectURL:  p.RedirectURL,
+		Scopes:       scopes,
+	}
+}
+
+// authCodeURL returns the URL of the consent page asking for the scopes,
+// with the PKCE challenge of the verifier.
+func (p *Provider) authCodeURL(state, verifier string, scopes []string) string {
+	opts := []oauth2.AuthCodeOption{
+		oauth2.AccessTypeOffline, // get a refresh token to use it later
+		oauth2.S256ChallengeOption(verifier),
+	}
+	if p.Incremental {
+		opts = append(opts, oauth2.SetAuthURLParam("include_granted_scopes", "true"))
+	}
+	return p.config(scopes).AuthCodeURL(state, opts...)
+}
+
+// missing returns the scopes not in granted.
+func missing(granted, scopes []string) []string {
+	has := make(map[string]bool, len(granted))
+	for _, s := range granted {
+		has[s] = true
+	}
+	var m []string
+	for _, s := range scopes {
+		if !has[s] {
+			m = append(m, s)
+		}
+	}
+	return m
+}
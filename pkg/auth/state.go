@@ -0,0 +1,117 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Each authorization attempt has a random state, and a cookie named with the
+// state binds it to the browser that started it until the callback. The
+// cookie keeps the path and query of the request that started the attempt,
+// with the user, provider and scopes it asks for and the PKCE verifier of the
+// code, and it's deleted by the callback so the state can't be used again.
+const (
+	stateCookiePrefix = "oauth2state_"
+	stateLen          = 32               // random bytes in a state
+	stateMaxAge       = 10 * time.Minute // time to complete an attempt
+)
+
+// An attempt is an authorization attempt, kept in the cookie of its state.
+type attempt struct {
+	Path     string   `json:"path"`
+	Query    string   `json:"query"`
+	User     string   `json:"user"`
+	Provider string   `json:"provider"`
+	Scopes   []string `json:"scopes"` // scopes of the token once granted
+	Verifier string   `json:"verifier"`
+	Expires  int64    `json:"exp"`
+}
+
+// authorize starts an authorization attempt for the request, sending the user
+// to the consent page of the provider to grant the needed scopes.
+func (m *Manager) authorize(w http.ResponseWriter, r *http.Request, userID string, p *Provider, granted, need []string) {
+	b := make([]byte, stateLen)
+	if _, err := rand.Read(b); err != nil {
+		http.Error(w, "generate oauth2 state failed", http.StatusInternalServerError)
+		return
+	}
+	state := base64.RawURLEncoding.EncodeToString(b)
+	scopes := append(append([]string(nil), granted...), need...)
+	verifier := oauth2.GenerateVerifier()
+	v, err := json.Marshal(attempt{
+		Path:     r.URL.Path,
+		Query:    r.URL.RawQuery,
+		User:     userID,
+		Provider: p.Name,
+		Scopes:   scopes,
+		Verifier: verifier,
+		Expires:  time.Now().Add(stateMaxAge).Unix(),
+	})
+	if err != nil {
+		http.Error(w, "encode oauth2 state failed", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookiePrefix + state,
+		Value:    base64.RawURLEncoding.EncodeToString(v),
+		Path:     m.callbackPath,
+		MaxAge:   int(stateMaxAge / time.Second),
+		HttpOnly: true,
+		Secure:   isHTTPS(p.RedirectURL),
+	})
+	ask := scopes
+	if p.Incremental {
+		ask = need
+	}
+	http.Redirect(w, r, p.authCodeURL(state, verifier, ask), http.StatusFound)
+}
+
+// takeAttempt returns the attempt with the state of the callback request,
+// deleting its cookie. It fails if the attempt wasn't started by the same
+// browser, it expired or it was already completed.
+func (m *Manager) takeAttempt(w http.ResponseWriter, r *http.Request) (*attempt, error) {
+	state := r.FormValue("state")
+	if b, err := base64.RawURLEncoding.DecodeString(state); err != nil || len(b) != stateLen {
+		return nil, fmt.Errorf("malformed state %q", state)
+	}
+	c, err := r.Cookie(stateCookiePrefix + state)
+	if err != nil {
+		return nil, fmt.Errorf("unknown or already used state %q", state)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:   c.Name,
+		Path:   m.callbackPath,
+		MaxAge: -1,
+	})
+
+	b, err := base64.RawURLEncoding.DecodeString(c.Value)
+	if err != nil {
+		return nil, fmt.Errorf("bad state cookie: %v", err)
+	}
+	var a attempt
+	if err := json.Unmarshal(b, &a); err != nil {
+		return nil, fmt.Errorf("bad state cookie: %v", err)
+	}
+	if time.Now().Unix() > a.Expires {
+		return nil, fmt.Errorf("expired state %q", state)
+	}
+	return &a, nil
+}
+
+// isHTTPS returns whether the URL of the application is served over HTTPS.
+// The requests don't show it, since front ends like App Engine's terminate
+// TLS.
+func isHTTPS(appURL string) bool {
+	return strings.HasPrefix(strings.ToLower(appURL), "https:")
+}
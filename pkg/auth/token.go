@@ -0,0 +1,205 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrNoToken is returned when there's no token saved for a user with the
+// requested scopes, or the provider refused to refresh it.
+var ErrNoToken = errors.New("no token with the requested scopes")
+
+// A Grant is the token of a user on a provider, with the scopes granted to
+// it.
+type Grant struct {
+	*oauth2.Token
+	Scopes []string
+}
+
+// A Backend keeps encrypted tokens by key.
+type Backend interface {
+	// Get returns the data saved with the given key, nil if none.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Put saves the data with the given key, replacing any saved before.
+	Put(ctx context.Context, key string, data []byte) error
+	// Delete deletes the data saved with the given key, if any.
+	Delete(ctx context.Context, key string) error
+}
+
+// A TokenStore keeps the grants of the users on each provider in a Backend,
+// encrypted with AES-GCM.
+type TokenStore struct {
+	Backend Backend
+	// Keys encrypt the tokens, each of them with 16, 24 or 32 bytes. The
+	// first one encrypts the tokens and all of them decrypt them, so keys are
+	// rotated by adding a new one first. Tokens are encrypted again with the
+	// new key when they are refreshed.
+	Keys [][]byte
+}
+
+// key returns the key of the grant of the user on the provider. It's a hash,
+// so the backends don't see the ids of the users.
+func key(userID, provider string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q %q", userID, provider)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func gcm(key []byte) (cipher.AEAD, error) {
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("bad token key: %v", err)
+	}
+	return cipher.NewGCM(b)
+}
+
+// Grant returns the grant saved for the user on the provider with the given
+// name, nil if none.
+func (s *TokenStore) Grant(ctx context.Context, userID, provider string) (*Grant, error) {
+	k := key(userID, provider)
+	b, err := s.Backend.Get(ctx, k)
+	if err != nil {
+		return nil, fmt.Errorf("load token: %v", err)
+	}
+	if b == nil {
+		return nil, nil
+	}
+	for _, key := range s.Keys {
+		aead, err := gcm(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) < aead.NonceSize() {
+			return nil, fmt.Errorf("stored token too short")
+		}
+		pt, err := aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], []byte(k))
+		if err != nil {
+			continue
+		}
+		var g Grant
+		if err := json.Unmarshal(pt, &g); err != nil {
+			return nil, fmt.Errorf("decode token: %v", err)
+		}
+		if g.Token == nil || len(g.AccessToken) == 0 && len(g.RefreshToken) == 0 {
+			// Saved with the old goauth2 field names, ask for it again.
+			return nil, nil
+		}
+		return &g, nil
+	}
+	return nil, fmt.Errorf("no key decrypts the stored token")
+}
+
+// SaveGrant saves the grant of the user on the provider with the given name.
+func (s *TokenStore) SaveGrant(ctx context.Context, userID, provider string, g *Grant) error {
+	if len(s.Keys) == 0 {
+		return fmt.Errorf("no token keys")
+	}
+	k := key(userID, provider)
+	b, err := json.Marshal(g)
+	if err != nil {
+		return fmt.Errorf("encode token: %v", err)
+	}
+	aead, err := gcm(s.Keys[0])
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("read random bytes: %v", err)
+	}
+	if err := s.Backend.Put(ctx, k, aead.Seal(nonce, nonce, b, []byte(k))); err != nil {
+		return fmt.Errorf("save token: %v", err)
+	}
+	return nil
+}
+
+// DeleteGrant deletes the grant of the user on the provider with the given
+// name.
+func (s *TokenStore) DeleteGrant(ctx context.Context, userID, provider string) error {
+	if err := s.Backend.Delete(ctx, key(userID, provider)); err != nil {
+		return fmt.Errorf("delete token: %v", err)
+	}
+	return nil
+}
+
+// savingSource is an oauth2.TokenSource saving the tokens refreshed by src
+// in a store, keeping the scopes of the grant.
+type savingSource struct {
+	ctx      context.Context
+	store    *TokenStore
+	userID   string
+	provider string
+	scopes   []string
+	src      oauth2.TokenSource
+
+	mu   sync.Mutex
+	last string // access token saved last
+}
+
+func (s *savingSource) Token() (*oauth2.Token, error) {
+	tok, err := s.src.Token()
+	if re, ok := err.(*oauth2.RetrieveError); ok && re.ErrorCode == "invalid_grant" {
+		// The grant was revoked or expired, the user has to authorize
+		// the application again.
+		if err := s.store.DeleteGrant(s.ctx, s.userID, s.provider); err != nil {
+			return nil, err
+		}
+		return nil, ErrNoToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tok.AccessToken != s.last {
+		if err := s.store.SaveGrant(s.ctx, s.userID, s.provider, &Grant{tok, grantedScopes(tok, s.scopes)}); err != nil {
+			return nil, err
+		}
+		s.last = tok.AccessToken
+	}
+	return tok, nil
+}
+
+// MemoryBackend keeps the tokens in memory, so they are lost when the
+// process exits.
+type MemoryBackend struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (m *MemoryBackend) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.data[key], nil
+}
+
+func (m *MemoryBackend) Put(ctx context.Context, key string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data == nil {
+		m.data = make(map[string][]byte)
+	}
+	m.data[key] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *MemoryBackend) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, key)
+	return nil
+}
@@ -10,13 +10,18 @@
 package conf
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
+	"reflect"
+	"sync"
 	"time"
 
 	"appengine"
 	"appengine/datastore"
 	"appengine/mail"
 	"appengine/memcache"
+	"appengine/taskqueue"
 )
 
 const (
@@ -27,29 +32,107 @@ const (
 	ConferenceKind   = "Conference"
 	TicketKind       = "Ticket"
 	UserKind         = "RegisteredUser"
+
+	// The handler for TicketCreationPath must call CreateAndSaveTickets on
+	// the conference with the id in the conf_id form value, see
+	// QueueTickets.
+	TicketCreationPath = "/createtickets"
+
+	// ticketBatch is the number of tickets saved in each transaction, below
+	// the limit of entities written by a commit.
+	ticketBatch = 400
 )
 
-// A ConfList contains a list of conferences with a title for the whole list.
-// For instance the title could be "All the conferences in London", and the
-// list of conferences would contain all the conferences matching that description.
-type ConfList struct {
-	Title       string
+// ErrTicketUnavailable is returned when selling a ticket that was sold
+// already.
+var ErrTicketUnavailable = errors.New("ticket not available")
+
+// ErrTicketNotSold is returned when cancelling a ticket that isn't sold.
+var ErrTicketNotSold = errors.New("ticket not sold")
+
+// A ValidationError is returned when a model can't be saved because of its
+// values, as opposed to failing to save it.
+type ValidationError string
+
+func (e ValidationError) Error() string { return string(e) }
+
+// invalid returns a ValidationError with the formatted message.
+func invalid(format string, args ...interface{}) error {
+	return ValidationError(fmt.Sprintf(format, args...))
+}
+
+// A CursorError is returned when the cursor to a page of results is
+// malformed.
+type CursorError struct {
+	Cursor string
+	Err    error
+}
+
+func (e *CursorError) Error() string { return fmt.Sprintf("bad cursor %q: %v", e.Cursor, e.Err) }
+
+// decodeCursor decodes a cursor to a page of results, returning a
+// *CursorError if it's malformed.
+func decodeCursor(cursor string) (datastore.Cursor, error) {
+	c, err := datastore.DecodeCursor(cursor)
+	if err != nil {
+		return c, &CursorError{cursor, err}
+	}
+	return c, nil
+}
+
+// A ConfPage is a page of the conferences obtained from a query.
+type ConfPage struct {
 	Conferences []Conference
+	// Next is an opaque cursor to the next page, empty if this is the last one.
+	Next string
+}
+
+// LoadConfPage executes the given query starting at the given cursor and
+// returns a page with at most limit conferences. An empty cursor starts at
+// the beginning of the results.
+func LoadConfPage(ctx appengine.Context, q *datastore.Query, cursor string, limit int) (*ConfPage, error) {
+	return loadConfPage(ctx, q, cursor, limit, nil)
 }
 
-// LoadConfList executes the given query and returns a new ConfList with the given title and
-// containing the conferences obtained from the query result.
-func LoadConfList(ctx appengine.Context, title string, q *datastore.Query) (*ConfList, error) {
-	list := &ConfList{Title: title}
+// loadConfPage is like LoadConfPage, but only the conferences for which match
+// returns true are part of the page. A nil match function matches all the
+// conferences.
+func loadConfPage(ctx appengine.Context, q *datastore.Query, cursor string, limit int, match func(*Conference) bool) (*ConfPage, error) {
+	if len(cursor) > 0 {
+		c, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Start(c)
+	}
+
+	page := &ConfPage{}
+	it := q.Run(ctx)
+	for scanned := 0; len(page.Conferences) < limit && scanned < maxScan; scanned++ {
+		var c Conference
+		k, err := it.Next(&c)
+		if err == datastore.Done {
+			return page, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get conferences: %v", err)
+		}
+		c.setKey(k)
+		if match == nil || match(&c) {
+			page.Conferences = append(page.Conferences, c)
+		}
+	}
 
-	ks, err := q.GetAll(ctx, &list.Conferences)
+	// Check whether there's a next page peeking one more conference.
+	next, err := it.Cursor()
 	if err != nil {
-		return nil, fmt.Errorf("get %q: %v", list.Title, err)
+		return nil, fmt.Errorf("get cursor: %v", err)
 	}
-	for i, k := range ks {
-		list.Conferences[i].key = k
+	if _, err := it.Next(&Conference{}); err == datastore.Done {
+		return page, nil
 	}
-	return list, nil
+	page.Next = next.String()
+	return page, nil
 }
 
 // Conference contains all the information for a conference.
@@ -57,20 +140,134 @@ type Conference struct {
 	Name         string
 	Description  string
 	City         string
-	Topic        string
+	Topic        string   // Deprecated: first of Topics, kept for older clients
+	Topics       []string // topics of the conference, see TopicSep
+	AllTopics    []string // Topics and all their ancestors, set when saved
 	MaxAttendees int
 	TixAvailable int
 	StartDate    time.Time
 	EndDate      time.Time
 	Organizer    string
-
-	key *datastore.Key
+	Approved     bool
+	VenueID      string // id of the Venue the conference is held in, if any
+	TimeZone     string // IANA time zone name, UTC if empty
+	// ReplyToken identifies the conference in the replies of its organizer,
+	// see ConferenceForReply. It's secret, so it's never serialized.
+	ReplyToken string `json:"-"`
+
+	key       *datastore.Key
+	validated bool // whether Validate succeeded, see Save
 }
 
 // ID returns a unique identifier for any Conference that has already
 // been saved in the datastore.
 func (c *Conference) ID() string { return c.key.Encode() }
 
+// setKey sets the key of a conference loaded from the datastore.
+func (c *Conference) setKey(k *datastore.Key) {
+	c.key = k
+	c.normalizeTopics()
+}
+
+// normalizeTopics sets the fields derived from Topics, and Topics from the
+// single Topic of conferences saved before they had many.
+func (c *Conference) normalizeTopics() {
+	if len(c.Topics) == 0 && len(c.Topic) > 0 {
+		c.Topics = []string{c.Topic}
+	}
+	c.Topic = ""
+	if len(c.Topics) > 0 {
+		c.Topic = c.Topics[0]
+	}
+	c.AllTopics = TopicAncestors(c.Topics...)
+}
+
+// HasTopic returns true if the conference is about the given topic or any of
+// its subtopics.
+func (c *Conference) HasTopic(topic string) bool {
+	for _, t := range c.AllTopics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// DateLayout is the layout of the dates accepted by ParseDates.
+const DateLayout = "2006-01-02"
+
+// Location returns the time zone of the conference.
+func (c *Conference) Location() (*time.Location, error) {
+	return LoadLocation(c.TimeZone)
+}
+
+// locations caches the time zones loaded by LoadLocation.
+var locations = struct {
+	sync.RWMutex
+	m map[string]*time.Location
+}{m: make(map[string]*time.Location)}
+
+// LoadLocation is like time.LoadLocation, but the time zones are read from
+// the zone database only once.
+func LoadLocation(name string) (*time.Location, error) {
+	locations.RLock()
+	loc, ok := locations.m[name]
+	locations.RUnlock()
+	if ok {
+		return loc, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Lock()
+	locations.m[name] = loc
+	locations.Unlock()
+	return loc, nil
+}
+
+// Finished returns true if the last day of the conference, in its time zone,
+// is over at the given time.
+func (c *Conference) Finished(t time.Time) bool {
+	loc, err := c.Location()
+	if err != nil {
+		loc = time.UTC
+	}
+	end := c.EndDate.In(loc)
+	end = time.Date(end.Year(), end.Month(), end.Day()+1, 0, 0, 0, 0, loc)
+	return !t.Before(end)
+}
+
+// ParseDates sets the start and end dates of the conference parsing them as
+// days in the conference time zone, which defaults to the one of its venue.
+// The dates are stored in UTC.
+func (c *Conference) ParseDates(ctx appengine.Context, start, end string) error {
+	if len(c.TimeZone) == 0 && len(c.VenueID) > 0 {
+		v, err := LoadVenue(ctx, c.VenueID)
+		if err == datastore.ErrNoSuchEntity {
+			return invalid("unknown venue %q", c.VenueID)
+		}
+		if err != nil {
+			return fmt.Errorf("load venue: %v", err)
+		}
+		c.TimeZone = v.TimeZone
+	}
+	loc, err := c.Location()
+	if err != nil {
+		return invalid("bad time zone %q: %v", c.TimeZone, err)
+	}
+	s, err := time.ParseInLocation(DateLayout, start, loc)
+	if err != nil {
+		return invalid("bad start date %q", start)
+	}
+	e, err := time.ParseInLocation(DateLayout, end, loc)
+	if err != nil {
+		return invalid("bad end date %q", end)
+	}
+	c.StartDate, c.EndDate = s.UTC(), e.UTC()
+	return nil
+}
+
 // LoadConference loads a conference from the datastore given its unique id.
 func LoadConference(ctx appengine.Context, id string) (*Conference, error) {
 	k, err := datastore.DecodeKey(id)
@@ -86,18 +283,105 @@ func loadConference(ctx appengine.Context, k *datastore.Key) (*Conference, error
 	if err := datastore.Get(ctx, k, &conf); err != nil {
 		return nil, err
 	}
-	conf.key = k
+	conf.setKey(k)
 	return &conf, nil
 }
 
-// Save saves a conference into datastore.
+// Save saves a conference into datastore, emitting an EventConferenceCreated
+// or EventConferenceUpdated event.
 // This doesn't save any of the tickets of the conference.
+// The conference is validated before the transaction, see Validate. If ctx is
+// already a transaction, Validate must have been called before it started.
 func (conf *Conference) Save(ctx appengine.Context) error {
+	if _, ok := ctx.(*txContext); !ok {
+		if err := conf.Validate(ctx); err != nil {
+			return err
+		}
+	} else if !conf.validated {
+		return fmt.Errorf("conference %q saved in a transaction without validating it", conf.Name)
+	}
+	return RunInTransaction(ctx, func(ctx appengine.Context) error {
+		typ := EventConferenceUpdated
+		if conf.key == nil {
+			typ = EventConferenceCreated
+		} else {
+			// Keep the fields not edited with the rest, which may have
+			// changed since conf was loaded.
+			old, err := loadConference(ctx, conf.key)
+			if err != nil {
+				return fmt.Errorf("load conference: %v", err)
+			}
+			conf.TixAvailable = old.TixAvailable
+			conf.Approved = old.Approved
+			conf.ReplyToken = old.ReplyToken
+		}
+		if err := conf.put(ctx); err != nil {
+			return err
+		}
+		return emit(ctx, conf.key, typ, confEvent{conf.ID(), conf})
+	})
+}
+
+// Validate returns an error if the conference can't be saved, and replaces
+// its topics and city with the terms they were merged into.
+// It loads the taxonomies, which may seed them, and the venue, so it must be
+// called out of any transaction, to keep their entity groups out of it.
+func (conf *Conference) Validate(ctx appengine.Context) error {
+	if _, ok := ctx.(*txContext); ok {
+		return errors.New("conferences must be validated out of transactions")
+	}
+	conf.validated = false
+	if conf.MaxAttendees <= 0 {
+		return invalid("bad max attendees %v", conf.MaxAttendees)
+	}
+	if _, err := conf.Location(); err != nil {
+		return invalid("bad time zone %q: %v", conf.TimeZone, err)
+	}
+	conf.normalizeTopics()
+	topics := make([]string, 0, len(conf.Topics))
+	for _, t := range conf.Topics {
+		t, err := resolveTerm(ctx, TopicKind, t, false)
+		if err != nil {
+			return err
+		}
+		topics = append(topics, t)
+	}
+	conf.Topics = uniqueTerms(topics)
+	var err error
+	if len(conf.City) > 0 {
+		if conf.City, err = resolveTerm(ctx, CityKind, conf.City, false); err != nil {
+			return err
+		}
+	}
+	if conf.EndDate.Before(conf.StartDate) {
+		return invalid("conference ends on %v before starting on %v",
+			conf.EndDate.Format(DateLayout), conf.StartDate.Format(DateLayout))
+	}
+	if len(conf.VenueID) > 0 {
+		v, err := LoadVenue(ctx, conf.VenueID)
+		if err == datastore.ErrNoSuchEntity {
+			return invalid("unknown venue %q", conf.VenueID)
+		}
+		if err != nil {
+			return fmt.Errorf("load venue: %v", err)
+		}
+		if conf.MaxAttendees > v.Capacity {
+			return invalid("%v attendees don't fit in %v, its capacity is %v",
+				conf.MaxAttendees, v.Name, v.Capacity)
+		}
+	}
+	conf.validated = true
+	return nil
+}
+
+// put saves a conference into datastore without emitting any event.
+func (conf *Conference) put(ctx appengine.Context) error {
 	k := conf.key
 	if k == nil {
 		k = datastore.NewKey(ctx, ConferenceKind, "", 0, nil)
 	}
 
+	conf.normalizeTopics()
 	k, err := datastore.Put(ctx, k, conf)
 	if err != nil {
 		return fmt.Errorf("save conference: %v", err)
@@ -106,39 +390,130 @@ func (conf *Conference) Save(ctx appengine.Context) error {
 	return nil
 }
 
+// Approve marks the conference as reviewed and approved, and emits an
+// EventConferenceApproved event. The conference is loaded again in the
+// transaction, so the changes saved since conf was loaded, like tickets
+// sold, are kept, and conf is updated with them.
+func (conf *Conference) Approve(ctx appengine.Context) error {
+	return RunInTransaction(ctx, func(ctx appengine.Context) error {
+		c, err := loadConference(ctx, conf.key)
+		if err != nil {
+			return fmt.Errorf("load conference: %v", err)
+		}
+		c.Approved = true
+		if err := c.put(ctx); err != nil {
+			return err
+		}
+		*conf = *c
+		return emit(ctx, conf.key, EventConferenceApproved, confEvent{conf.ID(), conf})
+	})
+}
+
+// QueueTickets queues a task to TicketCreationPath to create the tickets of
+// the conference. Called in the transaction saving a new conference, the task
+// is only queued if the conference is saved.
+func (conf *Conference) QueueTickets(ctx appengine.Context) error {
+	task := taskqueue.NewPOSTTask(TicketCreationPath, url.Values{"conf_id": {conf.ID()}})
+	if _, err := taskqueue.Add(ctx, task, ""); err != nil {
+		return fmt.Errorf("queue ticket creation: %v", err)
+	}
+	return nil
+}
+
 // CreateAndSaveTickets creates as many tickets as the max number of attendees
-// for the conference and saves them into the datastore.
+// for the conference and saves them into the datastore, emitting an
+// EventTicketsCreated event once they're all saved.
+// Conferences can have more tickets than a transaction can write, so they're
+// saved in batches, and it must be called out of any transaction, normally by
+// the task queued by QueueTickets. It can be called again if it fails: the
+// tickets already saved, which may have been sold, are kept.
 func (conf *Conference) CreateAndSaveTickets(ctx appengine.Context) error {
-	for i := 1; i <= conf.MaxAttendees; i++ {
-		t := Ticket{
-			Number:   i,
-			State:    TicketAvailable,
-			ConfName: conf.Name,
+	if _, ok := ctx.(*txContext); ok {
+		return errors.New("tickets must be created out of transactions")
+	}
+	for first := 1; first <= conf.MaxAttendees; first += ticketBatch {
+		last := first + ticketBatch - 1
+		if last > conf.MaxAttendees {
+			last = conf.MaxAttendees
 		}
-		if err := t.save(ctx, conf.key); err != nil {
-			return fmt.Errorf("save ticket %v for conference %v: %v", i, conf.Name, err)
+		if err := conf.createTickets(ctx, first, last); err != nil {
+			return fmt.Errorf("save tickets %v to %v for conference %v: %v", first, last, conf.Name, err)
 		}
 	}
-	return nil
+	return RunInTransaction(ctx, func(ctx appengine.Context) error {
+		return emit(ctx, conf.key, EventTicketsCreated, struct {
+			ConferenceID string `json:"conference_id"`
+			Count        int    `json:"count"`
+		}{conf.ID(), conf.MaxAttendees})
+	})
 }
 
-// MailNotifications finds all the users interested in the topic of the conference
-// and sends them an email notifying the conference.
+// createTickets saves the tickets of the conference numbered from first to
+// last that weren't saved yet, in a transaction.
+func (conf *Conference) createTickets(ctx appengine.Context, first, last int) error {
+	return datastore.RunInTransaction(ctx, func(ctx appengine.Context) error {
+		ks := make([]*datastore.Key, 0, last-first+1)
+		for i := first; i <= last; i++ {
+			ks = append(ks, datastore.NewKey(ctx, TicketKind, "", int64(i), conf.key))
+		}
+		old := make([]Ticket, len(ks))
+		err := datastore.GetMulti(ctx, ks, old)
+		errs, _ := err.(appengine.MultiError)
+		if err != nil && errs == nil {
+			return fmt.Errorf("load tickets: %v", err)
+		}
+		var (
+			missing []*datastore.Key
+			ts      []Ticket
+		)
+		for i, k := range ks {
+			if errs == nil || errs[i] == nil {
+				continue
+			}
+			if errs[i] != datastore.ErrNoSuchEntity {
+				return fmt.Errorf("load ticket %v: %v", first+i, errs[i])
+			}
+			missing = append(missing, k)
+			ts = append(ts, Ticket{
+				Number:   first + i,
+				State:    TicketAvailable,
+				ConfName: conf.Name,
+			})
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+		_, err = datastore.PutMulti(ctx, missing, ts)
+		return err
+	}, nil)
+}
+
+// MailNotifications finds all the users interested in any of the topics of the
+// conference, or their parent topics, and sends them an email notifying the
+// conference.
 //
 // This operation can be slow and shouldn't be performed in the critical path of the
 // application.
 func (conf *Conference) MailNotifications(ctx appengine.Context, sender, subject, body string) error {
-	ks, err := datastore.NewQuery(UserKind).
-		Filter("Topics =", conf.Topic).
-		KeysOnly().
-		GetAll(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("get interested users: %v", err)
+	var to []string
+	seen := make(map[string]bool)
+	for _, t := range conf.AllTopics {
+		ks, err := datastore.NewQuery(UserKind).
+			Filter("Topics =", t).
+			KeysOnly().
+			GetAll(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("get interested users: %v", err)
+		}
+		for _, k := range ks {
+			if !seen[k.StringID()] {
+				seen[k.StringID()] = true
+				to = append(to, k.StringID())
+			}
+		}
 	}
-
-	to := make([]string, len(ks))
-	for i, k := range ks {
-		to[i] = k.StringID()
+	if len(to) == 0 {
+		return nil
 	}
 
 	msg := &mail.Message{
@@ -175,6 +550,10 @@ const (
 // been saved in the datastore.
 func (t *Ticket) ID() string { return t.key.Encode() }
 
+// ConferenceID returns the unique identifier of the conference of a Ticket
+// that has already been saved in the datastore.
+func (t *Ticket) ConferenceID() string { return t.key.Parent().Encode() }
+
 // LoadTicket loads a Ticket from the datastore given its unique id.
 func LoadTicket(ctx appengine.Context, id string) (*Ticket, error) {
 	k, err := datastore.DecodeKey(id)
@@ -201,12 +580,23 @@ func (t *Ticket) save(ctx appengine.Context, confKey *datastore.Key) error {
 }
 
 // SellTo marks a ticket as sold to the given email updating the corresponding
-// conference and saving all the modified elements to the datastore.
+// conference and its daily sales and saving all the modified elements to the
+// datastore, emitting an EventTicketSold event.
 func (t *Ticket) SellTo(ctx appengine.Context, email string) error {
+	// The user profile is loaded outside of the transaction, since loading
+	// it queries the tickets of the user. Buying a ticket registers the user.
+	up, err := CreateUserProfile(ctx, email)
+	if err != nil {
+		return fmt.Errorf("load user profile: %v", err)
+	}
+
 	// All done in a single transaction, to avoid data races.
-	return datastore.RunInTransaction(ctx, func(c appengine.Context) error {
+	return RunInTransaction(ctx, func(ctx appengine.Context) error {
+		if err := datastore.Get(ctx, t.key, t); err != nil {
+			return fmt.Errorf("load ticket: %v", err)
+		}
 		if t.State != TicketAvailable {
-			return fmt.Errorf("cannot sell a %v ticket", t.State)
+			return ErrTicketUnavailable
 		}
 
 		conf, err := loadConference(ctx, t.key.Parent())
@@ -214,23 +604,59 @@ func (t *Ticket) SellTo(ctx appengine.Context, email string) error {
 			return fmt.Errorf("load ticket's conference: %v", err)
 		}
 
-		up, err := LoadUserProfile(ctx, email)
-		if err != nil {
-			return fmt.Errorf("load user profile: %v", err)
-		}
-
 		conf.TixAvailable--
 		t.State = TicketSold
 		t.Owner = up.MainEmail
 
-		if t.save(ctx, conf.key); err != nil {
+		if err := t.save(ctx, conf.key); err != nil {
 			return fmt.Errorf("save ticket: %v", err)
 		}
-		if conf.Save(ctx); err != nil {
+		if err := conf.put(ctx); err != nil {
 			return fmt.Errorf("save conference: %v", err)
 		}
-		return nil
-	}, nil)
+		if err := countSale(ctx, conf.key, true, up.Topics); err != nil {
+			return err
+		}
+		return emit(ctx, conf.key, EventTicketSold, ticketEvent{t.ID(), conf.ID(), t})
+	})
+}
+
+// Cancel makes a sold ticket available again, updating the corresponding
+// conference and its daily sales and saving all the modified elements to the
+// datastore, emitting an EventTicketCancelled event.
+func (t *Ticket) Cancel(ctx appengine.Context) error {
+	return RunInTransaction(ctx, func(ctx appengine.Context) error {
+		if err := datastore.Get(ctx, t.key, t); err != nil {
+			return fmt.Errorf("load ticket: %v", err)
+		}
+		if t.State != TicketSold {
+			return ErrTicketNotSold
+		}
+
+		conf, err := loadConference(ctx, t.key.Parent())
+		if err != nil {
+			return fmt.Errorf("load ticket's conference: %v", err)
+		}
+
+		owner := t.Owner
+		conf.TixAvailable++
+		t.State = TicketAvailable
+		t.Owner = ""
+
+		if err := t.save(ctx, conf.key); err != nil {
+			return fmt.Errorf("save ticket: %v", err)
+		}
+		if err := conf.put(ctx); err != nil {
+			return fmt.Errorf("save conference: %v", err)
+		}
+		if err := countSale(ctx, conf.key, false, nil); err != nil {
+			return err
+		}
+		return emit(ctx, conf.key, EventTicketCancelled, struct {
+			ticketEvent
+			PreviousOwner string `json:"previous_owner"`
+		}{ticketEvent{t.ID(), conf.ID(), t}, owner})
+	})
 }
 
 // AvailableTickets loads all the tickets that have State TicketAvailable for the
@@ -252,6 +678,56 @@ func (conf *Conference) AvailableTickets(ctx appengine.Context) ([]Ticket, error
 	return ts, nil
 }
 
+// A TicketPage is a page of the tickets of a conference.
+type TicketPage struct {
+	Tickets []Ticket
+	// Next is an opaque cursor to the next page, empty if this is the last one.
+	Next string
+}
+
+// AvailableTicketsPage loads at most limit of the tickets that have State
+// TicketAvailable for the conference, starting at the given cursor. An empty
+// cursor starts at the beginning of the results.
+func (conf *Conference) AvailableTicketsPage(ctx appengine.Context, cursor string, limit int) (*TicketPage, error) {
+	q := datastore.NewQuery(TicketKind).
+		Ancestor(conf.key).
+		Filter("State =", TicketAvailable).
+		Order("Number")
+	if len(cursor) > 0 {
+		c, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Start(c)
+	}
+
+	page := &TicketPage{}
+	it := q.Limit(limit + 1).Run(ctx)
+	for len(page.Tickets) < limit {
+		var t Ticket
+		k, err := it.Next(&t)
+		if err == datastore.Done {
+			return page, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("load tickets: %v", err)
+		}
+		t.key = k
+		page.Tickets = append(page.Tickets, t)
+	}
+
+	// Check whether there's a next page peeking one more ticket.
+	next, err := it.Cursor()
+	if err != nil {
+		return nil, fmt.Errorf("get cursor: %v", err)
+	}
+	if _, err := it.Next(&Ticket{}); err == datastore.Done {
+		return page, nil
+	}
+	page.Next = next.String()
+	return page, nil
+}
+
 // An Announcement is a message to be displayed to all the users of the
 // application. Only the newest Announcement is normally displayed.
 type Announcement struct {
@@ -268,17 +744,25 @@ func NewAnnouncement(msg string) *Announcement {
 	}
 }
 
-// Save saves the Announcement to both datastore and memcache.
-// Memcache errors are logged and ignored.
+// Save saves the Announcement to both datastore and memcache, emitting an
+// EventAnnouncementPublished event.
+// Memcache is only set once the announcement is committed, after the
+// outermost transaction if Save is called in one. Memcache errors are logged
+// and ignored.
 func (a *Announcement) Save(ctx appengine.Context) error {
-	k := datastore.NewKey(ctx, AnnouncementKind, "", 0, nil)
-	if _, err := datastore.Put(ctx, k, a); err != nil {
-		return err
-	}
-	if err := a.memcacheSet(ctx); err != nil {
-		ctx.Errorf("memcache set: %v", err)
-	}
-	return nil
+	return RunInTransaction(ctx, func(ctx appengine.Context) error {
+		k := datastore.NewKey(ctx, AnnouncementKind, "", 0, nil)
+		k, err := datastore.Put(ctx, k, a)
+		if err != nil {
+			return err
+		}
+		afterCommit(ctx, func(ctx appengine.Context) {
+			if err := a.memcacheSet(ctx); err != nil {
+				ctx.Errorf("memcache set: %v", err)
+			}
+		})
+		return emit(ctx, k, EventAnnouncementPublished, a)
+	})
 }
 
 // memcacheSet sets a as the latests announcement in memcache.
@@ -323,10 +807,14 @@ type UserProfile struct {
 	Topics     []string
 	MainEmail  string
 	NotifEmail string
+	TimeZone   string // IANA time zone the dates are shown in, UTC if empty
 
 	tickets []Ticket
 }
 
+// Tickets returns all the tickets the user has acquired.
+func (u *UserProfile) Tickets() []Ticket { return u.tickets }
+
 // InterestedIn returns true if the user has declared an interest on the given topic.
 func (u *UserProfile) InterestedIn(topic string) bool {
 	for _, t := range u.Topics {
@@ -351,14 +839,18 @@ func (u *UserProfile) Attending() []string {
 }
 
 // LoadUserProfile loads a user profile from the datastore given an email.
-// If the user profile is not found a new one is created and stored in the datastore.
+// If the user profile is not found an empty one is returned, which isn't
+// saved until Save or CreateUserProfile are called.
 func LoadUserProfile(ctx appengine.Context, email string) (*UserProfile, error) {
 	var up UserProfile
 	k := datastore.NewKey(ctx, UserKind, email, 0, nil)
 	err := datastore.Get(ctx, k, &up)
 	if err == datastore.ErrNoSuchEntity {
 		up.MainEmail = email
-		return &up, up.Save(ctx)
+		return &up, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	ks, err := datastore.NewQuery(TicketKind).Filter("Owner =", email).GetAll(ctx, &up.tickets)
@@ -372,12 +864,88 @@ func LoadUserProfile(ctx appengine.Context, email string) (*UserProfile, error)
 	return &up, nil
 }
 
-// Save save a UserProfile to the datastore.
+// CreateUserProfile saves an empty user profile for the given email, unless
+// there's one already, and loads it.
+func CreateUserProfile(ctx appengine.Context, email string) (*UserProfile, error) {
+	err := RunInTransaction(ctx, func(ctx appengine.Context) error {
+		k := datastore.NewKey(ctx, UserKind, email, 0, nil)
+		err := datastore.Get(ctx, k, &UserProfile{})
+		if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		up := &UserProfile{MainEmail: email}
+		if _, err := datastore.Put(ctx, k, up); err != nil {
+			return err
+		}
+		return emit(ctx, k, EventProfileUpdated, profileEvent{up.changed(&UserProfile{})})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create user profile: %v", err)
+	}
+	return LoadUserProfile(ctx, email)
+}
+
+// changed returns the names of the fields of the profile that differ from
+// the ones of old, as they're named in the events.
+func (up *UserProfile) changed(old *UserProfile) []string {
+	var fs []string
+	if up.Name != old.Name {
+		fs = append(fs, "name")
+	}
+	if !reflect.DeepEqual(up.Topics, old.Topics) && len(up.Topics)+len(old.Topics) > 0 {
+		fs = append(fs, "topics")
+	}
+	if up.MainEmail != old.MainEmail {
+		fs = append(fs, "main_email")
+	}
+	if up.NotifEmail != old.NotifEmail {
+		fs = append(fs, "notification_email")
+	}
+	if up.TimeZone != old.TimeZone {
+		fs = append(fs, "time_zone")
+	}
+	return fs
+}
+
+// UserTimeZone returns the time zone chosen by the user with the given email,
+// or an empty string if none was chosen.
+func UserTimeZone(ctx appengine.Context, email string) (string, error) {
+	var up UserProfile
+	k := datastore.NewKey(ctx, UserKind, email, 0, nil)
+	err := datastore.Get(ctx, k, &up)
+	if err == datastore.ErrNoSuchEntity {
+		return "", nil
+	}
+	return up.TimeZone, err
+}
+
+// Save save a UserProfile to the datastore, emitting an EventProfileUpdated
+// event with the fields that changed.
 func (up *UserProfile) Save(ctx appengine.Context) error {
 	if len(up.MainEmail) == 0 {
-		return fmt.Errorf("cannot save user profile without email")
+		return invalid("cannot save user profile without email")
 	}
-	k := datastore.NewKey(ctx, UserKind, up.MainEmail, 0, nil)
-	_, err := datastore.Put(ctx, k, up)
-	return err
+	if _, err := LoadLocation(up.TimeZone); err != nil {
+		return invalid("bad time zone %q: %v", up.TimeZone, err)
+	}
+	topics := make([]string, 0, len(up.Topics))
+	for _, t := range up.Topics {
+		t, err := resolveTerm(ctx, TopicKind, t, true)
+		if err != nil {
+			return err
+		}
+		topics = append(topics, t)
+	}
+	up.Topics = uniqueTerms(topics)
+	return RunInTransaction(ctx, func(ctx appengine.Context) error {
+		k := datastore.NewKey(ctx, UserKind, up.MainEmail, 0, nil)
+		var old UserProfile
+		if err := datastore.Get(ctx, k, &old); err != nil && err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		if _, err := datastore.Put(ctx, k, up); err != nil {
+			return err
+		}
+		return emit(ctx, k, EventProfileUpdated, profileEvent{up.changed(&old)})
+	})
 }
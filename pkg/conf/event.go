@@ -0,0 +1,323 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"appengine"
+	"appengine/datastore"
+	"appengine/taskqueue"
+)
+
+const (
+	// Datastore kinds
+	EventKind      = "Event"
+	CheckpointKind = "EventCheckpoint"
+
+	// The handler for EventProcessPath must call ProcessEvents. A task to
+	// that path is queued on the default queue every time an event is
+	// recorded, but calling it periodically is recommended to recover from
+	// failures.
+	EventProcessPath = "/processevents"
+
+	// eventSettle is how old an event needs to be before it's consumed.
+	// Events are read with eventually consistent queries, so the newest
+	// ones may not be found yet.
+	eventSettle = 10 * time.Second
+
+	// eventWindow is how much later than its time an event can be found.
+	// The time is set before the transaction commits, and transactions can
+	// last up to a minute, so an event may be committed after newer ones
+	// were consumed. The consumers look for events this much older than
+	// the newest one they processed, skipping the ones they did process.
+	eventWindow = 2 * time.Minute
+
+	// eventBatch is the maximum number of events consumed by each consumer
+	// on every call to ProcessEvents.
+	eventBatch = 100
+)
+
+// Event types recorded on the outbox.
+const (
+	EventConferenceCreated     = "conference.created"
+	EventConferenceUpdated     = "conference.updated"
+	EventConferenceApproved    = "conference.approved"
+	EventTicketsCreated        = "tickets.created"
+	EventTicketSold            = "ticket.sold"
+	EventTicketCancelled       = "ticket.cancelled"
+	EventAnnouncementPublished = "announcement.published"
+	EventProfileUpdated        = "profile.updated"
+	EventMessageAdded          = "message.added"
+	EventVenueSaved            = "venue.saved"
+	EventTermSaved             = "term.saved"
+	EventTermMerged            = "term.merged"
+)
+
+// EventTypes lists all the event types.
+var EventTypes = []string{
+	EventConferenceCreated,
+	EventConferenceUpdated,
+	EventConferenceApproved,
+	EventTicketsCreated,
+	EventTicketSold,
+	EventTicketCancelled,
+	EventAnnouncementPublished,
+	EventProfileUpdated,
+	EventMessageAdded,
+	EventVenueSaved,
+	EventTermSaved,
+	EventTermMerged,
+}
+
+// An Event records a change of state of the models in this package.
+// Events are appended to the outbox in the same transaction as the change
+// they describe, as children of the entity group that changed.
+type Event struct {
+	Type string
+	Time time.Time
+	Data []byte `datastore:",noindex"` // JSON encoded data of the event
+
+	key *datastore.Key
+}
+
+// ID returns a unique identifier for the event.
+func (e *Event) ID() string { return e.key.Encode() }
+
+// MarshalJSON encodes the event as a JSON object with its id, type, time and
+// data.
+func (e *Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID   string          `json:"id"`
+		Type string          `json:"type"`
+		Time time.Time       `json:"time"`
+		Data json.RawMessage `json:"data"`
+	}{e.ID(), e.Type, e.Time, e.Data})
+}
+
+// confEvent is the data of the events about a conference.
+type confEvent struct {
+	ID string `json:"id"`
+	*Conference
+}
+
+// profileEvent is the data of the events about a user profile. It only has
+// the names of the fields changed, since profiles contain personal data. The
+// profile is the parent of the event.
+type profileEvent struct {
+	Changed []string `json:"changed"`
+}
+
+// ticketEvent is the data of the events about a ticket.
+type ticketEvent struct {
+	ID           string `json:"id"`
+	ConferenceID string `json:"conference_id"`
+	*Ticket
+}
+
+// txContext marks the contexts of transactions started by RunInTransaction.
+type txContext struct {
+	appengine.Context
+	queued    bool                      // whether a task to process events has been queued
+	committed []func(appengine.Context) // to call once committed, see afterCommit
+}
+
+// RunInTransaction runs f in a cross-group transaction. If ctx is already a
+// transaction context obtained from RunInTransaction, f runs as part of that
+// transaction instead, so operations of this package can be composed
+// atomically.
+func RunInTransaction(ctx appengine.Context, f func(appengine.Context) error) error {
+	if _, ok := ctx.(*txContext); ok {
+		return f(ctx)
+	}
+	var tx *txContext
+	err := datastore.RunInTransaction(ctx, func(tc appengine.Context) error {
+		// Each attempt starts over, forgetting what the failed ones did.
+		tx = &txContext{Context: tc}
+		return f(tx)
+	}, &datastore.TransactionOptions{XG: true})
+	if err != nil {
+		return err
+	}
+	for _, f := range tx.committed {
+		f(ctx)
+	}
+	return nil
+}
+
+// afterCommit calls f with a context out of the transaction once the
+// outermost transaction started by RunInTransaction commits, or right away if
+// ctx isn't a transaction. It's for the changes that can't be rolled back,
+// like the ones to memcache.
+func afterCommit(ctx appengine.Context, f func(appengine.Context)) {
+	if tx, ok := ctx.(*txContext); ok {
+		tx.committed = append(tx.committed, f)
+		return
+	}
+	f(ctx)
+}
+
+// emit appends an event of the given type to the outbox as a child of
+// parent, and queues a task to process it unless one has already been queued
+// in the same transaction.
+// It must be called in the transaction that performs the change.
+func emit(ctx appengine.Context, parent *datastore.Key, typ string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("encode %v event: %v", typ, err)
+	}
+	e := &Event{Type: typ, Time: time.Now(), Data: b}
+	k := datastore.NewIncompleteKey(ctx, EventKind, parent)
+	if _, err := datastore.Put(ctx, k, e); err != nil {
+		return fmt.Errorf("save %v event: %v", typ, err)
+	}
+
+	// Transactions can only queue a few tasks, one is enough to process
+	// all their events.
+	if tx, ok := ctx.(*txContext); ok {
+		if tx.queued {
+			return nil
+		}
+		tx.queued = true
+	}
+	task := &taskqueue.Task{
+		Path:   EventProcessPath,
+		Method: "POST",
+		Delay:  eventSettle,
+	}
+	if _, err := taskqueue.Add(ctx, task, ""); err != nil {
+		return fmt.Errorf("queue %v event: %v", typ, err)
+	}
+	return nil
+}
+
+// A ConsumerFunc processes an event. Returning an error stops the processing
+// of events by the consumer, and the event will be processed again later.
+type ConsumerFunc func(ctx appengine.Context, e *Event) error
+
+var (
+	consumersMu sync.RWMutex
+	consumers   = make(map[string]ConsumerFunc)
+)
+
+// RegisterConsumer registers a consumer with the given name to be run by
+// ProcessEvents. The name identifies the checkpoint of the consumer, so it
+// shouldn't change across versions of the application.
+func RegisterConsumer(name string, f ConsumerFunc) {
+	consumersMu.Lock()
+	defer consumersMu.Unlock()
+	if _, ok := consumers[name]; ok {
+		panic("conf: consumer " + name + " registered twice")
+	}
+	consumers[name] = f
+}
+
+// ProcessEvents runs all the registered consumers on the pending events.
+// All consumers are run even if some of them fail, the returned error
+// describes the failures.
+func ProcessEvents(ctx appengine.Context) error {
+	consumersMu.RLock()
+	defer consumersMu.RUnlock()
+
+	var errs []error
+	for name, f := range consumers {
+		if _, err := Consume(ctx, name, eventBatch, f); err != nil {
+			errs = append(errs, fmt.Errorf("%v: %v", name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("process events: %v", errs)
+	}
+	return nil
+}
+
+// checkpoint is the position of a consumer in the outbox: the time of the
+// newest event it processed, and the keys and times of the events it
+// processed within eventWindow of it.
+type checkpoint struct {
+	Time  time.Time
+	Keys  []*datastore.Key `datastore:",noindex"`
+	Times []time.Time      `datastore:",noindex"`
+}
+
+// processed records that the event was processed, forgetting the events
+// that fell out of the window.
+func (cp *checkpoint) processed(e *Event) {
+	if e.Time.After(cp.Time) {
+		cp.Time = e.Time
+	}
+	from := cp.Time.Add(-eventWindow)
+	var keys []*datastore.Key
+	var times []time.Time
+	for i, t := range cp.Times {
+		if !t.Before(from) {
+			keys = append(keys, cp.Keys[i])
+			times = append(times, t)
+		}
+	}
+	cp.Keys, cp.Times = append(keys, e.key), append(times, e.Time)
+}
+
+// Consume calls f on up to n of the events the consumer with the given name
+// hasn't processed yet, from older to newer. The checkpoint of the consumer
+// is saved after each event is processed, so events are processed at least
+// once: an event could be processed again if saving the checkpoint fails.
+// Events committed after newer ones were processed are still processed, if
+// they're found within eventWindow, which transactions can't exceed.
+// Consume returns the number of events processed.
+func Consume(ctx appengine.Context, name string, n int, f ConsumerFunc) (int, error) {
+	cpKey := datastore.NewKey(ctx, CheckpointKind, name, 0, nil)
+	var cp checkpoint
+	err := datastore.Get(ctx, cpKey, &cp)
+	if _, ok := err.(*datastore.ErrFieldMismatch); ok {
+		// Checkpoints saved by older versions have the key of the last
+		// event instead, the events since their time are processed again.
+		err = nil
+	}
+	if err != nil && err != datastore.ErrNoSuchEntity {
+		return 0, fmt.Errorf("load checkpoint: %v", err)
+	}
+	seen := make(map[string]bool)
+	for _, k := range cp.Keys {
+		seen[k.Encode()] = true
+	}
+
+	q := datastore.NewQuery(EventKind).
+		Filter("Time <", time.Now().Add(-eventSettle)).
+		Order("Time")
+	if !cp.Time.IsZero() {
+		q = q.Filter("Time >=", cp.Time.Add(-eventWindow))
+	}
+	it := q.Run(ctx)
+	done := 0
+	for done < n {
+		var e Event
+		k, err := it.Next(&e)
+		if err == datastore.Done {
+			break
+		}
+		if err != nil {
+			return done, fmt.Errorf("load event: %v", err)
+		}
+		e.key = k
+		if seen[k.Encode()] {
+			continue
+		}
+
+		if err := f(ctx, &e); err != nil {
+			return done, fmt.Errorf("process event %v: %v", e.ID(), err)
+		}
+		done++
+
+		cp.processed(&e)
+		if _, err := datastore.Put(ctx, cpKey, &cp); err != nil {
+			return done, fmt.Errorf("save checkpoint: %v", err)
+		}
+	}
+	return done, nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package conf
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"appengine"
+	"appengine/datastore"
+)
+
+// SortFields lists the fields conference searches can be sorted by.
+var SortFields = []string{
+	"Name",
+	"City",
+	"Topic",
+	"StartDate",
+	"EndDate",
+	"MaxAttendees",
+	"TixAvailable",
+}
+
+// maxScan is the maximum number of conferences read from the datastore to
+// fill a page of search results. Filters that can't be applied by the
+// datastore could otherwise need to scan all the conferences.
+const maxScan = 1000
+
+// A ConfFilter describes a search of conferences.
+// The zero value matches all the conferences sorted by StartDate.
+type ConfFilter struct {
+	Topic     string    // only conferences on this topic or its subtopics
+	City      string    // only conferences in this city
+	From      time.Time // only conferences starting at or after this date
+	To        time.Time // only conferences starting before this date
+	Available bool      // only conferences with available tickets
+	Text      string    // words that must all appear in the conference text
+	Sort      string    // field to sort by, one of SortFields
+	Desc      bool      // sort in descending order
+}
+
+// query translates the filter into a datastore query and a function matching
+// the conditions the query can't express.
+//
+// Datastore queries allow inequality filters on a single property, which
+// has to be the first sort order, so the date range is only part of the
+// query when sorting by StartDate and the availability when sorting by
+// TixAvailable. The equality filters combined with a sort order need the
+// composite indexes listed in index.yaml.
+func (f *ConfFilter) query() (*datastore.Query, func(*Conference) bool, error) {
+	sort := f.Sort
+	if len(sort) == 0 {
+		sort = "StartDate"
+	}
+	valid := false
+	for _, s := range SortFields {
+		valid = valid || s == sort
+	}
+	if !valid {
+		return nil, nil, fmt.Errorf("can't sort by %q", sort)
+	}
+
+	q := datastore.NewQuery(ConferenceKind)
+	if len(f.Topic) > 0 {
+		q = q.Filter("AllTopics =", f.Topic)
+	}
+	if len(f.City) > 0 {
+		q = q.Filter("City =", f.City)
+	}
+
+	inDates, inAvailable := false, false
+	switch sort {
+	case "StartDate":
+		if !f.From.IsZero() {
+			q = q.Filter("StartDate >=", f.From)
+		}
+		if !f.To.IsZero() {
+			q = q.Filter("StartDate <", f.To)
+		}
+		inDates = true
+	case "TixAvailable":
+		if f.Available {
+			q = q.Filter("TixAvailable >", 0)
+		}
+		inAvailable = true
+	}
+	if f.Desc {
+		q = q.Order("-" + sort)
+	} else {
+		q = q.Order(sort)
+	}
+
+	words := strings.Fields(strings.ToLower(f.Text))
+	match := func(c *Conference) bool {
+		// Already part of the query, but not when matching the results of
+		// a full-text search.
+		if len(f.Topic) > 0 && !c.HasTopic(f.Topic) {
+			return false
+		}
+		if len(f.City) > 0 && c.City != f.City {
+			return false
+		}
+		if !inDates {
+			if !f.From.IsZero() && c.StartDate.Before(f.From) {
+				return false
+			}
+			if !f.To.IsZero() && !c.StartDate.Before(f.To) {
+				return false
+			}
+		}
+		if !inAvailable && f.Available && c.TixAvailable <= 0 {
+			return false
+		}
+		text := strings.ToLower(c.Name + " " + c.Description + " " + c.City + " " + strings.Join(c.AllTopics, " "))
+		for _, w := range words {
+			if !strings.Contains(text, w) {
+				return false
+			}
+		}
+		return true
+	}
+	return q, match, nil
+}
+
+// SearchConferences returns a page with at most limit of the conferences
+// matching the filter, starting at the given cursor. An empty cursor starts
+// at the beginning of the results.
+//
+// Pages can contain fewer than limit conferences even if more conferences
+// match the filter, when many of the conferences read don't match it.
+func SearchConferences(ctx appengine.Context, f *ConfFilter, cursor string, limit int) (*ConfPage, error) {
+	q, match, err := f.query()
+	if err != nil {
+		return nil, err
+	}
+	return loadConfPage(ctx, q, cursor, limit, match)
+}
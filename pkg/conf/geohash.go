@@ -0,0 +1,112 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package conf
+
+import (
+	"math"
+	"strings"
+)
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// geohashPrecision is the number of characters of the geohashes stored.
+const geohashPrecision = 9
+
+// earthRadius is the mean radius of the Earth in km.
+const earthRadius = 6371.0
+
+// geohash encodes a position with the given number of characters.
+func geohash(lat, lng float64, precision int) string {
+	latR, lngR := [2]float64{-90, 90}, [2]float64{-180, 180}
+	var b strings.Builder
+	bit, ch, even := 0, 0, true
+	for b.Len() < precision {
+		r, v := &latR, lat
+		if even {
+			r, v = &lngR, lng
+		}
+		mid := (r[0] + r[1]) / 2
+		ch <<= 1
+		if v >= mid {
+			ch |= 1
+			r[0] = mid
+		} else {
+			r[1] = mid
+		}
+		even = !even
+		if bit++; bit == 5 {
+			b.WriteByte(geohashAlphabet[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return b.String()
+}
+
+// geohashCell returns the height and width in degrees of the cells of
+// geohashes with the given number of characters.
+func geohashCell(precision int) (dLat, dLng float64) {
+	bits := 5 * precision
+	lngBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 180 / math.Pow(2, float64(latBits)), 360 / math.Pow(2, float64(lngBits))
+}
+
+// geohashesAround returns the prefixes of the geohashes of the cell that
+// contains the position and its eight neighbours, with cells at least as big
+// as the given distance in km. All the positions within that distance are in
+// one of the cells. If no cells are big enough, it returns the empty prefix,
+// which all the geohashes have.
+func geohashesAround(lat, lng, km float64) []string {
+	// Degrees of longitude shrink with the latitude, so the cells are the
+	// narrowest at the latitude within the distance farthest from the equator.
+	far := math.Abs(lat) + km/earthRadius*180/math.Pi
+	if far >= 90 {
+		// A pole is within the distance.
+		return []string{""}
+	}
+	precision := 0
+	for p := geohashPrecision; p >= 1; p-- {
+		dLat, dLng := geohashCell(p)
+		w := dLng * math.Pi / 180 * earthRadius * math.Cos(far*math.Pi/180)
+		h := dLat * math.Pi / 180 * earthRadius
+		if w >= km && h >= km {
+			precision = p
+			break
+		}
+	}
+	if precision == 0 {
+		return []string{""}
+	}
+
+	dLat, dLng := geohashCell(precision)
+	seen := make(map[string]bool)
+	var hs []string
+	for _, i := range []float64{-1, 0, 1} {
+		for _, j := range []float64{-1, 0, 1} {
+			la := math.Max(-90, math.Min(90, lat+i*dLat))
+			ln := lng + j*dLng
+			if ln < -180 {
+				ln += 360
+			} else if ln >= 180 {
+				ln -= 360
+			}
+			h := geohash(la, ln, precision)
+			if !seen[h] {
+				seen[h] = true
+				hs = append(hs, h)
+			}
+		}
+	}
+	return hs
+}
+
+// distance returns the great circle distance in km between two positions.
+func distance(lat1, lng1, lat2, lng2 float64) float64 {
+	rad := math.Pi / 180
+	dLat, dLng := (lat2-lat1)*rad, (lng2-lng1)*rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
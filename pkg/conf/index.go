@@ -0,0 +1,159 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"appengine"
+	"appengine/datastore"
+
+	"github.com/campoy/goconf/pkg/search"
+)
+
+// ConfIndexName is the name of the full-text index of conferences.
+const ConfIndexName = "conferences"
+
+// OpenConfIndex returns the full-text index of conferences. It defaults to
+// the App Engine search index named ConfIndexName on App Engine, and to an
+// index kept in memory elsewhere, and can be replaced.
+var OpenConfIndex = openConfIndex
+
+func init() {
+	RegisterConsumer("search", indexConfEvent)
+}
+
+// indexConfEvent updates the full-text index when a conference changes.
+func indexConfEvent(ctx appengine.Context, e *Event) error {
+	switch e.Type {
+	case EventConferenceCreated, EventConferenceUpdated, EventConferenceApproved:
+	default:
+		return nil
+	}
+
+	var data struct{ ID string }
+	if err := json.Unmarshal(e.Data, &data); err != nil {
+		return fmt.Errorf("decode event: %v", err)
+	}
+	c, err := LoadConference(ctx, data.ID)
+	if err != nil {
+		return fmt.Errorf("load conference: %v", err)
+	}
+	return IndexConference(ctx, c)
+}
+
+// IndexConference adds the conference to the full-text index, or updates it.
+func IndexConference(ctx appengine.Context, c *Conference) error {
+	idx, err := OpenConfIndex(ctx)
+	if err != nil {
+		return err
+	}
+	return indexConference(idx, c)
+}
+
+func indexConference(idx search.Index, c *Conference) error {
+	doc := search.Document{
+		"Name":        c.Name,
+		"Description": c.Description,
+		"City":        c.City,
+		"Topic":       strings.Join(c.AllTopics, ", "),
+	}
+	if err := idx.Put(c.ID(), doc); err != nil {
+		return fmt.Errorf("index conference: %v", err)
+	}
+	return nil
+}
+
+// ReindexConferences adds at most batch conferences, starting at the given
+// cursor, to the full-text index, so the conferences saved before they were
+// indexed can be found. It returns the cursor to the next conferences, empty
+// if there are no more.
+func ReindexConferences(ctx appengine.Context, cursor string, batch int) (string, error) {
+	idx, err := OpenConfIndex(ctx)
+	if err != nil {
+		return "", err
+	}
+	q := datastore.NewQuery(ConferenceKind)
+	if len(cursor) > 0 {
+		c, err := decodeCursor(cursor)
+		if err != nil {
+			return "", err
+		}
+		q = q.Start(c)
+	}
+	it := q.Run(ctx)
+	for i := 0; i < batch; i++ {
+		var c Conference
+		k, err := it.Next(&c)
+		if err == datastore.Done {
+			return "", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("load conferences: %v", err)
+		}
+		c.setKey(k)
+		if err := indexConference(idx, &c); err != nil {
+			return "", err
+		}
+	}
+	next, err := it.Cursor()
+	if err != nil {
+		return "", fmt.Errorf("get cursor: %v", err)
+	}
+	return next.String(), nil
+}
+
+// A ConfHit is a conference matching a full-text search.
+type ConfHit struct {
+	*Conference
+	Score   float64
+	Snippet string   // text of the conference around the first match
+	Terms   []string // stemmed terms of the query, to highlight the snippet
+}
+
+// SearchConferenceText returns at most limit conferences matching the text of
+// the filter in the full-text index, the most relevant first. Conferences not
+// matching the rest of the filter are skipped, and its sort order ignored.
+func SearchConferenceText(ctx appengine.Context, f *ConfFilter, limit int) ([]ConfHit, error) {
+	idx, err := OpenConfIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Some of the hits could be filtered out, get more than needed.
+	hits, err := idx.Search(f.Text, 3*limit)
+	if err != nil {
+		return nil, fmt.Errorf("search %q: %v", f.Text, err)
+	}
+
+	rest := *f
+	rest.Text, rest.Sort = "", ""
+	_, match, err := rest.query()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(hits))
+	for i, h := range hits {
+		ids[i] = h.ID
+	}
+	cs, err := NewLoader(ctx).Conferences(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []ConfHit
+	for i, h := range hits {
+		if len(res) == limit {
+			break
+		}
+		// The conference could have been deleted after being indexed.
+		if c := cs[i]; c != nil && match(c) {
+			res = append(res, ConfHit{c, h.Score, h.Snippet, h.Terms})
+		}
+	}
+	return res, nil
+}
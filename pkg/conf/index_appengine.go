@@ -0,0 +1,19 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+//go:build appengine
+// +build appengine
+
+package conf
+
+import (
+	"appengine"
+
+	"github.com/campoy/goconf/pkg/search"
+)
+
+// openConfIndex opens the App Engine search index named ConfIndexName.
+func openConfIndex(ctx appengine.Context) (search.Index, error) {
+	return search.AppEngine(ctx, ConfIndexName)
+}
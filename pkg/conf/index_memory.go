@@ -0,0 +1,22 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+//go:build !appengine
+// +build !appengine
+
+package conf
+
+import (
+	"appengine"
+
+	"github.com/campoy/goconf/pkg/search"
+)
+
+// memoryConfIndex is the full-text index of conferences outside App Engine.
+var memoryConfIndex = search.NewMemory()
+
+// openConfIndex returns the index of conferences kept in memory.
+func openConfIndex(ctx appengine.Context) (search.Index, error) {
+	return memoryConfIndex, nil
+}
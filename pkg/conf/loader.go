@@ -0,0 +1,193 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package conf
+
+import (
+	"fmt"
+	"sync"
+
+	"appengine"
+	"appengine/datastore"
+)
+
+// A Loader loads conferences, user profiles and pages of available tickets
+// for the duration of a request, caching them and reading together from the
+// datastore the entities requested in the same call. Loading the entities for
+// a whole list at once avoids one datastore read per element of the list.
+//
+// The profiles returned by a Loader don't contain the tickets of the user,
+// use LoadUserProfile for that.
+type Loader struct {
+	ctx appengine.Context
+
+	mu       sync.Mutex
+	confs    map[string]*Conference
+	profiles map[string]*UserProfile
+	tickets  map[ticketPageKey]*TicketPage
+}
+
+// ticketPageKey identifies a page of the available tickets of a conference.
+type ticketPageKey struct {
+	conf, cursor string
+	limit        int
+}
+
+// NewLoader returns a new Loader with an empty cache.
+func NewLoader(ctx appengine.Context) *Loader {
+	return &Loader{
+		ctx:      ctx,
+		confs:    make(map[string]*Conference),
+		profiles: make(map[string]*UserProfile),
+		tickets:  make(map[ticketPageKey]*TicketPage),
+	}
+}
+
+// PrimeConferences adds the given conferences to the cache.
+func (l *Loader) PrimeConferences(cs []Conference) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := range cs {
+		l.confs[cs[i].ID()] = &cs[i]
+	}
+}
+
+// Conference loads a conference given its unique id. It returns nil if there's
+// no conference with that id.
+func (l *Loader) Conference(id string) (*Conference, error) {
+	cs, err := l.Conferences([]string{id})
+	if err != nil {
+		return nil, err
+	}
+	return cs[0], nil
+}
+
+// Conferences loads the conferences with the given ids, reading the ones
+// not in the cache with a single datastore call. The conferences not found,
+// or whose id is malformed, are nil.
+func (l *Loader) Conferences(ids []string) ([]*Conference, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var (
+		missing []string
+		ks      []*datastore.Key
+	)
+	for _, id := range ids {
+		if _, ok := l.confs[id]; ok {
+			continue
+		}
+		k, err := datastore.DecodeKey(id)
+		if err != nil || k.Kind() != ConferenceKind {
+			l.confs[id] = nil
+			continue
+		}
+		missing = append(missing, id)
+		ks = append(ks, k)
+	}
+
+	if len(ks) > 0 {
+		cs := make([]Conference, len(ks))
+		err := datastore.GetMulti(l.ctx, ks, cs)
+		merr, _ := err.(appengine.MultiError)
+		if err != nil && merr == nil {
+			return nil, fmt.Errorf("load conferences: %v", err)
+		}
+		for i, id := range missing {
+			if merr != nil && merr[i] != nil {
+				if merr[i] != datastore.ErrNoSuchEntity {
+					return nil, fmt.Errorf("load conference %v: %v", id, merr[i])
+				}
+				l.confs[id] = nil
+				continue
+			}
+			cs[i].setKey(ks[i])
+			l.confs[id] = &cs[i]
+		}
+	}
+
+	res := make([]*Conference, len(ids))
+	for i, id := range ids {
+		res[i] = l.confs[id]
+	}
+	return res, nil
+}
+
+// Profile loads the profile of the user with the given email. If the user
+// has no profile, a profile with only the email set is returned.
+func (l *Loader) Profile(email string) (*UserProfile, error) {
+	ups, err := l.Profiles([]string{email})
+	if err != nil {
+		return nil, err
+	}
+	return ups[0], nil
+}
+
+// Profiles loads the profiles of the users with the given emails, reading
+// the ones not in the cache with a single datastore call. Users without a
+// profile get a profile with only the email set.
+func (l *Loader) Profiles(emails []string) ([]*UserProfile, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var (
+		missing []string
+		ks      []*datastore.Key
+	)
+	for _, email := range emails {
+		if _, ok := l.profiles[email]; ok {
+			continue
+		}
+		missing = append(missing, email)
+		ks = append(ks, datastore.NewKey(l.ctx, UserKind, email, 0, nil))
+	}
+
+	if len(ks) > 0 {
+		ups := make([]UserProfile, len(ks))
+		err := datastore.GetMulti(l.ctx, ks, ups)
+		merr, _ := err.(appengine.MultiError)
+		if err != nil && merr == nil {
+			return nil, fmt.Errorf("load profiles: %v", err)
+		}
+		for i, email := range missing {
+			if merr != nil && merr[i] != nil {
+				if merr[i] != datastore.ErrNoSuchEntity {
+					return nil, fmt.Errorf("load profile %v: %v", email, merr[i])
+				}
+				ups[i] = UserProfile{MainEmail: email}
+			}
+			l.profiles[email] = &ups[i]
+		}
+	}
+
+	res := make([]*UserProfile, len(emails))
+	for i, email := range emails {
+		res[i] = l.profiles[email]
+	}
+	return res, nil
+}
+
+// AvailableTickets loads a page of the available tickets of the conference,
+// as Conference.AvailableTicketsPage does. Queries can't be read together as
+// entities are, so the pages are cached instead: the tickets of a conference
+// are queried once however many times it's listed in the request.
+func (l *Loader) AvailableTickets(c *Conference, cursor string, limit int) (*TicketPage, error) {
+	k := ticketPageKey{c.ID(), cursor, limit}
+	l.mu.Lock()
+	p, ok := l.tickets[k]
+	l.mu.Unlock()
+	if ok {
+		return p, nil
+	}
+	// The lock isn't held while querying, so the tickets of different
+	// conferences are queried concurrently.
+	p, err := c.AvailableTicketsPage(l.ctx, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	l.tickets[k] = p
+	l.mu.Unlock()
+	return p, nil
+}
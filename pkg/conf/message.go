@@ -0,0 +1,171 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package conf
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	netmail "net/mail"
+	"strings"
+	"time"
+
+	"appengine"
+	"appengine/datastore"
+	"appengine/mail"
+)
+
+// MessageKind is the datastore kind for the messages exchanged with the
+// organizer of a conference.
+const MessageKind = "Message"
+
+// replyPrefix precedes the reply token of the conference in the local part of
+// the reply-to address of the messages sent to organizers.
+const replyPrefix = "conf-"
+
+// replyTokenLen is the number of random bytes in a reply token. Tokens are
+// hex encoded, so they survive mail servers changing the case of addresses
+// and the local parts stay under the limit of 64 characters.
+const replyTokenLen = 16
+
+// A Message is an email exchanged between the reviewers of a conference and
+// its organizer.
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string `datastore:",noindex"`
+	Time    time.Time
+}
+
+// replyTo returns the address replies about the conference should be sent to
+// so they are threaded back to it. The domain is the one the application
+// receives email on, such as "go-conf.appspotmail.com".
+//
+// The address contains a random token of the conference, generated the first
+// time, so it can't be guessed from the public id of the conference.
+func (conf *Conference) replyTo(ctx appengine.Context, domain string) (string, error) {
+	if len(conf.ReplyToken) == 0 {
+		b := make([]byte, replyTokenLen)
+		if _, err := rand.Read(b); err != nil {
+			return "", fmt.Errorf("generate reply token: %v", err)
+		}
+		token := hex.EncodeToString(b)
+		err := RunInTransaction(ctx, func(ctx appengine.Context) error {
+			c, err := loadConference(ctx, conf.key)
+			if err != nil {
+				return fmt.Errorf("load conference: %v", err)
+			}
+			if len(c.ReplyToken) > 0 {
+				token = c.ReplyToken
+				return nil
+			}
+			c.ReplyToken = token
+			return c.put(ctx)
+		})
+		if err != nil {
+			return "", err
+		}
+		conf.ReplyToken = token
+	}
+	return replyPrefix + conf.ReplyToken + "@" + domain, nil
+}
+
+// ConferenceForReply loads the conference a reply sent to an address
+// generated by replyTo belongs to. It fails unless the reply comes from the
+// organizer of the conference.
+func ConferenceForReply(ctx appengine.Context, to, from string) (*Conference, error) {
+	a, err := netmail.ParseAddress(to)
+	if err != nil {
+		return nil, fmt.Errorf("bad address %q: %v", to, err)
+	}
+	local := strings.ToLower(a.Address)
+	if i := strings.LastIndex(local, "@"); i >= 0 {
+		local = local[:i]
+	}
+	token := strings.TrimPrefix(local, replyPrefix)
+	if token == local || len(token) != 2*replyTokenLen {
+		return nil, fmt.Errorf("address %q is not a conference address", to)
+	}
+
+	var confs []Conference
+	ks, err := datastore.NewQuery(ConferenceKind).
+		Filter("ReplyToken =", token).
+		Limit(1).
+		GetAll(ctx, &confs)
+	if err != nil {
+		return nil, fmt.Errorf("get conference: %v", err)
+	}
+	if len(ks) == 0 {
+		return nil, fmt.Errorf("no conference for address %q", to)
+	}
+	conf := &confs[0]
+	conf.setKey(ks[0])
+
+	sender, err := netmail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("bad sender %q: %v", from, err)
+	}
+	if !strings.EqualFold(sender.Address, conf.Organizer) {
+		return nil, fmt.Errorf("%q is not the organizer of %v", sender.Address, conf.Name)
+	}
+	return conf, nil
+}
+
+// AddMessage appends a message to the conversation with the organizer of the
+// conference, emitting an EventMessageAdded event.
+func (conf *Conference) AddMessage(ctx appengine.Context, m *Message) error {
+	return RunInTransaction(ctx, func(ctx appengine.Context) error {
+		k := datastore.NewIncompleteKey(ctx, MessageKind, conf.key)
+		if _, err := datastore.Put(ctx, k, m); err != nil {
+			return fmt.Errorf("save message: %v", err)
+		}
+		return emit(ctx, conf.key, EventMessageAdded, struct {
+			ConferenceID string `json:"conference_id"`
+			*Message
+		}{conf.ID(), m})
+	})
+}
+
+// Messages loads the conversation with the organizer of the conference,
+// sorted from older to newer.
+func (conf *Conference) Messages(ctx appengine.Context) ([]Message, error) {
+	var ms []Message
+	_, err := datastore.NewQuery(MessageKind).
+		Ancestor(conf.key).
+		Order("Time").
+		GetAll(ctx, &ms)
+	if err != nil {
+		return nil, fmt.Errorf("load messages: %v", err)
+	}
+	return ms, nil
+}
+
+// MailOrganizer sends an email to the organizer of the conference and adds it
+// to the conversation. The reply-to address of the email is the one returned
+// by replyTo for the given domain, so the answers are threaded back.
+func (conf *Conference) MailOrganizer(ctx appengine.Context, sender, domain, subject, body string) error {
+	replyTo, err := conf.replyTo(ctx, domain)
+	if err != nil {
+		return err
+	}
+	msg := &mail.Message{
+		Sender:  sender,
+		ReplyTo: replyTo,
+		To:      []string{conf.Organizer},
+		Subject: subject,
+		Body:    body,
+	}
+	if err := mail.Send(ctx, msg); err != nil {
+		return fmt.Errorf("send mail: %v", err)
+	}
+	return conf.AddMessage(ctx, &Message{
+		From:    sender,
+		To:      conf.Organizer,
+		Subject: subject,
+		Body:    body,
+		Time:    time.Now(),
+	})
+}
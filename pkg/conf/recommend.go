@@ -0,0 +1,376 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package conf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"appengine"
+	"appengine/datastore"
+)
+
+// RecommendationKind is the datastore kind of the recommendations precomputed
+// for a user, stored with the email of the user as key name.
+const RecommendationKind = "Recommendation"
+
+// Weights of the signals used to score the conferences recommended to a user.
+const (
+	topicWeight       = 3.0 // per topic of interest of the user
+	cityWeight        = 2.0 // times the fraction of past tickets in the city
+	coAttendeesWeight = 5.0 // times the similarity with each other attendee
+)
+
+// A Recommendation is an upcoming conference recommended to a user, with a
+// higher score for better recommendations and the reasons for the score.
+type Recommendation struct {
+	*Conference
+	Score   float64
+	Reasons []string
+}
+
+// A Recommender scores the upcoming conferences for users. It caches the
+// tickets it reads, so it should be used to recommend conferences to many
+// users in the same request, and then discarded.
+type Recommender struct {
+	ctx      appengine.Context
+	upcoming []Conference
+	loader   *Loader
+
+	confsByOwner  map[string][]string // conference ids of the tickets of a user
+	ownersByConf  map[string][]string // owners of the tickets of a conference
+	ownersLoaded  map[string]bool
+	ticketsLoaded map[string]bool
+}
+
+// NewRecommender returns a Recommender of the conferences that haven't
+// started yet and have tickets available.
+func NewRecommender(ctx appengine.Context) (*Recommender, error) {
+	r := &Recommender{
+		ctx:           ctx,
+		loader:        NewLoader(ctx),
+		confsByOwner:  make(map[string][]string),
+		ownersByConf:  make(map[string][]string),
+		ownersLoaded:  make(map[string]bool),
+		ticketsLoaded: make(map[string]bool),
+	}
+	p, err := SearchConferences(ctx, &ConfFilter{From: time.Now(), Available: true}, "", maxScan)
+	if err != nil {
+		return nil, fmt.Errorf("load upcoming conferences: %v", err)
+	}
+	r.upcoming = p.Conferences
+	r.loader.PrimeConferences(r.upcoming)
+	return r, nil
+}
+
+// ticketConfs returns the ids of the conferences the user has tickets for.
+func (r *Recommender) ticketConfs(email string) ([]string, error) {
+	if r.ticketsLoaded[email] {
+		return r.confsByOwner[email], nil
+	}
+	ks, err := datastore.NewQuery(TicketKind).Filter("Owner =", email).KeysOnly().GetAll(r.ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("load tickets of %v: %v", email, err)
+	}
+	ids := []string{}
+	seen := make(map[string]bool)
+	for _, k := range ks {
+		id := k.Parent().Encode()
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	r.ticketsLoaded[email] = true
+	r.confsByOwner[email] = ids
+	return ids, nil
+}
+
+// attendees returns the emails of the owners of tickets for the conference.
+func (r *Recommender) attendees(id string) ([]string, error) {
+	if r.ownersLoaded[id] {
+		return r.ownersByConf[id], nil
+	}
+	k, err := datastore.DecodeKey(id)
+	if err != nil {
+		return nil, fmt.Errorf("wrong key %q: %v", id, err)
+	}
+	var ts []Ticket
+	if _, err := datastore.NewQuery(TicketKind).Ancestor(k).GetAll(r.ctx, &ts); err != nil {
+		return nil, fmt.Errorf("load tickets of %v: %v", id, err)
+	}
+	emails := []string{}
+	for _, t := range ts {
+		if t.State == TicketSold && len(t.Owner) > 0 {
+			emails = append(emails, t.Owner)
+		}
+	}
+	r.ownersLoaded[id] = true
+	r.ownersByConf[id] = emails
+	return emails, nil
+}
+
+// similarity returns the Jaccard index of two sets of conference ids.
+func similarity(a, b []string) float64 {
+	in := make(map[string]bool, len(a))
+	for _, id := range a {
+		in[id] = true
+	}
+	common := 0
+	for _, id := range b {
+		if in[id] {
+			common++
+		}
+	}
+	if union := len(a) + len(b) - common; union > 0 {
+		return float64(common) / float64(union)
+	}
+	return 0
+}
+
+// Recommend returns at most n upcoming conferences recommended to the user,
+// the best first. The conferences are scored by the topics of interest of
+// the user, the cities of the conferences the user has tickets for, and the
+// conferences the users with tickets for the same conferences are attending.
+// Conferences the user already has tickets for are not recommended.
+func (r *Recommender) Recommend(up *UserProfile, n int) ([]Recommendation, error) {
+	attended, err := r.ticketConfs(up.MainEmail)
+	if err != nil {
+		return nil, err
+	}
+	going := make(map[string]bool, len(attended))
+	for _, id := range attended {
+		going[id] = true
+	}
+
+	// Cities of the conferences the user has tickets for.
+	confs, err := r.loader.Conferences(attended)
+	if err != nil {
+		return nil, err
+	}
+	var found []*Conference
+	for _, c := range confs {
+		if c != nil {
+			found = append(found, c)
+		}
+	}
+	cities := make(map[string]float64)
+	for _, c := range found {
+		cities[c.City] += 1 / float64(len(found))
+	}
+
+	// Similarity of the user with the other attendees of those conferences.
+	similar := make(map[string]float64)
+	for _, id := range attended {
+		emails, err := r.attendees(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, email := range emails {
+			if _, ok := similar[email]; ok || email == up.MainEmail {
+				continue
+			}
+			theirs, err := r.ticketConfs(email)
+			if err != nil {
+				return nil, err
+			}
+			similar[email] = similarity(attended, theirs)
+		}
+	}
+	coScores := make(map[string]float64)
+	for email, sim := range similar {
+		for _, id := range r.confsByOwner[email] {
+			coScores[id] += sim
+		}
+	}
+
+	var recs []Recommendation
+	for i := range r.upcoming {
+		c := &r.upcoming[i]
+		if going[c.ID()] {
+			continue
+		}
+		rec := Recommendation{Conference: c}
+		for _, t := range up.Topics {
+			if c.HasTopic(t) {
+				rec.Score += topicWeight
+				rec.Reasons = append(rec.Reasons, fmt.Sprintf("You are interested in %v", t))
+			}
+		}
+		if f := cities[c.City]; f > 0 {
+			rec.Score += cityWeight * f
+			rec.Reasons = append(rec.Reasons, fmt.Sprintf("You went to conferences in %v", c.City))
+		}
+		if s := coScores[c.ID()]; s > 0 {
+			rec.Score += coAttendeesWeight * s
+			rec.Reasons = append(rec.Reasons, "People who went to your conferences are going")
+		}
+		if rec.Score > 0 {
+			recs = append(recs, rec)
+		}
+	}
+	sort.Sort(byScore(recs))
+	if len(recs) > n {
+		recs = recs[:n]
+	}
+	return recs, nil
+}
+
+// byScore sorts recommendations from higher to lower score, and then by
+// start date.
+type byScore []Recommendation
+
+func (s byScore) Len() int      { return len(s) }
+func (s byScore) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byScore) Less(i, j int) bool {
+	if s[i].Score != s[j].Score {
+		return s[i].Score > s[j].Score
+	}
+	return s[i].StartDate.Before(s[j].StartDate)
+}
+
+// savedRecommendations are the recommendations precomputed for a user.
+type savedRecommendations struct {
+	ConfIDs []string
+	Scores  []float64
+	Reasons []string `datastore:",noindex"` // reasons of each conference joined by newlines
+	Time    time.Time
+}
+
+// SaveRecommendations saves the recommendations for the user with the given
+// email, replacing the previous ones.
+func SaveRecommendations(ctx appengine.Context, email string, recs []Recommendation) error {
+	var s savedRecommendations
+	for _, rec := range recs {
+		s.ConfIDs = append(s.ConfIDs, rec.ID())
+		s.Scores = append(s.Scores, rec.Score)
+		s.Reasons = append(s.Reasons, strings.Join(rec.Reasons, "\n"))
+	}
+	s.Time = time.Now()
+	k := datastore.NewKey(ctx, RecommendationKind, email, 0, nil)
+	if _, err := datastore.Put(ctx, k, &s); err != nil {
+		return fmt.Errorf("save recommendations: %v", err)
+	}
+	return nil
+}
+
+// LoadRecommendations loads at most n of the recommendations precomputed for
+// the user with the given email, skipping the conferences that were deleted or
+// started since. The returned slice is nil if none were precomputed.
+func LoadRecommendations(ctx appengine.Context, email string, n int) ([]Recommendation, error) {
+	var s savedRecommendations
+	err := datastore.Get(ctx, datastore.NewKey(ctx, RecommendationKind, email, 0, nil), &s)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load recommendations: %v", err)
+	}
+
+	ks := make([]*datastore.Key, len(s.ConfIDs))
+	for i, id := range s.ConfIDs {
+		if ks[i], err = datastore.DecodeKey(id); err != nil {
+			return nil, fmt.Errorf("wrong key %q: %v", id, err)
+		}
+	}
+	cs := make([]Conference, len(ks))
+	err = datastore.GetMulti(ctx, ks, cs)
+	errs, _ := err.(appengine.MultiError)
+	if err != nil && errs == nil {
+		return nil, fmt.Errorf("load conferences: %v", err)
+	}
+	if errs == nil {
+		errs = make(appengine.MultiError, len(ks))
+	}
+
+	recs := []Recommendation{}
+	for i := range cs {
+		if len(recs) == n {
+			break
+		}
+		if errs[i] == datastore.ErrNoSuchEntity || cs[i].StartDate.Before(time.Now()) {
+			continue
+		}
+		if errs[i] != nil {
+			return nil, fmt.Errorf("load conference %v: %v", s.ConfIDs[i], errs[i])
+		}
+		cs[i].setKey(ks[i])
+		rec := Recommendation{Conference: &cs[i], Score: s.Scores[i]}
+		if i < len(s.Reasons) && len(s.Reasons[i]) > 0 {
+			rec.Reasons = strings.Split(s.Reasons[i], "\n")
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+// PrecomputeUserRecommendations computes and saves the best n
+// recommendations for the user with the given email.
+func PrecomputeUserRecommendations(ctx appengine.Context, email string, n int) error {
+	r, err := NewRecommender(ctx)
+	if err != nil {
+		return err
+	}
+	up, err := LoadUserProfile(ctx, email)
+	if err != nil {
+		return err
+	}
+	recs, err := r.Recommend(up, n)
+	if err != nil {
+		return fmt.Errorf("recommend to %v: %v", email, err)
+	}
+	return SaveRecommendations(ctx, email, recs)
+}
+
+// PrecomputeRecommendations computes and saves the best n recommendations
+// for at most batch users, starting at the given cursor, and calls f, if not
+// nil, with the profile and recommendations of each of them.
+// It returns the cursor to the next users, empty if there are no more users.
+func PrecomputeRecommendations(ctx appengine.Context, cursor string, batch, n int,
+	f func(up *UserProfile, recs []Recommendation) error) (string, error) {
+	r, err := NewRecommender(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	q := datastore.NewQuery(UserKind)
+	if len(cursor) > 0 {
+		c, err := decodeCursor(cursor)
+		if err != nil {
+			return "", err
+		}
+		q = q.Start(c)
+	}
+	it := q.Run(ctx)
+	for i := 0; i < batch; i++ {
+		var up UserProfile
+		_, err := it.Next(&up)
+		if err == datastore.Done {
+			return "", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("load profiles: %v", err)
+		}
+		recs, err := r.Recommend(&up, n)
+		if err != nil {
+			return "", fmt.Errorf("recommend to %v: %v", up.MainEmail, err)
+		}
+		if err := SaveRecommendations(ctx, up.MainEmail, recs); err != nil {
+			return "", err
+		}
+		if f != nil {
+			if err := f(&up, recs); err != nil {
+				return "", err
+			}
+		}
+	}
+	next, err := it.Cursor()
+	if err != nil {
+		return "", fmt.Errorf("get cursor: %v", err)
+	}
+	return next.String(), nil
+}
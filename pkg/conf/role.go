@@ -0,0 +1,170 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package conf
+
+import (
+	"fmt"
+	"time"
+
+	"appengine"
+	"appengine/datastore"
+)
+
+// GrantKind is the datastore kind of the roles granted to users.
+const GrantKind = "Grant"
+
+// A Role is a set of permissions granted to a user.
+type Role string
+
+const (
+	RoleAttendee    Role = "attendee"     // every logged in user
+	RoleOrganizer   Role = "organizer"    // can schedule conferences
+	RoleReviewer    Role = "reviewer"     // can review conferences
+	RoleAdmin       Role = "admin"        // has all the permissions
+	RoleCoOrganizer Role = "co-organizer" // can manage a given conference
+)
+
+// Roles lists the roles that can be granted.
+var Roles = []Role{RoleOrganizer, RoleReviewer, RoleAdmin, RoleCoOrganizer}
+
+// A Permission allows a user to perform an operation.
+type Permission string
+
+const (
+	PermBuyTicket          Permission = "ticket.buy"
+	PermScheduleConference Permission = "conference.schedule"
+	PermEditConference     Permission = "conference.edit"
+	PermViewSales          Permission = "conference.sales"
+	PermReviewConference   Permission = "conference.review"
+	PermManageSite         Permission = "site.manage"
+	PermGrantRoles         Permission = "roles.grant"
+)
+
+// rolePermissions lists the permissions of each role. The permissions of the
+// co-organizer role are only on the conference it was granted on, and the
+// organizer of a conference has them too.
+var rolePermissions = map[Role][]Permission{
+	RoleAttendee:    {PermBuyTicket},
+	RoleOrganizer:   {PermBuyTicket, PermScheduleConference},
+	RoleReviewer:    {PermBuyTicket, PermReviewConference},
+	RoleCoOrganizer: {PermEditConference, PermViewSales},
+	RoleAdmin: {
+		PermBuyTicket, PermScheduleConference, PermEditConference,
+		PermViewSales, PermReviewConference, PermManageSite, PermGrantRoles,
+	},
+}
+
+func (r Role) has(p Permission) bool {
+	for _, rp := range rolePermissions[r] {
+		if rp == p {
+			return true
+		}
+	}
+	return false
+}
+
+// A Grant gives a role to a user. Co-organizer grants are on a conference.
+type Grant struct {
+	Email     string
+	Role      Role
+	ConfID    string // conference of a co-organizer grant
+	GrantedBy string
+	Time      time.Time
+}
+
+// ID returns a unique identifier for the grant.
+func (g *Grant) ID() string { return g.Email + " " + string(g.Role) + " " + g.ConfID }
+
+func grantKey(ctx appengine.Context, id string) *datastore.Key {
+	return datastore.NewKey(ctx, GrantKind, id, 0, nil)
+}
+
+// Save saves the grant in the datastore.
+func (g *Grant) Save(ctx appengine.Context) error {
+	if len(g.Email) == 0 {
+		return fmt.Errorf("grants need an email")
+	}
+	if _, ok := rolePermissions[g.Role]; !ok || g.Role == RoleAttendee {
+		return fmt.Errorf("role %q can't be granted", g.Role)
+	}
+	if (g.Role == RoleCoOrganizer) != (len(g.ConfID) > 0) {
+		return fmt.Errorf("only co-organizers are granted on a conference")
+	}
+	if len(g.ConfID) > 0 {
+		if _, err := LoadConference(ctx, g.ConfID); err != nil {
+			return fmt.Errorf("load conference: %v", err)
+		}
+	}
+	if _, err := datastore.Put(ctx, grantKey(ctx, g.ID()), g); err != nil {
+		return fmt.Errorf("save grant: %v", err)
+	}
+	return nil
+}
+
+// RevokeGrant deletes the grant with the given id.
+func RevokeGrant(ctx appengine.Context, id string) error {
+	return datastore.Delete(ctx, grantKey(ctx, id))
+}
+
+// LoadGrants loads all the grants, sorted by email.
+func LoadGrants(ctx appengine.Context) ([]Grant, error) {
+	var gs []Grant
+	if _, err := datastore.NewQuery(GrantKind).Order("Email").GetAll(ctx, &gs); err != nil {
+		return nil, fmt.Errorf("load grants: %v", err)
+	}
+	return gs, nil
+}
+
+// UserGrants loads the grants of the user with the given email.
+func UserGrants(ctx appengine.Context, email string) ([]Grant, error) {
+	var gs []Grant
+	if _, err := datastore.NewQuery(GrantKind).Filter("Email =", email).GetAll(ctx, &gs); err != nil {
+		return nil, fmt.Errorf("load grants of %v: %v", email, err)
+	}
+	return gs, nil
+}
+
+// Can returns true if the user with the given email has the permission. The
+// permissions on conferences are checked on the given conference, and they
+// are never granted for a nil one.
+// Every user has the permissions of RoleAttendee, and the organizer of a
+// conference those of RoleCoOrganizer on it.
+func Can(ctx appengine.Context, email string, p Permission, c *Conference) (bool, error) {
+	if RoleAttendee.has(p) {
+		return true, nil
+	}
+	if c != nil && c.Organizer == email && RoleCoOrganizer.has(p) {
+		return true, nil
+	}
+	gs, err := UserGrants(ctx, email)
+	if err != nil {
+		return false, err
+	}
+	for _, g := range gs {
+		if g.Role == RoleCoOrganizer && (c == nil || g.ConfID != c.ID()) {
+			continue
+		}
+		if g.Role.has(p) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CoOrganizedConferences returns the ids of the conferences the user with the
+// given email has been granted the co-organizer role on.
+func CoOrganizedConferences(ctx appengine.Context, email string) ([]string, error) {
+	gs, err := UserGrants(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, g := range gs {
+		if g.Role == RoleCoOrganizer {
+			ids = append(ids, g.ConfID)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,172 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package conf
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"appengine"
+	"appengine/datastore"
+)
+
+// DailySalesKind is the datastore kind of the ticket sales of a conference
+// in a day, stored as children of the conference with the day as key name.
+const DailySalesKind = "DailySales"
+
+// projectionDays is the number of days of sales used to project when a
+// conference will sell out.
+const projectionDays = 7
+
+// DailySales counts the tickets of a conference sold and cancelled in a day,
+// in UTC, together with the topics of interest of the buyers.
+type DailySales struct {
+	Day       time.Time
+	Sold      int
+	Cancelled int
+	// BuyerTopics and TopicCounts count the buyers interested in each topic
+	// when they bought the ticket.
+	BuyerTopics []string
+	TopicCounts []int
+}
+
+// countSale updates the sales of the day of the conference with the given key
+// with a sold ticket, if sold is true, or a cancelled one. The topics of the
+// buyer are counted for sold tickets.
+// It should be called in the transaction that sells or cancels the ticket.
+func countSale(ctx appengine.Context, confKey *datastore.Key, sold bool, topics []string) error {
+	day := time.Now().UTC().Truncate(24 * time.Hour)
+	k := datastore.NewKey(ctx, DailySalesKind, day.Format(DateLayout), 0, confKey)
+	var s DailySales
+	if err := datastore.Get(ctx, k, &s); err != nil && err != datastore.ErrNoSuchEntity {
+		return fmt.Errorf("load daily sales: %v", err)
+	}
+	s.Day = day
+	if !sold {
+		s.Cancelled++
+	} else {
+		s.Sold++
+		for _, t := range topics {
+			i := 0
+			for i < len(s.BuyerTopics) && s.BuyerTopics[i] != t {
+				i++
+			}
+			if i == len(s.BuyerTopics) {
+				s.BuyerTopics = append(s.BuyerTopics, t)
+				s.TopicCounts = append(s.TopicCounts, 0)
+			}
+			s.TopicCounts[i]++
+		}
+	}
+	if _, err := datastore.Put(ctx, k, &s); err != nil {
+		return fmt.Errorf("save daily sales: %v", err)
+	}
+	return nil
+}
+
+// A SalesDay is the sales of a day together with the net number of tickets
+// sold up to that day.
+type SalesDay struct {
+	DailySales
+	Total int
+}
+
+// A TopicCount is the number of buyers interested in a topic.
+type TopicCount struct {
+	Topic string
+	Count int
+}
+
+// A SalesReport summarizes the ticket sales of a conference.
+type SalesReport struct {
+	*Conference
+	Days        []SalesDay   // days with sales, from older to newer
+	Sold        int          // tickets currently sold
+	SellThrough float64      // percentage of the tickets sold
+	SoldOut     bool         // whether all the tickets are sold
+	SellOut     time.Time    // projected sell out date, zero if unknown
+	Topics      []TopicCount // topics of the buyers, the most common first
+}
+
+// LoadSalesReport loads the sales of the conference and computes its report.
+// The sell out date is projected from the net sales of the last days, and
+// it's unknown if there were no net sales in them.
+func LoadSalesReport(ctx appengine.Context, c *Conference) (*SalesReport, error) {
+	var ds []DailySales
+	_, err := datastore.NewQuery(DailySalesKind).Ancestor(c.key).Order("Day").GetAll(ctx, &ds)
+	if err != nil {
+		return nil, fmt.Errorf("load daily sales: %v", err)
+	}
+
+	r := &SalesReport{
+		Conference: c,
+		Sold:       c.MaxAttendees - c.TixAvailable,
+		SoldOut:    c.TixAvailable <= 0,
+	}
+	if c.MaxAttendees > 0 {
+		r.SellThrough = 100 * float64(r.Sold) / float64(c.MaxAttendees)
+	}
+
+	total := 0
+	topics := make(map[string]int)
+	for _, d := range ds {
+		total += d.Sold - d.Cancelled
+		r.Days = append(r.Days, SalesDay{d, total})
+		for i, t := range d.BuyerTopics {
+			topics[t] += d.TopicCounts[i]
+		}
+	}
+	for t, n := range topics {
+		r.Topics = append(r.Topics, TopicCount{t, n})
+	}
+	sort.Sort(byCount(r.Topics))
+
+	if r.SoldOut {
+		return r, nil
+	}
+	since := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -projectionDays+1)
+	net := 0
+	for _, d := range ds {
+		if !d.Day.Before(since) {
+			net += d.Sold - d.Cancelled
+		}
+	}
+	if net > 0 {
+		perDay := float64(net) / projectionDays
+		days := float64(c.TixAvailable) / perDay
+		r.SellOut = time.Now().Add(time.Duration(days * float64(24*time.Hour)))
+	}
+	return r, nil
+}
+
+// byCount sorts topic counts from higher to lower count, and then by topic.
+type byCount []TopicCount
+
+func (s byCount) Len() int      { return len(s) }
+func (s byCount) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byCount) Less(i, j int) bool {
+	if s[i].Count != s[j].Count {
+		return s[i].Count > s[j].Count
+	}
+	return s[i].Topic < s[j].Topic
+}
+
+// OrganizerConferences loads the conferences organized by the user with the
+// given email, sorted by start date.
+func OrganizerConferences(ctx appengine.Context, email string) ([]Conference, error) {
+	var cs []Conference
+	ks, err := datastore.NewQuery(ConferenceKind).
+		Filter("Organizer =", email).
+		Order("StartDate").
+		GetAll(ctx, &cs)
+	if err != nil {
+		return nil, fmt.Errorf("load conferences of %v: %v", email, err)
+	}
+	for i, k := range ks {
+		cs[i].setKey(k)
+	}
+	return cs, nil
+}
@@ -0,0 +1,485 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"appengine"
+	"appengine/datastore"
+	"appengine/memcache"
+)
+
+const (
+	// Datastore kinds of the taxonomies, used as the kind of their terms.
+	TopicKind = "Topic"
+	CityKind  = "City"
+
+	// taxonomyKind is the kind of the entity that is the parent of all the
+	// terms of a taxonomy, so they can be queried with strong consistency.
+	taxonomyKind = "Taxonomy"
+)
+
+// Default terms of the taxonomies, saved the first time they're loaded.
+var (
+	DefaultTopics = []string{
+		"Medical Innovations",
+		"Programming Languages",
+		"Web Technologies",
+		"Movie Making",
+	}
+	DefaultCities = []string{
+		"London",
+		"Chicago",
+		"San Francisco",
+		"Paris",
+	}
+)
+
+// A Term is an entry of a taxonomy, such as a conference topic or a city.
+// Archived terms can't be chosen for new conferences, and merged terms are
+// replaced by the term they were merged into.
+type Term struct {
+	Name       string
+	Archived   bool
+	MergedInto string // name of the term that replaces this one, if any
+}
+
+// Active returns true if the term can be chosen for conferences and profiles.
+func (t *Term) Active() bool { return !t.Archived && len(t.MergedInto) == 0 }
+
+// TopicSep separates the names of a topic and its parent topic, as in
+// "Programming Languages > Go".
+const TopicSep = " > "
+
+// TopicAncestors returns the given topics followed by all their ancestors,
+// without duplicates. The ancestors of "A > B > C" are "A > B" and "A".
+func TopicAncestors(topics ...string) []string {
+	var all []string
+	seen := make(map[string]bool)
+	for _, t := range topics {
+		for {
+			if !seen[t] {
+				seen[t] = true
+				all = append(all, t)
+			}
+			i := strings.LastIndex(t, TopicSep)
+			if i < 0 {
+				break
+			}
+			t = t[:i]
+		}
+	}
+	return all
+}
+
+func taxonomyKey(ctx appengine.Context, kind string) (*datastore.Key, error) {
+	if kind != TopicKind && kind != CityKind {
+		return nil, fmt.Errorf("unknown taxonomy %q", kind)
+	}
+	return datastore.NewKey(ctx, taxonomyKind, kind, 0, nil), nil
+}
+
+func termKey(ctx appengine.Context, kind, name string) (*datastore.Key, error) {
+	parent, err := taxonomyKey(ctx, kind)
+	if err != nil {
+		return nil, err
+	}
+	return datastore.NewKey(ctx, kind, name, 0, parent), nil
+}
+
+func termsMemcacheKey(kind string) string { return "Terms." + kind }
+
+// LoadTerms returns all the terms of the taxonomy of the given kind sorted by
+// name, from either memcache or the datastore. A taxonomy without terms is
+// initialized with its default terms.
+func LoadTerms(ctx appengine.Context, kind string) ([]Term, error) {
+	var ts []Term
+	if _, err := memcache.JSON.Get(ctx, termsMemcacheKey(kind), &ts); err == nil {
+		return ts, nil
+	}
+
+	parent, err := taxonomyKey(ctx, kind)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := datastore.NewQuery(kind).Ancestor(parent).GetAll(ctx, &ts); err != nil {
+		return nil, fmt.Errorf("load terms: %v", err)
+	}
+	if len(ts) == 0 {
+		if ts, err = seedTerms(ctx, kind); err != nil {
+			return nil, err
+		}
+	}
+
+	item := &memcache.Item{
+		Key:        termsMemcacheKey(kind),
+		Object:     ts,
+		Expiration: 1 * time.Hour,
+	}
+	if err := memcache.JSON.Set(ctx, item); err != nil {
+		ctx.Errorf("memcache set: %v", err)
+	}
+	return ts, nil
+}
+
+// seedTerms saves the default terms of the taxonomy of the given kind.
+func seedTerms(ctx appengine.Context, kind string) ([]Term, error) {
+	names := DefaultTopics
+	if kind == CityKind {
+		names = DefaultCities
+	}
+	ts := make([]Term, len(names))
+	ks := make([]*datastore.Key, len(names))
+	for i, name := range names {
+		ts[i].Name = name
+		k, err := termKey(ctx, kind, name)
+		if err != nil {
+			return nil, err
+		}
+		ks[i] = k
+	}
+	if _, err := datastore.PutMulti(ctx, ks, ts); err != nil {
+		return nil, fmt.Errorf("seed terms: %v", err)
+	}
+	return ts, nil
+}
+
+// ActiveTerms returns the names of the active terms of the taxonomy of the
+// given kind sorted by name.
+func ActiveTerms(ctx appengine.Context, kind string) ([]string, error) {
+	ts, err := LoadTerms(ctx, kind)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, t := range ts {
+		if t.Active() {
+			names = append(names, t.Name)
+		}
+	}
+	return names, nil
+}
+
+// resolveTerm returns the name of the term that should be used instead of the
+// given one, following merges, or an error if there's none. Archived terms
+// are accepted only if archived is true.
+func resolveTerm(ctx appengine.Context, kind, name string, archived bool) (string, error) {
+	ts, err := LoadTerms(ctx, kind)
+	if err != nil {
+		return "", err
+	}
+	byName := make(map[string]Term, len(ts))
+	for _, t := range ts {
+		byName[t.Name] = t
+	}
+	for i := 0; i <= len(ts); i++ {
+		t, ok := byName[name]
+		switch {
+		case !ok:
+			return "", invalid("unknown %v %q", strings.ToLower(kind), name)
+		case t.Archived && !archived:
+			return "", invalid("%v %q is archived", strings.ToLower(kind), name)
+		case len(t.MergedInto) == 0:
+			return name, nil
+		}
+		name = t.MergedInto
+	}
+	return "", fmt.Errorf("%v %q merged in a loop", strings.ToLower(kind), name)
+}
+
+// updateTerms runs f in a transaction with the terms of the taxonomy of the
+// given kind, saves the terms f returns, and emits an event of the given type
+// for each of the returned events. The cached terms are cleared once the
+// terms are committed, after the outermost transaction if updateTerms is
+// called in one, so the terms read before can't be cached again.
+func updateTerms(ctx appengine.Context, kind, typ string,
+	f func(ts map[string]*Term) ([]*Term, []termEvent, error)) error {
+	parent, err := taxonomyKey(ctx, kind)
+	if err != nil {
+		return err
+	}
+	return RunInTransaction(ctx, func(ctx appengine.Context) error {
+		var list []Term
+		if _, err := datastore.NewQuery(kind).Ancestor(parent).GetAll(ctx, &list); err != nil {
+			return fmt.Errorf("load terms: %v", err)
+		}
+		ts := make(map[string]*Term, len(list))
+		for i := range list {
+			ts[list[i].Name] = &list[i]
+		}
+		changed, events, err := f(ts)
+		if err != nil {
+			return err
+		}
+		ks := make([]*datastore.Key, len(changed))
+		for i, t := range changed {
+			ks[i] = datastore.NewKey(ctx, kind, t.Name, 0, parent)
+		}
+		if _, err := datastore.PutMulti(ctx, ks, changed); err != nil {
+			return fmt.Errorf("save terms: %v", err)
+		}
+		for _, e := range events {
+			if err := emit(ctx, parent, typ, e); err != nil {
+				return err
+			}
+		}
+		afterCommit(ctx, func(ctx appengine.Context) {
+			if err := memcache.Delete(ctx, termsMemcacheKey(kind)); err != nil && err != memcache.ErrCacheMiss {
+				ctx.Errorf("memcache delete: %v", err)
+			}
+		})
+		return nil
+	})
+}
+
+// A termEvent is the data of the events about terms.
+type termEvent struct {
+	Kind string
+	Name string
+	From string `json:",omitempty"`
+}
+
+// subterm returns true if the term with the given name is t or one of its
+// subtopics.
+func subterm(name, t string) bool {
+	return name == t || strings.HasPrefix(name, t+TopicSep)
+}
+
+// checkParent returns an error if the term with the given name is a subtopic
+// of a topic that is not active.
+func checkParent(kind string, ts map[string]*Term, name string) error {
+	i := strings.LastIndex(name, TopicSep)
+	if kind != TopicKind || i < 0 {
+		return nil
+	}
+	if p, ok := ts[name[:i]]; !ok || !p.Active() {
+		return fmt.Errorf("unknown parent topic %q", name[:i])
+	}
+	return nil
+}
+
+// CreateTerm adds a new term to the taxonomy of the given kind, emitting an
+// EventTermSaved event. The parent of a subtopic must exist.
+func CreateTerm(ctx appengine.Context, kind, name string) error {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		return fmt.Errorf("terms need a name")
+	}
+	return updateTerms(ctx, kind, EventTermSaved,
+		func(ts map[string]*Term) ([]*Term, []termEvent, error) {
+			if _, ok := ts[name]; ok {
+				return nil, nil, fmt.Errorf("%v %q already exists", strings.ToLower(kind), name)
+			}
+			if err := checkParent(kind, ts, name); err != nil {
+				return nil, nil, err
+			}
+			return []*Term{{Name: name}}, []termEvent{{Kind: kind, Name: name}}, nil
+		})
+}
+
+// ArchiveTerm archives or restores a term of the taxonomy of the given kind
+// and its subtopics, emitting an EventTermSaved event for each of them. The
+// conferences and profiles using the terms keep them.
+func ArchiveTerm(ctx appengine.Context, kind, name string, archived bool) error {
+	return updateTerms(ctx, kind, EventTermSaved,
+		func(ts map[string]*Term) ([]*Term, []termEvent, error) {
+			if _, ok := ts[name]; !ok {
+				return nil, nil, fmt.Errorf("unknown %v %q", strings.ToLower(kind), name)
+			}
+			if !archived {
+				if err := checkParent(kind, ts, name); err != nil {
+					return nil, nil, err
+				}
+			}
+			var changed []*Term
+			var events []termEvent
+			for _, t := range ts {
+				if subterm(t.Name, name) && len(t.MergedInto) == 0 {
+					t.Archived = archived
+					changed = append(changed, t)
+					events = append(events, termEvent{Kind: kind, Name: t.Name})
+				}
+			}
+			return changed, events, nil
+		})
+}
+
+// moveTerms renames or merges the term from into the term to, moving the
+// subtopics of from below to. The terms that don't exist yet are created.
+func moveTerms(kind string, ts map[string]*Term, from, to string) ([]*Term, []termEvent, error) {
+	if t, ok := ts[from]; !ok || !t.Active() {
+		return nil, nil, fmt.Errorf("unknown %v %q", strings.ToLower(kind), from)
+	}
+	if subterm(to, from) {
+		return nil, nil, fmt.Errorf("cannot move %v %q into %q", strings.ToLower(kind), from, to)
+	}
+	if err := checkParent(kind, ts, to); err != nil {
+		return nil, nil, err
+	}
+	var changed []*Term
+	var events []termEvent
+	for name, t := range ts {
+		if !subterm(name, from) || !t.Active() {
+			continue
+		}
+		dest := to + name[len(from):]
+		d, ok := ts[dest]
+		if !ok {
+			d = &Term{Name: dest}
+		}
+		// Terms that were archived or merged away are revived.
+		d.Archived, d.MergedInto = false, ""
+		t.MergedInto = dest
+		changed = append(changed, t, d)
+		events = append(events, termEvent{kind, dest, name})
+	}
+	return changed, events, nil
+}
+
+// RenameTerm renames a term of the taxonomy of the given kind and its
+// subtopics. The new name must not be in use.
+// The conferences and profiles using the old names are migrated to the new
+// ones asynchronously, see MergeTerms.
+func RenameTerm(ctx appengine.Context, kind, from, to string) error {
+	to = strings.TrimSpace(to)
+	if len(to) == 0 {
+		return fmt.Errorf("terms need a name")
+	}
+	return updateTerms(ctx, kind, EventTermMerged,
+		func(ts map[string]*Term) ([]*Term, []termEvent, error) {
+			if _, ok := ts[to]; ok {
+				return nil, nil, fmt.Errorf("%v %q already exists", strings.ToLower(kind), to)
+			}
+			return moveTerms(kind, ts, from, to)
+		})
+}
+
+// MergeTerms merges a term of the taxonomy of the given kind into another
+// existing term, emitting an EventTermMerged event. Its subtopics are moved
+// below the other term, merged with the subtopics with the same names.
+// When the events are processed, the conferences and profiles using the
+// merged terms are updated to use the other ones.
+func MergeTerms(ctx appengine.Context, kind, from, to string) error {
+	return updateTerms(ctx, kind, EventTermMerged,
+		func(ts map[string]*Term) ([]*Term, []termEvent, error) {
+			if t, ok := ts[to]; !ok || !t.Active() {
+				return nil, nil, fmt.Errorf("unknown %v %q", strings.ToLower(kind), to)
+			}
+			return moveTerms(kind, ts, from, to)
+		})
+}
+
+func init() {
+	RegisterConsumer("taxonomy", migrateTermEvent)
+}
+
+// migrateTermEvent updates the conferences and profiles using a term that was
+// renamed or merged into another one.
+// Updating an entity again is harmless, so processing an event twice is too.
+func migrateTermEvent(ctx appengine.Context, e *Event) error {
+	if e.Type != EventTermMerged {
+		return nil
+	}
+	var te termEvent
+	if err := json.Unmarshal(e.Data, &te); err != nil {
+		return fmt.Errorf("decode event: %v", err)
+	}
+
+	// Conferences saved before having many topics only have the Topic field.
+	fields := []string{"Topics", "Topic"}
+	if te.Kind == CityKind {
+		fields = []string{"City"}
+	}
+	var ks []*datastore.Key
+	for _, f := range fields {
+		fks, err := datastore.NewQuery(ConferenceKind).Filter(f+" =", te.From).KeysOnly().GetAll(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("find conferences: %v", err)
+		}
+		ks = append(ks, fks...)
+	}
+	for _, k := range ks {
+		err := RunInTransaction(ctx, func(ctx appengine.Context) error {
+			c, err := loadConference(ctx, k)
+			if err != nil {
+				return err
+			}
+			c.normalizeTopics()
+			switch {
+			case te.Kind == TopicKind && c.HasTopic(te.From):
+				c.Topics = replaceTerm(c.Topics, te.From, te.Name)
+			case te.Kind == CityKind && c.City == te.From:
+				c.City = te.Name
+			default:
+				return nil
+			}
+			if err := c.put(ctx); err != nil {
+				return err
+			}
+			return emit(ctx, c.key, EventConferenceUpdated, confEvent{c.ID(), c})
+		})
+		if err != nil {
+			return fmt.Errorf("migrate conference: %v", err)
+		}
+	}
+
+	if te.Kind != TopicKind {
+		return nil
+	}
+	ks, err := datastore.NewQuery(UserKind).Filter("Topics =", te.From).KeysOnly().GetAll(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("find profiles: %v", err)
+	}
+	for _, k := range ks {
+		err := RunInTransaction(ctx, func(ctx appengine.Context) error {
+			var up UserProfile
+			if err := datastore.Get(ctx, k, &up); err != nil {
+				return err
+			}
+			if !up.InterestedIn(te.From) {
+				return nil
+			}
+			up.Topics = replaceTerm(up.Topics, te.From, te.Name)
+			if _, err := datastore.Put(ctx, k, &up); err != nil {
+				return err
+			}
+			return emit(ctx, k, EventProfileUpdated, profileEvent{[]string{"topics"}})
+		})
+		if err != nil {
+			return fmt.Errorf("migrate profile: %v", err)
+		}
+	}
+	return nil
+}
+
+// replaceTerm returns the names with from replaced by to, keeping its position
+// and removing duplicates.
+func replaceTerm(names []string, from, to string) []string {
+	res := make([]string, len(names))
+	for i, n := range names {
+		if n == from {
+			n = to
+		}
+		res[i] = n
+	}
+	return uniqueTerms(res)
+}
+
+// uniqueTerms returns the names without duplicates, in the same order.
+func uniqueTerms(names []string) []string {
+	res := []string{}
+	seen := make(map[string]bool)
+	for _, n := range names {
+		if !seen[n] {
+			seen[n] = true
+			res = append(res, n)
+		}
+	}
+	return res
+}
@@ -0,0 +1,202 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package conf
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"appengine"
+	"appengine/datastore"
+)
+
+// VenueKind is the datastore kind for venues.
+const VenueKind = "Venue"
+
+// A Venue is a place where conferences are held.
+type Venue struct {
+	Name     string
+	Address  string
+	Lat, Lng float64
+	Capacity int
+	TimeZone string // IANA time zone name, such as "Europe/London"
+	Geohash  string // computed from Lat and Lng when saved
+
+	key *datastore.Key
+}
+
+// ID returns a unique identifier for any Venue that has already
+// been saved in the datastore.
+func (v *Venue) ID() string { return v.key.Encode() }
+
+// validate returns an error if the venue can't be saved.
+func (v *Venue) validate() error {
+	if len(v.Name) == 0 {
+		return invalid("venues need a name")
+	}
+	if v.Lat < -90 || v.Lat > 90 || v.Lng < -180 || v.Lng > 180 {
+		return invalid("bad position %v,%v", v.Lat, v.Lng)
+	}
+	if v.Capacity <= 0 {
+		return invalid("bad capacity %v", v.Capacity)
+	}
+	if _, err := LoadLocation(v.TimeZone); err != nil {
+		return invalid("bad time zone %q: %v", v.TimeZone, err)
+	}
+	return nil
+}
+
+// Save saves a venue into datastore, emitting an EventVenueSaved event.
+// The capacity of a venue can't be lowered below the attendees of the
+// conferences not finished yet held in it.
+func (v *Venue) Save(ctx appengine.Context) error {
+	if err := v.validate(); err != nil {
+		return err
+	}
+	if v.key != nil {
+		cs, err := upcomingConferences(ctx, v.ID(), time.Now())
+		if err != nil {
+			return err
+		}
+		for _, c := range cs {
+			if c.MaxAttendees > v.Capacity {
+				return fmt.Errorf("%v has %v attendees, more than the capacity %v",
+					c.Name, c.MaxAttendees, v.Capacity)
+			}
+		}
+	}
+	v.Geohash = geohash(v.Lat, v.Lng, geohashPrecision)
+	return RunInTransaction(ctx, func(ctx appengine.Context) error {
+		k := v.key
+		if k == nil {
+			k = datastore.NewIncompleteKey(ctx, VenueKind, nil)
+		}
+		k, err := datastore.Put(ctx, k, v)
+		if err != nil {
+			return fmt.Errorf("save venue: %v", err)
+		}
+		v.key = k
+		return emit(ctx, k, EventVenueSaved, struct {
+			ID string `json:"id"`
+			*Venue
+		}{v.ID(), v})
+	})
+}
+
+// LoadVenue loads a venue from the datastore given its unique id.
+func LoadVenue(ctx appengine.Context, id string) (*Venue, error) {
+	k, err := datastore.DecodeKey(id)
+	if err != nil {
+		return nil, fmt.Errorf("wrong key %q: %v", id, err)
+	}
+	var v Venue
+	if err := datastore.Get(ctx, k, &v); err != nil {
+		return nil, err
+	}
+	v.key = k
+	return &v, nil
+}
+
+// LoadVenues loads all the venues sorted by name.
+func LoadVenues(ctx appengine.Context) ([]Venue, error) {
+	var vs []Venue
+	ks, err := datastore.NewQuery(VenueKind).Order("Name").GetAll(ctx, &vs)
+	if err != nil {
+		return nil, fmt.Errorf("load venues: %v", err)
+	}
+	for i, k := range ks {
+		vs[i].key = k
+	}
+	return vs, nil
+}
+
+// A NearbyVenue is a venue at a given distance in km.
+type NearbyVenue struct {
+	*Venue
+	Distance float64
+}
+
+// VenuesNear loads the venues within the given distance in km of a position,
+// the nearest first.
+func VenuesNear(ctx appengine.Context, lat, lng, km float64) ([]NearbyVenue, error) {
+	var res []NearbyVenue
+	for _, h := range geohashesAround(lat, lng, km) {
+		var vs []Venue
+		ks, err := datastore.NewQuery(VenueKind).
+			Filter("Geohash >=", h).
+			Filter("Geohash <", h+"~").
+			GetAll(ctx, &vs)
+		if err != nil {
+			return nil, fmt.Errorf("load venues near %v,%v: %v", lat, lng, err)
+		}
+		for i := range vs {
+			vs[i].key = ks[i]
+			if d := distance(lat, lng, vs[i].Lat, vs[i].Lng); d <= km {
+				res = append(res, NearbyVenue{&vs[i], d})
+			}
+		}
+	}
+	sort.Sort(byDistance(res))
+	return res, nil
+}
+
+type byDistance []NearbyVenue
+
+func (v byDistance) Len() int           { return len(v) }
+func (v byDistance) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v byDistance) Less(i, j int) bool { return v[i].Distance < v[j].Distance }
+
+// A NearbyConf is a conference held in a nearby venue.
+type NearbyConf struct {
+	*Conference
+	Venue NearbyVenue
+}
+
+// ConferencesNear loads the conferences not finished yet held in the venues
+// within the given distance in km of a position, the nearest first.
+func ConferencesNear(ctx appengine.Context, lat, lng, km float64) ([]NearbyConf, error) {
+	vs, err := VenuesNear(ctx, lat, lng, km)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []NearbyConf
+	now := time.Now()
+	for _, v := range vs {
+		cs, err := upcomingConferences(ctx, v.ID(), now)
+		if err != nil {
+			return nil, err
+		}
+		for i := range cs {
+			res = append(res, NearbyConf{&cs[i], v})
+		}
+	}
+	return res, nil
+}
+
+// upcomingConferences loads the conferences held in the venue with the given
+// id that haven't finished at the given time.
+func upcomingConferences(ctx appengine.Context, venueID string, now time.Time) ([]Conference, error) {
+	// The end dates are the start of the last day in the time zone of each
+	// conference: query from two days before, to include the conferences on
+	// their last day in any time zone, and skip the ones finished.
+	var cs []Conference
+	ks, err := datastore.NewQuery(ConferenceKind).
+		Filter("VenueID =", venueID).
+		Filter("EndDate >=", now.Add(-48*time.Hour)).
+		GetAll(ctx, &cs)
+	if err != nil {
+		return nil, fmt.Errorf("load conferences at venue %v: %v", venueID, err)
+	}
+	var res []Conference
+	for i := range cs {
+		cs[i].setKey(ks[i])
+		if !cs[i].Finished(now) {
+			res = append(res, cs[i])
+		}
+	}
+	return res, nil
+}
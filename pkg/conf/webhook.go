@@ -0,0 +1,266 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package conf
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"appengine"
+	"appengine/datastore"
+	"appengine/taskqueue"
+)
+
+const (
+	// Datastore kinds
+	WebhookKind  = "Webhook"
+	DeliveryKind = "WebhookDelivery"
+
+	// WebhookQueue is the push queue events are delivered on.
+	WebhookQueue = "webhook-queue"
+
+	// The handler for WebhookDeliveryPath must call DeliverWebhook.
+	WebhookDeliveryPath = "/deliverwebhook"
+
+	// Headers of the requests sent to webhooks and of the delivery tasks.
+	WebhookIDHeader        = "X-Goconf-Webhook"
+	WebhookEventHeader     = "X-Goconf-Event"
+	WebhookSignatureHeader = "X-Goconf-Signature"
+)
+
+// privateEvents are the types of the events about the personal data of the
+// users, which are never delivered to webhooks.
+var privateEvents = map[string]bool{
+	EventProfileUpdated: true,
+}
+
+// WebhookEventTypes lists the event types webhooks can subscribe to.
+var WebhookEventTypes []string
+
+func init() {
+	RegisterConsumer("webhooks", dispatchWebhooks)
+	for _, typ := range EventTypes {
+		if !privateEvents[typ] {
+			WebhookEventTypes = append(WebhookEventTypes, typ)
+		}
+	}
+}
+
+// A Webhook is an endpoint notified of the events it's subscribed to.
+// The requests sent to it are signed with its secret.
+type Webhook struct {
+	URL     string
+	Secret  string `datastore:",noindex"`
+	Events  []string
+	Owner   string
+	Created time.Time
+
+	key *datastore.Key
+}
+
+// ID returns a unique identifier for any Webhook that has already
+// been saved in the datastore.
+func (h *Webhook) ID() string { return h.key.Encode() }
+
+// Subscribed returns true if the webhook should be notified of events of
+// the given type. A webhook with no events is subscribed to all the ones in
+// WebhookEventTypes.
+func (h *Webhook) Subscribed(typ string) bool {
+	if privateEvents[typ] {
+		return false
+	}
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, e := range h.Events {
+		if e == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Save saves a webhook into datastore.
+func (h *Webhook) Save(ctx appengine.Context) error {
+	if len(h.URL) == 0 || len(h.Secret) == 0 {
+		return fmt.Errorf("webhooks need an URL and a secret")
+	}
+	k := h.key
+	if k == nil {
+		k = datastore.NewIncompleteKey(ctx, WebhookKind, nil)
+	}
+	k, err := datastore.Put(ctx, k, h)
+	if err != nil {
+		return fmt.Errorf("save webhook: %v", err)
+	}
+	h.key = k
+	return nil
+}
+
+// LoadWebhooks loads all the registered webhooks.
+func LoadWebhooks(ctx appengine.Context) ([]Webhook, error) {
+	var hs []Webhook
+	ks, err := datastore.NewQuery(WebhookKind).Order("Created").GetAll(ctx, &hs)
+	if err != nil {
+		return nil, fmt.Errorf("load webhooks: %v", err)
+	}
+	for i, k := range ks {
+		hs[i].key = k
+	}
+	return hs, nil
+}
+
+// loadWebhook loads a webhook from the datastore given its unique id.
+func loadWebhook(ctx appengine.Context, id string) (*Webhook, error) {
+	k, err := datastore.DecodeKey(id)
+	if err != nil {
+		return nil, fmt.Errorf("wrong key %q: %v", id, err)
+	}
+	var h Webhook
+	if err := datastore.Get(ctx, k, &h); err != nil {
+		return nil, err
+	}
+	h.key = k
+	return &h, nil
+}
+
+// DeleteWebhook unregisters the webhook with the given id.
+// Its delivery log is kept.
+func DeleteWebhook(ctx appengine.Context, id string) error {
+	k, err := datastore.DecodeKey(id)
+	if err != nil {
+		return fmt.Errorf("wrong key %q: %v", id, err)
+	}
+	return datastore.Delete(ctx, k)
+}
+
+// dispatchWebhooks queues a delivery task for each of the webhooks subscribed
+// to the event.
+func dispatchWebhooks(ctx appengine.Context, e *Event) error {
+	hs, err := LoadWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encode event: %v", err)
+	}
+
+	var ts []*taskqueue.Task
+	for _, h := range hs {
+		if !h.Subscribed(e.Type) {
+			continue
+		}
+		ts = append(ts, &taskqueue.Task{
+			Path:    WebhookDeliveryPath,
+			Method:  "POST",
+			Payload: payload,
+			Header: http.Header{
+				WebhookIDHeader:    {h.ID()},
+				WebhookEventHeader: {e.Type},
+			},
+		})
+	}
+	if len(ts) == 0 {
+		return nil
+	}
+	if _, err := taskqueue.AddMulti(ctx, ts, WebhookQueue); err != nil {
+		return fmt.Errorf("queue deliveries: %v", err)
+	}
+	return nil
+}
+
+// Sign returns the signature of a payload for the given secret: the hex
+// encoded HMAC-SHA256 prefixed by "sha256=".
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// A Delivery records an attempt to deliver an event to a webhook.
+type Delivery struct {
+	URL     string
+	Event   string
+	Attempt int
+	Status  int
+	Error   string `datastore:",noindex"`
+	Time    time.Time
+}
+
+// Succeeded returns true if the webhook accepted the event.
+func (d *Delivery) Succeeded() bool { return len(d.Error) == 0 }
+
+// DeliverWebhook posts the given JSON encoded event of type typ to the webhook
+// with the given id using client, and records the attempt in the delivery log.
+// An error is returned if the webhook didn't accept the event, so the
+// delivery task is retried with exponential backoff by the queue.
+func DeliverWebhook(ctx appengine.Context, client *http.Client, id, typ string, payload []byte, attempt int) error {
+	h, err := loadWebhook(ctx, id)
+	if err == datastore.ErrNoSuchEntity {
+		// The webhook was deleted, nothing to deliver.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("load webhook: %v", err)
+	}
+
+	d := &Delivery{
+		URL:     h.URL,
+		Event:   typ,
+		Attempt: attempt,
+		Time:    time.Now(),
+	}
+	err = post(client, h, typ, payload, d)
+	if err != nil {
+		d.Error = err.Error()
+	}
+	k := datastore.NewIncompleteKey(ctx, DeliveryKind, h.key)
+	if _, perr := datastore.Put(ctx, k, d); perr != nil {
+		ctx.Errorf("save delivery: %v", perr)
+	}
+	return err
+}
+
+// post sends the payload to the webhook, recording the response status in d.
+func post(client *http.Client, h *Webhook, typ string, payload []byte, d *Delivery) error {
+	req, err := http.NewRequest("POST", h.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, typ)
+	req.Header.Set(WebhookSignatureHeader, Sign(h.Secret, payload))
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	d.Status = res.StatusCode
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook responded %v", res.Status)
+	}
+	return nil
+}
+
+// LoadDeliveries loads the latest n webhook deliveries, newest first.
+func LoadDeliveries(ctx appengine.Context, n int) ([]Delivery, error) {
+	var ds []Delivery
+	_, err := datastore.NewQuery(DeliveryKind).
+		Order("-Time").
+		Limit(n).
+		GetAll(ctx, &ds)
+	if err != nil {
+		return nil, fmt.Errorf("load deliveries: %v", err)
+	}
+	return ds, nil
+}
@@ -0,0 +1,237 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+//go:build appengine
+// +build appengine
+
+package confrpc
+
+import (
+	"context"
+
+	"appengine"
+	"appengine/datastore"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/campoy/goconf/pkg/conf"
+	confpb "github.com/campoy/goconf/proto"
+)
+
+// DatastoreBackend keeps the models in the App Engine datastore, with the
+// conf package.
+type DatastoreBackend struct {
+	// Context returns the App Engine context of a call.
+	Context func(ctx context.Context) appengine.Context
+	// Schedule saves a new conference and queues the creation of its
+	// tickets. If nil, that's all that's done, with no announcement.
+	Schedule func(ctx appengine.Context, c *conf.Conference) error
+}
+
+// backendError returns the error of a Backend for an error of the conf
+// package.
+func backendError(err error) error {
+	switch e := err.(type) {
+	case conf.ValidationError:
+		return InvalidError(e)
+	case *conf.CursorError:
+		return InvalidError(e.Error())
+	}
+	return err
+}
+
+// notFound returns true if err, returned loading the entity with the given
+// id, means that there's no such entity.
+func notFound(id string, err error) bool {
+	if err == datastore.ErrNoSuchEntity {
+		return true
+	}
+	_, kerr := datastore.DecodeKey(id)
+	return kerr != nil
+}
+
+// protobuf representations of the models.
+
+func newConf(c *conf.Conference) *confpb.Conference {
+	return &confpb.Conference{
+		Id:               c.ID(),
+		Name:             c.Name,
+		Description:      c.Description,
+		City:             c.City,
+		Topics:           c.Topics,
+		MaxAttendees:     int32(c.MaxAttendees),
+		TicketsAvailable: int32(c.TixAvailable),
+		StartDate:        timestamppb.New(c.StartDate),
+		EndDate:          timestamppb.New(c.EndDate),
+		Organizer:        c.Organizer,
+		Approved:         c.Approved,
+		VenueId:          c.VenueID,
+		TimeZone:         c.TimeZone,
+	}
+}
+
+func newTicket(t *conf.Ticket) *confpb.Ticket {
+	return &confpb.Ticket{
+		Id:             t.ID(),
+		ConferenceId:   t.ConferenceID(),
+		ConferenceName: t.ConfName,
+		Number:         int32(t.Number),
+		State:          string(t.State),
+	}
+}
+
+func newProfile(up *conf.UserProfile) *confpb.UserProfile {
+	return &confpb.UserProfile{
+		Name:              up.Name,
+		Topics:            up.Topics,
+		MainEmail:         up.MainEmail,
+		NotificationEmail: up.NotifEmail,
+		TimeZone:          up.TimeZone,
+	}
+}
+
+// conferences
+
+func (b DatastoreBackend) ListConferences(ctx context.Context, topic, city, cursor string, limit int) ([]*confpb.Conference, string, error) {
+	q := datastore.NewQuery(conf.ConferenceKind)
+	if len(topic) > 0 {
+		q = q.Filter("AllTopics =", topic)
+	}
+	if len(city) > 0 {
+		q = q.Filter("City =", city)
+	}
+	p, err := conf.LoadConfPage(b.Context(ctx), q, cursor, limit)
+	if err != nil {
+		return nil, "", backendError(err)
+	}
+	cs := make([]*confpb.Conference, len(p.Conferences))
+	for i := range p.Conferences {
+		cs[i] = newConf(&p.Conferences[i])
+	}
+	return cs, p.Next, nil
+}
+
+// loadConf loads the conference with the given id, failing with ErrNotFound
+// if it doesn't exist.
+func loadConf(ctx appengine.Context, id string) (*conf.Conference, error) {
+	c, err := conf.LoadConference(ctx, id)
+	if err != nil {
+		if notFound(id, err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+func (b DatastoreBackend) GetConference(ctx context.Context, id string) (*confpb.Conference, error) {
+	c, err := loadConf(b.Context(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	return newConf(c), nil
+}
+
+func (b DatastoreBackend) ScheduleConference(ctx context.Context, in *confpb.Conference) (*confpb.Conference, error) {
+	c := &conf.Conference{
+		Name:         in.Name,
+		Description:  in.Description,
+		City:         in.City,
+		Topics:       in.Topics,
+		MaxAttendees: int(in.MaxAttendees),
+		TixAvailable: int(in.TicketsAvailable),
+		StartDate:    in.StartDate.AsTime(),
+		EndDate:      in.EndDate.AsTime(),
+		Organizer:    in.Organizer,
+		VenueID:      in.VenueId,
+		TimeZone:     in.TimeZone,
+	}
+	schedule := b.Schedule
+	if schedule == nil {
+		schedule = saveAndQueueTickets
+	}
+	if err := schedule(b.Context(ctx), c); err != nil {
+		return nil, backendError(err)
+	}
+	return newConf(c), nil
+}
+
+// saveAndQueueTickets saves a new conference and queues the creation of its
+// tickets, see conf.Conference.QueueTickets.
+func saveAndQueueTickets(ctx appengine.Context, c *conf.Conference) error {
+	if err := c.Validate(ctx); err != nil {
+		return err
+	}
+	return conf.RunInTransaction(ctx, func(ctx appengine.Context) error {
+		if err := c.Save(ctx); err != nil {
+			return err
+		}
+		return c.QueueTickets(ctx)
+	})
+}
+
+// tickets
+
+func (b DatastoreBackend) ListAvailableTickets(ctx context.Context, confID, cursor string, limit int) ([]*confpb.Ticket, string, error) {
+	actx := b.Context(ctx)
+	c, err := loadConf(actx, confID)
+	if err != nil {
+		return nil, "", err
+	}
+	p, err := c.AvailableTicketsPage(actx, cursor, limit)
+	if err != nil {
+		return nil, "", backendError(err)
+	}
+	ts := make([]*confpb.Ticket, len(p.Tickets))
+	for i := range p.Tickets {
+		ts[i] = newTicket(&p.Tickets[i])
+	}
+	return ts, p.Next, nil
+}
+
+func (b DatastoreBackend) BuyTicket(ctx context.Context, id, email string) (*confpb.Ticket, error) {
+	actx := b.Context(ctx)
+	t, err := conf.LoadTicket(actx, id)
+	if err != nil {
+		if notFound(id, err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if err := t.SellTo(actx, email); err != nil {
+		if err == conf.ErrTicketUnavailable || err == datastore.ErrConcurrentTransaction {
+			return nil, ErrTicketUnavailable
+		}
+		return nil, err
+	}
+	return newTicket(t), nil
+}
+
+// user profile
+
+func (b DatastoreBackend) UserProfile(ctx context.Context, email string) (*confpb.UserProfile, error) {
+	up, err := conf.LoadUserProfile(b.Context(ctx), email)
+	if err != nil {
+		return nil, err
+	}
+	return newProfile(up), nil
+}
+
+func (b DatastoreBackend) SaveUserProfile(ctx context.Context, in *confpb.UserProfile) (*confpb.UserProfile, error) {
+	up := &conf.UserProfile{
+		MainEmail:  in.MainEmail,
+		Name:       in.Name,
+		NotifEmail: in.NotificationEmail,
+		Topics:     in.Topics,
+		TimeZone:   in.TimeZone,
+	}
+	if err := up.Save(b.Context(ctx)); err != nil {
+		return nil, backendError(err)
+	}
+	return newProfile(up), nil
+}
+
+func (b DatastoreBackend) Can(ctx context.Context, email, perm string) (bool, error) {
+	return conf.Can(b.Context(ctx), email, conf.Permission(perm), nil)
+}
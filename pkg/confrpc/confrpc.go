@@ -0,0 +1,353 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+// The confrpc package implements the ConferenceService gRPC service, defined
+// in proto/conference.proto, on top of a Backend keeping the models, like
+// DatastoreBackend, which keeps them with the conf package.
+//
+// The users making the calls are identified by the same
+// identity.Authenticator that identifies them in the web requests: it's
+// given the HTTP request the call was served in, or one with the metadata of
+// the call as its headers, so the credentials are found where they're found
+// in the web requests.
+package confrpc
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/textproto"
+	"net/url"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/campoy/goconf/pkg/identity"
+	confpb "github.com/campoy/goconf/proto"
+)
+
+// Page sizes for the listings.
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+// The permissions checked by the calls, named as the conf package names
+// them.
+const (
+	PermBuyTicket          = "ticket.buy"
+	PermScheduleConference = "conference.schedule"
+)
+
+// Errors returned by a Backend that are replied with their own status codes.
+// Any other error is logged, and replied as an internal error that doesn't
+// disclose it.
+var (
+	// ErrNotFound is returned for the models that don't exist.
+	ErrNotFound = errors.New("not found")
+	// ErrTicketUnavailable is returned when buying a ticket that isn't
+	// available.
+	ErrTicketUnavailable = errors.New("the ticket is not available")
+)
+
+// An InvalidError is returned by a Backend when the arguments of a call are
+// invalid, like a malformed cursor or a model that can't be saved. Its
+// message is replied to the caller.
+type InvalidError string
+
+func (e InvalidError) Error() string { return string(e) }
+
+// A Backend loads and saves the models of the calls.
+type Backend interface {
+	// ListConferences returns a page of at most limit conferences starting
+	// at the cursor, with the topic and in the city if they aren't empty,
+	// and the cursor to the next page, empty if it's the last one.
+	ListConferences(ctx context.Context, topic, city, cursor string, limit int) ([]*confpb.Conference, string, error)
+	// GetConference returns the conference with the given id.
+	GetConference(ctx context.Context, id string) (*confpb.Conference, error)
+	// ScheduleConference saves a new conference with its tickets, and
+	// returns it as it was saved.
+	ScheduleConference(ctx context.Context, c *confpb.Conference) (*confpb.Conference, error)
+	// ListAvailableTickets returns a page of the available tickets of the
+	// conference with the given id, as ListConferences does.
+	ListAvailableTickets(ctx context.Context, confID, cursor string, limit int) ([]*confpb.Ticket, string, error)
+	// BuyTicket sells the ticket with the given id to the user with the
+	// given email.
+	BuyTicket(ctx context.Context, id, email string) (*confpb.Ticket, error)
+	// UserProfile returns the profile of the user with the given email, an
+	// empty one if it wasn't saved yet.
+	UserProfile(ctx context.Context, email string) (*confpb.UserProfile, error)
+	// SaveUserProfile saves the profile of the user with its main email,
+	// and returns it as it was saved.
+	SaveUserProfile(ctx context.Context, up *confpb.UserProfile) (*confpb.UserProfile, error)
+	// Can returns true if the user with the given email has the permission.
+	Can(ctx context.Context, email, perm string) (bool, error)
+}
+
+// A Server implements confpb.ConferenceServiceServer.
+type Server struct {
+	confpb.UnimplementedConferenceServiceServer
+
+	// Backend loads and saves the models.
+	Backend Backend
+	// Authenticator identifies the users making the calls, see Request.
+	Authenticator identity.Authenticator
+	// Errorf logs the internal errors of the calls. If nil, they're logged
+	// with the log package.
+	Errorf func(ctx context.Context, format string, args ...interface{})
+}
+
+// requestKey is the context key of the request set by NewContext.
+type requestKey int
+
+// NewContext returns a context carrying the HTTP request a call is served
+// in, for servers served with grpc.Server.ServeHTTP.
+func NewContext(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, requestKey(0), r)
+}
+
+// Request returns the HTTP request the call is served in, as set by
+// NewContext, or else a request with the incoming metadata of the call as
+// its headers.
+func Request(ctx context.Context) *http.Request {
+	if r, ok := ctx.Value(requestKey(0)).(*http.Request); ok {
+		return r
+	}
+	method, _ := grpc.Method(ctx)
+	r := &http.Request{
+		Method: "POST",
+		URL:    &url.URL{Path: method},
+		Header: make(http.Header),
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, vs := range md {
+		if k == ":authority" {
+			r.Host = vs[0]
+			continue
+		}
+		r.Header[textproto.CanonicalMIMEHeaderKey(k)] = vs
+	}
+	return r.WithContext(ctx)
+}
+
+// A call is a call being served, with its user.
+type call struct {
+	*Server
+	ctx  context.Context
+	user *identity.Identity
+}
+
+func (s *Server) call(ctx context.Context) (*call, error) {
+	c := &call{Server: s, ctx: ctx}
+	u, err := s.Authenticator.Current(Request(ctx))
+	if err != nil {
+		return nil, c.internal(err)
+	}
+	c.user = u
+	return c, nil
+}
+
+// internal logs the error and returns an Internal status error, which
+// doesn't disclose it.
+func (c *call) internal(err error) error {
+	if c.Errorf != nil {
+		c.Errorf(c.ctx, "rpc failed: %v", err)
+	} else {
+		log.Printf("rpc failed: %v", err)
+	}
+	return status.Error(codes.Internal, "internal error")
+}
+
+// error returns the status error for an error of the Backend. The model
+// named by what is the one not found if it's ErrNotFound.
+func (c *call) error(err error, what string) error {
+	switch err {
+	case ErrNotFound:
+		return status.Errorf(codes.NotFound, "%v not found", what)
+	case ErrTicketUnavailable:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if e, ok := err.(InvalidError); ok {
+		return status.Error(codes.InvalidArgument, string(e))
+	}
+	return c.internal(err)
+}
+
+// signedIn returns an Unauthenticated status error if there's no signed in
+// user.
+func (c *call) signedIn() error {
+	if c.user == nil {
+		return status.Error(codes.Unauthenticated, "this call requires to be signed in")
+	}
+	return nil
+}
+
+// can returns an error if the user isn't signed in or doesn't have the
+// permission.
+func (c *call) can(perm string) error {
+	if err := c.signedIn(); err != nil {
+		return err
+	}
+	if c.user.Admin {
+		return nil
+	}
+	ok, err := c.Backend.Can(c.ctx, c.user.Email, perm)
+	if err != nil {
+		return c.internal(err)
+	}
+	if !ok {
+		return status.Errorf(codes.PermissionDenied, "%v is not allowed to %v", c.user.Email, perm)
+	}
+	return nil
+}
+
+// limit returns the page size for the requested limit.
+func limit(n int32) (int, error) {
+	switch {
+	case n == 0:
+		return defaultLimit, nil
+	case n < 0 || n > maxLimit:
+		return 0, status.Errorf(codes.InvalidArgument, "limit must be between 1 and %v", maxLimit)
+	}
+	return int(n), nil
+}
+
+// conferences
+
+func (s *Server) ListConferences(ctx context.Context, req *confpb.ListConferencesRequest) (*confpb.ListConferencesResponse, error) {
+	c, err := s.call(ctx)
+	if err != nil {
+		return nil, err
+	}
+	n, err := limit(req.Limit)
+	if err != nil {
+		return nil, err
+	}
+	cs, next, err := s.Backend.ListConferences(ctx, req.Topic, req.City, req.Cursor, n)
+	if err != nil {
+		return nil, c.error(err, "conferences")
+	}
+	return &confpb.ListConferencesResponse{Conferences: cs, NextCursor: next}, nil
+}
+
+func (s *Server) GetConference(ctx context.Context, req *confpb.GetConferenceRequest) (*confpb.Conference, error) {
+	c, err := s.call(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cf, err := s.Backend.GetConference(ctx, req.Id)
+	if err != nil {
+		return nil, c.error(err, "conference "+req.Id)
+	}
+	return cf, nil
+}
+
+func (s *Server) ScheduleConference(ctx context.Context, req *confpb.ScheduleConferenceRequest) (*confpb.Conference, error) {
+	c, err := s.call(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.can(PermScheduleConference); err != nil {
+		return nil, err
+	}
+	in := req.Conference
+	if in == nil || in.StartDate == nil || in.EndDate == nil {
+		return nil, status.Error(codes.InvalidArgument, "the conference and its dates are required")
+	}
+	cf, err := s.Backend.ScheduleConference(ctx, &confpb.Conference{
+		Name:             in.Name,
+		Description:      in.Description,
+		City:             in.City,
+		Topics:           in.Topics,
+		MaxAttendees:     in.MaxAttendees,
+		TicketsAvailable: in.MaxAttendees,
+		StartDate:        in.StartDate,
+		EndDate:          in.EndDate,
+		Organizer:        c.user.Email,
+		VenueId:          in.VenueId,
+		TimeZone:         in.TimeZone,
+	})
+	if err != nil {
+		return nil, c.error(err, "conference")
+	}
+	return cf, nil
+}
+
+// tickets
+
+func (s *Server) ListAvailableTickets(ctx context.Context, req *confpb.ListAvailableTicketsRequest) (*confpb.ListAvailableTicketsResponse, error) {
+	c, err := s.call(ctx)
+	if err != nil {
+		return nil, err
+	}
+	n, err := limit(req.Limit)
+	if err != nil {
+		return nil, err
+	}
+	ts, next, err := s.Backend.ListAvailableTickets(ctx, req.ConferenceId, req.Cursor, n)
+	if err != nil {
+		return nil, c.error(err, "conference "+req.ConferenceId)
+	}
+	return &confpb.ListAvailableTicketsResponse{Tickets: ts, NextCursor: next}, nil
+}
+
+func (s *Server) BuyTicket(ctx context.Context, req *confpb.BuyTicketRequest) (*confpb.Ticket, error) {
+	c, err := s.call(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.can(PermBuyTicket); err != nil {
+		return nil, err
+	}
+	t, err := s.Backend.BuyTicket(ctx, req.TicketId, c.user.Email)
+	if err != nil {
+		return nil, c.error(err, "ticket "+req.TicketId)
+	}
+	return t, nil
+}
+
+// user profile
+
+func (s *Server) GetUserProfile(ctx context.Context, req *confpb.GetUserProfileRequest) (*confpb.UserProfile, error) {
+	c, err := s.call(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.signedIn(); err != nil {
+		return nil, err
+	}
+	up, err := s.Backend.UserProfile(ctx, c.user.Email)
+	if err != nil {
+		return nil, c.error(err, "profile")
+	}
+	return up, nil
+}
+
+func (s *Server) UpdateUserProfile(ctx context.Context, req *confpb.UpdateUserProfileRequest) (*confpb.UserProfile, error) {
+	c, err := s.call(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.signedIn(); err != nil {
+		return nil, err
+	}
+	in := req.Profile
+	if in == nil {
+		return nil, status.Error(codes.InvalidArgument, "the profile is required")
+	}
+	up, err := s.Backend.SaveUserProfile(ctx, &confpb.UserProfile{
+		Name:              in.Name,
+		Topics:            in.Topics,
+		MainEmail:         c.user.Email,
+		NotificationEmail: in.NotificationEmail,
+		TimeZone:          in.TimeZone,
+	})
+	if err != nil {
+		return nil, c.error(err, "profile")
+	}
+	return up, nil
+}
@@ -0,0 +1,511 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package confrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/campoy/goconf/pkg/identity"
+	"github.com/campoy/goconf/pkg/session"
+	confpb "github.com/campoy/goconf/proto"
+)
+
+// memoryBackend is a Backend keeping the models in memory. The conferences
+// are listed in the order they were scheduled.
+type memoryBackend struct {
+	mu         sync.Mutex
+	confs      []*confpb.Conference
+	tickets    map[string][]*confpb.Ticket // by conference id
+	profiles   map[string]*confpb.UserProfile
+	organizers map[string]bool // emails of the users who can schedule
+	err        error           // returned by every call if not nil
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{
+		tickets:    make(map[string][]*confpb.Ticket),
+		profiles:   make(map[string]*confpb.UserProfile),
+		organizers: make(map[string]bool),
+	}
+}
+
+// page returns the bounds of a page of n items starting at the cursor, and
+// the cursor to the next one.
+func page(cursor string, limit, n int) (int, int, string, error) {
+	start := 0
+	if len(cursor) > 0 {
+		var err error
+		if start, err = strconv.Atoi(cursor); err != nil || start < 0 || start > n {
+			return 0, 0, "", InvalidError(fmt.Sprintf("bad cursor %q", cursor))
+		}
+	}
+	end, next := start+limit, ""
+	if end < n {
+		next = strconv.Itoa(end)
+	} else {
+		end = n
+	}
+	return start, end, next, nil
+}
+
+func (b *memoryBackend) ListConferences(ctx context.Context, topic, city, cursor string, limit int) ([]*confpb.Conference, string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return nil, "", b.err
+	}
+	var cs []*confpb.Conference
+	for _, c := range b.confs {
+		if (len(city) == 0 || c.City == city) && (len(topic) == 0 || contains(c.Topics, topic)) {
+			cs = append(cs, c)
+		}
+	}
+	start, end, next, err := page(cursor, limit, len(cs))
+	if err != nil {
+		return nil, "", err
+	}
+	return cs[start:end], next, nil
+}
+
+func (b *memoryBackend) GetConference(ctx context.Context, id string) (*confpb.Conference, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return nil, b.err
+	}
+	for _, c := range b.confs {
+		if c.Id == id {
+			return c, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (b *memoryBackend) ScheduleConference(ctx context.Context, in *confpb.Conference) (*confpb.Conference, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return nil, b.err
+	}
+	if in.MaxAttendees <= 0 {
+		return nil, InvalidError(fmt.Sprintf("bad max attendees %v", in.MaxAttendees))
+	}
+	c := proto.Clone(in).(*confpb.Conference)
+	c.Id = fmt.Sprintf("conf%v", len(b.confs)+1)
+	b.confs = append(b.confs, c)
+	for i := int32(1); i <= c.MaxAttendees; i++ {
+		b.tickets[c.Id] = append(b.tickets[c.Id], &confpb.Ticket{
+			Id:             fmt.Sprintf("%v-%v", c.Id, i),
+			ConferenceId:   c.Id,
+			ConferenceName: c.Name,
+			Number:         i,
+			State:          "available",
+		})
+	}
+	return c, nil
+}
+
+func (b *memoryBackend) ListAvailableTickets(ctx context.Context, confID, cursor string, limit int) ([]*confpb.Ticket, string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return nil, "", b.err
+	}
+	all, ok := b.tickets[confID]
+	if !ok {
+		return nil, "", ErrNotFound
+	}
+	var ts []*confpb.Ticket
+	for _, t := range all {
+		if t.State == "available" {
+			ts = append(ts, t)
+		}
+	}
+	start, end, next, err := page(cursor, limit, len(ts))
+	if err != nil {
+		return nil, "", err
+	}
+	return ts[start:end], next, nil
+}
+
+func (b *memoryBackend) BuyTicket(ctx context.Context, id, email string) (*confpb.Ticket, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return nil, b.err
+	}
+	for _, ts := range b.tickets {
+		for _, t := range ts {
+			if t.Id != id {
+				continue
+			}
+			if t.State != "available" {
+				return nil, ErrTicketUnavailable
+			}
+			t.State = "sold"
+			return t, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (b *memoryBackend) UserProfile(ctx context.Context, email string) (*confpb.UserProfile, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return nil, b.err
+	}
+	if up, ok := b.profiles[email]; ok {
+		return up, nil
+	}
+	return &confpb.UserProfile{MainEmail: email}, nil
+}
+
+func (b *memoryBackend) SaveUserProfile(ctx context.Context, up *confpb.UserProfile) (*confpb.UserProfile, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return nil, b.err
+	}
+	if _, err := time.LoadLocation(up.TimeZone); err != nil {
+		return nil, InvalidError(fmt.Sprintf("bad time zone %q", up.TimeZone))
+	}
+	b.profiles[up.MainEmail] = up
+	return up, nil
+}
+
+func (b *memoryBackend) Can(ctx context.Context, email, perm string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return false, b.err
+	}
+	return perm == PermBuyTicket || perm == PermScheduleConference && b.organizers[email], nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// testServer serves a Server over an in-memory connection. The users sign in
+// with the dev identity provider, as they would in the web application.
+type testServer struct {
+	client  confpb.ConferenceServiceClient
+	dev     *identity.Dev
+	backend *memoryBackend
+
+	mu     sync.Mutex
+	logged []string // internal errors
+}
+
+func newTestServer(t *testing.T) *testServer {
+	sessions := &session.Manager{
+		Keys:  [][]byte{[]byte("0123456789abcdef0123456789abcdef")},
+		Store: &session.MemoryStore{},
+	}
+	s := &testServer{
+		dev:     &identity.Dev{Store: &identity.SessionStore{Sessions: sessions}},
+		backend: newMemoryBackend(),
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	confpb.RegisterConferenceServiceServer(srv, &Server{
+		Backend:       s.backend,
+		Authenticator: s.dev,
+		Errorf: func(ctx context.Context, format string, args ...interface{}) {
+			s.mu.Lock()
+			s.logged = append(s.logged, fmt.Sprintf(format, args...))
+			s.mu.Unlock()
+		},
+	})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	s.client = confpb.NewConferenceServiceClient(conn)
+	return s
+}
+
+// signIn signs in the user with the given email, returning a context whose
+// calls carry the session cookie in their metadata.
+func (s *testServer) signIn(t *testing.T, email string, admin bool) context.Context {
+	form := url.Values{"email": {email}}
+	if admin {
+		form.Set("admin", "1")
+	}
+	r := httptest.NewRequest("POST", identity.LoginPath, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.dev.ServeHTTP(w, r)
+	if w.Code != http.StatusFound {
+		t.Fatalf("sign in as %v: status %v: %s", email, w.Code, w.Body)
+	}
+	// The session cookie is cleared before it's set, so the last one counts.
+	last := make(map[string]string)
+	for _, c := range w.Result().Cookies() {
+		last[c.Name] = c.Value
+	}
+	var cookies []string
+	for name, value := range last {
+		cookies = append(cookies, name+"="+value)
+	}
+	return metadata.AppendToOutgoingContext(context.Background(), "cookie", strings.Join(cookies, "; "))
+}
+
+// schedule schedules a conference as an administrator.
+func (s *testServer) schedule(t *testing.T, name string, attendees int32) *confpb.Conference {
+	c, err := s.client.ScheduleConference(s.signIn(t, "admin@example.com", true), scheduleRequest(name, attendees))
+	if err != nil {
+		t.Fatalf("schedule conference: %v", err)
+	}
+	return c
+}
+
+func scheduleRequest(name string, attendees int32) *confpb.ScheduleConferenceRequest {
+	start := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+	return &confpb.ScheduleConferenceRequest{
+		Conference: &confpb.Conference{
+			Name:         name,
+			MaxAttendees: attendees,
+			StartDate:    timestamppb.New(start),
+			EndDate:      timestamppb.New(start.AddDate(0, 0, 1)),
+		},
+	}
+}
+
+func wantCode(t *testing.T, what string, err error, code codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != code {
+		t.Errorf("%v: got code %v, want %v (%v)", what, got, code, err)
+	}
+}
+
+func TestSignedOut(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+
+	_, err := s.client.GetUserProfile(ctx, &confpb.GetUserProfileRequest{})
+	wantCode(t, "get profile", err, codes.Unauthenticated)
+	_, err = s.client.BuyTicket(ctx, &confpb.BuyTicketRequest{TicketId: "x"})
+	wantCode(t, "buy ticket", err, codes.Unauthenticated)
+	_, err = s.client.ScheduleConference(ctx, &confpb.ScheduleConferenceRequest{})
+	wantCode(t, "schedule conference", err, codes.Unauthenticated)
+
+	// The listings are public.
+	if _, err := s.client.ListConferences(ctx, &confpb.ListConferencesRequest{}); err != nil {
+		t.Errorf("list conferences: %v", err)
+	}
+}
+
+func TestScheduleConference(t *testing.T) {
+	s := newTestServer(t)
+
+	ctx := s.signIn(t, "attendee@example.com", false)
+	_, err := s.client.ScheduleConference(ctx, scheduleRequest("Gophercon", 10))
+	wantCode(t, "schedule as attendee", err, codes.PermissionDenied)
+
+	c := s.schedule(t, "Gophercon", 10)
+	if c.Organizer != "admin@example.com" || c.TicketsAvailable != 10 {
+		t.Errorf("scheduled %v", c)
+	}
+
+	s.backend.organizers["organizer@example.com"] = true
+	org := s.signIn(t, "organizer@example.com", false)
+	if _, err := s.client.ScheduleConference(org, scheduleRequest("dotGo", 10)); err != nil {
+		t.Errorf("schedule as organizer: %v", err)
+	}
+	_, err = s.client.ScheduleConference(org, scheduleRequest("empty", 0))
+	wantCode(t, "schedule invalid conference", err, codes.InvalidArgument)
+	_, err = s.client.ScheduleConference(org, &confpb.ScheduleConferenceRequest{
+		Conference: &confpb.Conference{Name: "undated", MaxAttendees: 10},
+	})
+	wantCode(t, "schedule without dates", err, codes.InvalidArgument)
+
+	got, err := s.client.GetConference(ctx, &confpb.GetConferenceRequest{Id: c.Id})
+	if err != nil {
+		t.Fatalf("get conference: %v", err)
+	}
+	if got.Name != "Gophercon" || !got.StartDate.AsTime().Equal(c.StartDate.AsTime()) {
+		t.Errorf("got %v, want %v", got, c)
+	}
+	_, err = s.client.GetConference(ctx, &confpb.GetConferenceRequest{Id: "missing"})
+	wantCode(t, "get missing conference", err, codes.NotFound)
+}
+
+func TestListConferences(t *testing.T) {
+	s := newTestServer(t)
+	s.schedule(t, "one", 1)
+	s.schedule(t, "two", 1)
+	ctx := context.Background()
+
+	res, err := s.client.ListConferences(ctx, &confpb.ListConferencesRequest{Limit: 1})
+	if err != nil {
+		t.Fatalf("list conferences: %v", err)
+	}
+	if len(res.Conferences) != 1 || len(res.NextCursor) == 0 {
+		t.Fatalf("first page: got %v", res)
+	}
+	res, err = s.client.ListConferences(ctx, &confpb.ListConferencesRequest{Limit: 1, Cursor: res.NextCursor})
+	if err != nil {
+		t.Fatalf("list conferences: %v", err)
+	}
+	if len(res.Conferences) != 1 || len(res.NextCursor) != 0 {
+		t.Fatalf("second page: got %v", res)
+	}
+
+	_, err = s.client.ListConferences(ctx, &confpb.ListConferencesRequest{Cursor: "bad"})
+	wantCode(t, "bad cursor", err, codes.InvalidArgument)
+	_, err = s.client.ListConferences(ctx, &confpb.ListConferencesRequest{Limit: maxLimit + 1})
+	wantCode(t, "bad limit", err, codes.InvalidArgument)
+}
+
+func TestBuyTicket(t *testing.T) {
+	s := newTestServer(t)
+	c := s.schedule(t, "Gophercon", 2)
+	ctx := s.signIn(t, "attendee@example.com", false)
+
+	res, err := s.client.ListAvailableTickets(ctx, &confpb.ListAvailableTicketsRequest{ConferenceId: c.Id})
+	if err != nil {
+		t.Fatalf("list tickets: %v", err)
+	}
+	if len(res.Tickets) != 2 {
+		t.Fatalf("got %v tickets, want 2", len(res.Tickets))
+	}
+	_, err = s.client.ListAvailableTickets(ctx, &confpb.ListAvailableTicketsRequest{ConferenceId: "missing"})
+	wantCode(t, "list tickets of missing conference", err, codes.NotFound)
+
+	id := res.Tickets[0].Id
+	tk, err := s.client.BuyTicket(ctx, &confpb.BuyTicketRequest{TicketId: id})
+	if err != nil {
+		t.Fatalf("buy ticket: %v", err)
+	}
+	if tk.Id != id || tk.ConferenceId != c.Id || tk.State == res.Tickets[0].State {
+		t.Errorf("bought %v, listed %v", tk, res.Tickets[0])
+	}
+
+	other := s.signIn(t, "other@example.com", false)
+	_, err = s.client.BuyTicket(other, &confpb.BuyTicketRequest{TicketId: id})
+	wantCode(t, "buy sold ticket", err, codes.FailedPrecondition)
+	_, err = s.client.BuyTicket(other, &confpb.BuyTicketRequest{TicketId: "missing"})
+	wantCode(t, "buy missing ticket", err, codes.NotFound)
+
+	res, err = s.client.ListAvailableTickets(ctx, &confpb.ListAvailableTicketsRequest{ConferenceId: c.Id})
+	if err != nil {
+		t.Fatalf("list tickets: %v", err)
+	}
+	if len(res.Tickets) != 1 {
+		t.Errorf("got %v tickets after buying one, want 1", len(res.Tickets))
+	}
+}
+
+func TestUserProfile(t *testing.T) {
+	s := newTestServer(t)
+	ctx := s.signIn(t, "gopher@example.com", false)
+
+	up, err := s.client.GetUserProfile(ctx, &confpb.GetUserProfileRequest{})
+	if err != nil {
+		t.Fatalf("get profile: %v", err)
+	}
+	if up.MainEmail != "gopher@example.com" || len(up.Name) > 0 {
+		t.Errorf("new profile: got %v", up)
+	}
+
+	_, err = s.client.UpdateUserProfile(ctx, &confpb.UpdateUserProfileRequest{
+		Profile: &confpb.UserProfile{
+			Name:      "Gopher",
+			MainEmail: "someone@example.com",
+			TimeZone:  "Europe/Madrid",
+		},
+	})
+	if err != nil {
+		t.Fatalf("update profile: %v", err)
+	}
+	up, err = s.client.GetUserProfile(ctx, &confpb.GetUserProfileRequest{})
+	if err != nil {
+		t.Fatalf("get profile: %v", err)
+	}
+	// The profile is always the one of the signed in user.
+	if up.Name != "Gopher" || up.MainEmail != "gopher@example.com" || up.TimeZone != "Europe/Madrid" {
+		t.Errorf("updated profile: got %v", up)
+	}
+
+	_, err = s.client.UpdateUserProfile(ctx, &confpb.UpdateUserProfileRequest{
+		Profile: &confpb.UserProfile{TimeZone: "Nowhere/Atlantis"},
+	})
+	wantCode(t, "update with bad time zone", err, codes.InvalidArgument)
+}
+
+func TestInternalErrors(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.signIn(t, "admin@example.com", true)
+	s.backend.err = errors.New("datastore: API error 1 (datastore_v3: BAD_REQUEST)")
+
+	_, err := s.client.ScheduleConference(admin, scheduleRequest("Gophercon", 10))
+	wantCode(t, "schedule conference", err, codes.Internal)
+	_, err = s.client.ListConferences(admin, &confpb.ListConferencesRequest{})
+	wantCode(t, "list conferences", err, codes.Internal)
+	_, err = s.client.GetConference(admin, &confpb.GetConferenceRequest{Id: "x"})
+	wantCode(t, "get conference", err, codes.Internal)
+
+	// The errors are logged, but not disclosed.
+	if msg := status.Convert(err).Message(); strings.Contains(msg, "datastore") {
+		t.Errorf("internal error disclosed: %q", msg)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.logged) != 3 || !strings.Contains(s.logged[0], "BAD_REQUEST") {
+		t.Errorf("logged %q, want the three errors", s.logged)
+	}
+}
+
+func TestRequest(t *testing.T) {
+	md := metadata.Pairs("cookie", "session=abc", ":authority", "example.com")
+	r := Request(metadata.NewIncomingContext(context.Background(), md))
+	if got := r.Header.Get("Cookie"); got != "session=abc" {
+		t.Errorf("cookie header: got %q", got)
+	}
+	if r.Host != "example.com" {
+		t.Errorf("host: got %q", r.Host)
+	}
+
+	orig := httptest.NewRequest("POST", "/", nil)
+	if r := Request(NewContext(context.Background(), orig)); r != orig {
+		t.Errorf("got request %p, want the one in the context %p", r, orig)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+// The csrf package protects web applications against cross-site request
+// forgery.
+//
+// The tokens belong to the sessions of a session.Manager: their secret is
+// derived from the id of the session, which other sites can't read, so a
+// new session, started when the users sign in, gets new tokens and signing
+// out invalidates them. Requests with unsafe methods must send a token in a
+// form field or header, which a page from another site can't do. The token
+// sent in forms is masked with a different random value every time, so it
+// can't be recovered from compressed responses.
+package csrf
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+
+	"github.com/campoy/goconf/pkg/session"
+)
+
+// FieldName is the name of the form field, and HeaderName the name of the
+// header, that carry the token.
+const (
+	FieldName  = "csrf_token"
+	HeaderName = "X-CSRF-Token"
+)
+
+// secretLen is the length in bytes of the secret.
+const secretLen = sha256.Size
+
+// safeMethods are the methods that must not change the state of the
+// application, so they don't need a token.
+var safeMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"OPTIONS": true,
+	"TRACE":   true,
+}
+
+// Errors returned by Check for the requests that are rejected.
+var (
+	ErrNoSession = errors.New("missing session for the CSRF token")
+	ErrBadToken  = errors.New("invalid CSRF token")
+)
+
+// A Protector issues and checks the tokens of the sessions of a
+// session.Manager.
+type Protector struct {
+	Sessions *session.Manager
+}
+
+// Check returns ErrNoSession or ErrBadToken if the request has an unsafe
+// method and doesn't carry a valid token for its session, in the HeaderName
+// header or the FieldName form field, or the error loading the session. It's
+// for the handlers that can't be wrapped with Protect, like the ones replying
+// with errors in their own format.
+func (p *Protector) Check(r *http.Request) error {
+	if safeMethods[r.Method] {
+		return nil
+	}
+	s, err := p.Sessions.Get(r)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return ErrNoSession
+	}
+	tok := r.Header.Get(HeaderName)
+	if len(tok) == 0 {
+		tok = r.PostFormValue(FieldName)
+	}
+	if !valid(secret(s), tok) {
+		return ErrBadToken
+	}
+	return nil
+}
+
+// Protect returns a handler that rejects the requests with unsafe methods
+// without a valid token with 403 Forbidden, and serves the rest with h. It
+// starts a new session for the requests without one, so their pages can
+// carry tokens.
+func (p *Protector) Protect(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := p.Check(r); err != nil {
+			if err == ErrNoSession || err == ErrBadToken {
+				http.Error(w, err.Error(), http.StatusForbidden)
+			} else {
+				http.Error(w, "load session failed", http.StatusInternalServerError)
+			}
+			return
+		}
+		s, err := p.Sessions.Get(r)
+		if err == nil && s == nil {
+			_, err = p.Sessions.Start(w, r)
+		}
+		if err != nil {
+			http.Error(w, "start session failed", http.StatusInternalServerError)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Token returns a token for the requests of the session of r, empty if it
+// has none.
+func (p *Protector) Token(r *http.Request) string {
+	s, err := p.Sessions.Get(r)
+	if err != nil || s == nil {
+		return ""
+	}
+	return token(secret(s))
+}
+
+// secret returns the secret of the tokens of the session.
+func secret(s *session.Session) []byte {
+	sum := sha256.Sum256([]byte("csrf " + s.ID))
+	return sum[:]
+}
+
+// token returns the secret masked with a new random value.
+func token(secret []byte) string {
+	mask := make([]byte, secretLen)
+	if _, err := rand.Read(mask); err != nil {
+		return ""
+	}
+	tok := make([]byte, 2*secretLen)
+	copy(tok, mask)
+	for i := range secret {
+		tok[secretLen+i] = mask[i] ^ secret[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(tok)
+}
+
+// valid returns whether the token was returned by token for the secret.
+func valid(secret []byte, token string) bool {
+	tok, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(tok) != 2*secretLen {
+		return false
+	}
+	got := make([]byte, secretLen)
+	for i := range got {
+		got[i] = tok[i] ^ tok[secretLen+i]
+	}
+	return subtle.ConstantTimeCompare(got, secret) == 1
+}
+
+// Field returns the hidden form field carrying the token.
+func Field(token string) template.HTML {
+	return template.HTML(`<input type="hidden" name="` + FieldName + `" value="` +
+		template.HTMLEscapeString(token) + `">`)
+}
@@ -0,0 +1,157 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package csrf_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/campoy/goconf/pkg/csrf"
+	"github.com/campoy/goconf/pkg/session"
+)
+
+// browser makes requests to a handler protected by a Protector, which replies
+// with a new token, keeping the cookies it sets.
+type browser struct {
+	p       *csrf.Protector
+	h       http.Handler
+	cookies map[string]*http.Cookie
+}
+
+func newBrowser() *browser {
+	p := &csrf.Protector{Sessions: &session.Manager{
+		Keys:  [][]byte{[]byte("0123456789abcdef0123456789abcdef")},
+		Store: &session.MemoryStore{},
+	}}
+	h := p.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, p.Token(r))
+	}))
+	return &browser{p, h, make(map[string]*http.Cookie)}
+}
+
+// do serves the request with the cookies of the browser, and returns the
+// status and body of the response.
+func (b *browser) do(r *http.Request) (int, string) {
+	for _, c := range b.cookies {
+		r.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	b.h.ServeHTTP(w, r)
+	for _, c := range w.Result().Cookies() {
+		b.cookies[c.Name] = c
+	}
+	return w.Code, w.Body.String()
+}
+
+// token gets a page, and returns the token in it.
+func (b *browser) token(t *testing.T) string {
+	t.Helper()
+	code, tok := b.do(httptest.NewRequest("GET", "/", nil))
+	if code != http.StatusOK || len(tok) == 0 {
+		t.Fatalf("get: got %v %q, want a token", code, tok)
+	}
+	return tok
+}
+
+// post posts to the handler with the token in the header.
+func (b *browser) post(tok string) int {
+	r := httptest.NewRequest("POST", "/", nil)
+	if len(tok) > 0 {
+		r.Header.Set(csrf.HeaderName, tok)
+	}
+	code, _ := b.do(r)
+	return code
+}
+
+func TestToken(t *testing.T) {
+	b := newBrowser()
+	// The first page already has a token, for the session just started.
+	first := b.token(t)
+	if _, ok := b.cookies["session"]; !ok {
+		t.Fatalf("no session started")
+	}
+	second := b.token(t)
+	if first == second {
+		t.Errorf("got the same token twice, want them masked differently")
+	}
+	for _, tok := range []string{first, second} {
+		if code := b.post(tok); code != http.StatusOK {
+			t.Errorf("post with token %q: got %v, want 200", tok, code)
+		}
+	}
+}
+
+func TestFormField(t *testing.T) {
+	b := newBrowser()
+	tok := b.token(t)
+	r := httptest.NewRequest("POST", "/", strings.NewReader(url.Values{csrf.FieldName: {tok}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if code, _ := b.do(r); code != http.StatusOK {
+		t.Errorf("post with the form field: got %v, want 200", code)
+	}
+	want := `<input type="hidden" name="csrf_token" value="a&lt;b">`
+	if got := string(csrf.Field("a<b")); got != want {
+		t.Errorf("field: got %q, want %q", got, want)
+	}
+}
+
+func TestRejected(t *testing.T) {
+	b := newBrowser()
+	tok := b.token(t)
+	// Another browser of the same application.
+	other := &browser{b.p, b.h, make(map[string]*http.Cookie)}
+	otherTok := other.token(t)
+
+	for _, tc := range []struct {
+		name string
+		tok  string
+	}{
+		{"no token", ""},
+		{"malformed token", "not base64!"},
+		{"short token", tok[:len(tok)/2]},
+		{"modified token", tok[:len(tok)-4] + "AAAA"},
+		{"token of another session", otherTok},
+	} {
+		if code := b.post(tc.tok); code != http.StatusForbidden {
+			t.Errorf("%v: got %v, want 403", tc.name, code)
+		}
+	}
+
+	// Only the requests with unsafe methods are checked.
+	for _, m := range []string{"GET", "HEAD", "OPTIONS"} {
+		if err := b.p.Check(httptest.NewRequest(m, "/", nil)); err != nil {
+			t.Errorf("%v without token: %v", m, err)
+		}
+	}
+	for _, m := range []string{"POST", "PUT", "DELETE", "PATCH"} {
+		if err := b.p.Check(httptest.NewRequest(m, "/", nil)); err != csrf.ErrNoSession {
+			t.Errorf("%v without session: got %v, want %v", m, err, csrf.ErrNoSession)
+		}
+	}
+}
+
+func TestNewSession(t *testing.T) {
+	b := newBrowser()
+	tok := b.token(t)
+
+	// Signing out, or in, destroys the session, and its tokens with it.
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, c := range b.cookies {
+		r.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	if err := b.p.Sessions.Destroy(w, r); err != nil {
+		t.Fatalf("destroy: %v", err)
+	}
+	delete(b.cookies, "session")
+	b.token(t)
+	if code := b.post(tok); code != http.StatusForbidden {
+		t.Errorf("post with the token of a destroyed session: got %v, want 403", code)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+//go:build appengine
+// +build appengine
+
+package identity
+
+import (
+	"net/http"
+
+	"appengine"
+	"appengine/user"
+)
+
+// AppEngine identifies the users with the App Engine users service.
+type AppEngine struct{}
+
+func (AppEngine) Current(r *http.Request) (*Identity, error) {
+	u := user.Current(appengine.NewContext(r))
+	if u == nil {
+		return nil, nil
+	}
+	return &Identity{
+		ID:       u.ID,
+		Email:    u.Email,
+		Name:     u.String(),
+		Admin:    u.Admin,
+		Provider: "appengine",
+	}, nil
+}
+
+func (AppEngine) LoginURL(r *http.Request, dest string) (string, error) {
+	return user.LoginURL(appengine.NewContext(r), dest)
+}
+
+func (AppEngine) LogoutURL(r *http.Request, dest string) (string, error) {
+	return user.LogoutURL(appengine.NewContext(r), dest)
+}
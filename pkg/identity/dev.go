@@ -0,0 +1,81 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Dev signs in anyone as the user with the email they type, with no password.
+// It must only be used for local development.
+type Dev struct {
+	Store Store
+}
+
+func (d *Dev) Current(r *http.Request) (*Identity, error) {
+	return d.Store.Load(r)
+}
+
+func (d *Dev) LoginURL(r *http.Request, dest string) (string, error) {
+	return LoginPath + "?" + url.Values{"dest": {dest}}.Encode(), nil
+}
+
+func (d *Dev) LogoutURL(r *http.Request, dest string) (string, error) {
+	return LogoutPath + "?" + url.Values{"dest": {dest}}.Encode(), nil
+}
+
+var devLoginTmpl = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<title>Development sign in</title>
+<form method="POST" action="` + LoginPath + `">
+<input type="hidden" name="dest" value="{{.}}">
+<p><label>Email <input type="email" name="email" required autofocus></label></p>
+<p><label><input type="checkbox" name="admin" value="1"> Sign in as an administrator</label></p>
+<p><input type="submit" value="Sign in"></p>
+</form>
+`))
+
+// ServeHTTP serves a form to sign in as any user and signs out the user.
+func (d *Dev) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	dest := localPath(r.FormValue("dest"))
+	switch {
+	case r.URL.Path == LoginPath && r.Method == "POST":
+		email := strings.TrimSpace(r.FormValue("email"))
+		if len(email) == 0 {
+			http.Error(w, "missing email", http.StatusBadRequest)
+			return
+		}
+		name := email
+		if i := strings.Index(email, "@"); i > 0 {
+			name = email[:i]
+		}
+		id := &Identity{
+			ID:       email,
+			Email:    email,
+			Name:     name,
+			Admin:    r.FormValue("admin") == "1",
+			Provider: "dev",
+		}
+		if err := d.Store.Save(w, r, id); err != nil {
+			http.Error(w, fmt.Sprintf("save identity: %v", err), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, dest, http.StatusFound)
+	case r.URL.Path == LoginPath:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		devLoginTmpl.Execute(w, dest)
+	case r.URL.Path == LogoutPath:
+		if err := d.Store.Clear(w, r); err != nil {
+			http.Error(w, fmt.Sprintf("clear identity: %v", err), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, dest, http.StatusFound)
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+// The identity package identifies the users of a web application with
+// pluggable providers.
+//
+// Three implementations of Authenticator are provided: OIDC, which signs in
+// the users with any OpenID Connect provider, Dev, which lets anyone sign in
+// as any user for local development, and on App Engine one backed by the App
+// Engine users service.
+package identity
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/campoy/goconf/pkg/session"
+)
+
+// Prefix is the path prefix of the handlers of the authenticators that
+// implement http.Handler, which should be registered on it.
+const Prefix = "/_identity/"
+
+// Paths of the handlers served by the authenticators under Prefix.
+const (
+	LoginPath    = Prefix + "login"
+	CallbackPath = Prefix + "callback"
+	LogoutPath   = Prefix + "logout"
+)
+
+// An Identity is a signed in user.
+type Identity struct {
+	ID       string // unique and stable for the provider
+	Email    string
+	Name     string
+	Admin    bool   // whether the user administers the application
+	Provider string // name of the provider that identified the user
+}
+
+// An Authenticator identifies the users making requests and signs them in
+// and out.
+type Authenticator interface {
+	// Current returns the user making the request, nil if not signed in.
+	Current(r *http.Request) (*Identity, error)
+	// LoginURL returns the URL that signs in the user and then redirects
+	// to dest.
+	LoginURL(r *http.Request, dest string) (string, error)
+	// LogoutURL returns the URL that signs out the user and then redirects
+	// to dest.
+	LogoutURL(r *http.Request, dest string) (string, error)
+}
+
+// A Store keeps the identity of the signed in user between requests.
+type Store interface {
+	// Load returns the identity saved for the request, nil if none.
+	Load(r *http.Request) (*Identity, error)
+	Save(w http.ResponseWriter, r *http.Request, id *Identity) error
+	Clear(w http.ResponseWriter, r *http.Request) error
+}
+
+// identityKey is the session value keeping the identity of the user.
+const identityKey = "identity"
+
+// A SessionStore keeps the identity in a session, so it expires with it and
+// signing out invalidates it.
+type SessionStore struct {
+	Sessions *session.Manager
+}
+
+func (s *SessionStore) Load(r *http.Request) (*Identity, error) {
+	sess, err := s.Sessions.Get(r)
+	if err != nil || sess == nil {
+		return nil, err
+	}
+	v, ok := sess.Values[identityKey]
+	if !ok {
+		return nil, nil
+	}
+	var id Identity
+	if err := json.Unmarshal([]byte(v), &id); err != nil {
+		return nil, fmt.Errorf("decode identity: %v", err)
+	}
+	return &id, nil
+}
+
+// Save saves the identity in a new session, invalidating the previous one,
+// so sessions started before signing in can't be reused.
+func (s *SessionStore) Save(w http.ResponseWriter, r *http.Request, id *Identity) error {
+	if err := s.Sessions.Destroy(w, r); err != nil {
+		return err
+	}
+	sess, err := s.Sessions.New()
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(id)
+	if err != nil {
+		return fmt.Errorf("encode identity: %v", err)
+	}
+	sess.Values[identityKey] = string(b)
+	return s.Sessions.Save(w, r, sess)
+}
+
+func (s *SessionStore) Clear(w http.ResponseWriter, r *http.Request) error {
+	return s.Sessions.Destroy(w, r)
+}
+
+// setCookie sets an HTTP only cookie for the whole application, only sent
+// over HTTPS if secure.
+func setCookie(w http.ResponseWriter, secure bool, name, value string, exp time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  exp,
+		HttpOnly: true,
+		Secure:   secure,
+	})
+}
+
+// secure returns whether the application is served over HTTPS, from the
+// scheme of one of its URLs. It can't be told from the requests, since front
+// ends like App Engine's terminate TLS.
+func secure(appURL string) bool {
+	return strings.HasPrefix(strings.ToLower(appURL), "https:")
+}
+
+var errBadSignature = errors.New("bad signature")
+
+// sign encodes v as JSON followed by its HMAC-SHA256 with the given key.
+func sign(key []byte, v interface{}) (string, error) {
+	if len(key) < 32 {
+		return "", fmt.Errorf("signing keys need at least 32 bytes")
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("encode: %v", err)
+	}
+	m := hmac.New(sha256.New, key)
+	m.Write(b)
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(b) + "." + enc.EncodeToString(m.Sum(nil)), nil
+}
+
+// verify checks the signature of a value encoded by sign and decodes it
+// into v.
+func verify(key []byte, s string, v interface{}) error {
+	i := strings.LastIndex(s, ".")
+	if i < 0 || len(key) < 32 {
+		return errBadSignature
+	}
+	enc := base64.RawURLEncoding
+	b, err := enc.DecodeString(s[:i])
+	if err != nil {
+		return errBadSignature
+	}
+	sum, err := enc.DecodeString(s[i+1:])
+	if err != nil {
+		return errBadSignature
+	}
+	m := hmac.New(sha256.New, key)
+	m.Write(b)
+	if !hmac.Equal(sum, m.Sum(nil)) {
+		return errBadSignature
+	}
+	return json.Unmarshal(b, v)
+}
+
+// randomString returns a random URL safe string with n bytes of entropy.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("read random bytes: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// localPath returns dest if it's a path in this application, "/" otherwise,
+// so the handlers can't be used to redirect to other sites.
+func localPath(dest string) string {
+	if !strings.HasPrefix(dest, "/") || strings.HasPrefix(dest, "//") || strings.HasPrefix(dest, "/\\") {
+		return "/"
+	}
+	return dest
+}
+
+// isAdmin returns whether email is in the list of admins.
+func isAdmin(admins []string, email string) bool {
+	for _, a := range admins {
+		if strings.EqualFold(a, email) {
+			return true
+		}
+	}
+	return false
+}
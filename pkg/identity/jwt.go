@@ -0,0 +1,181 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// clockSkew is the difference allowed between the clocks of the provider
+// and the application.
+const clockSkew = 2 * time.Minute
+
+// claims are the claims of an ID token used to identify the user.
+type claims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	Expires       int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified *bool    `json:"email_verified"`
+	Name          string   `json:"name"`
+}
+
+// audience is the aud claim, which can be a string or a list of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// keySet is the set of public keys of a provider, by key id.
+type keySet struct {
+	keys    map[string]*rsa.PublicKey
+	fetched time.Time
+}
+
+// jwk is a JSON web key, only RSA keys are supported.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// fetchKeys fetches the public keys of the provider.
+func fetchKeys(c *http.Client, u string) (*keySet, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(c, u, &doc); err != nil {
+		return nil, fmt.Errorf("fetch keys: %v", err)
+	}
+	ks := &keySet{keys: make(map[string]*rsa.PublicKey), fetched: time.Now()}
+	enc := base64.RawURLEncoding
+	for _, k := range doc.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := enc.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("bad modulus in key %q: %v", k.Kid, err)
+		}
+		e, err := enc.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("bad exponent in key %q: %v", k.Kid, err)
+		}
+		ks.keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return ks, nil
+}
+
+// key returns the public key of the provider with the given id. The keys
+// are fetched again when the id is unknown, since providers rotate them, but
+// not more than once a minute.
+func (o *OIDC) key(r *http.Request, d *discovery, kid string) (*rsa.PublicKey, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.keys != nil {
+		if k, ok := o.keys.keys[kid]; ok {
+			return k, nil
+		}
+		if time.Since(o.keys.fetched) < time.Minute {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+	}
+	ks, err := fetchKeys(o.client(r), d.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	o.keys = ks
+	if k, ok := ks.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// verifyIDToken checks the RS256 signature of the ID token and that it was
+// issued by the provider for this client and hasn't expired, and returns its
+// claims.
+func (o *OIDC) verifyIDToken(r *http.Request, d *discovery, tok string) (*claims, error) {
+	parts := strings.Split(tok, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+	enc := base64.RawURLEncoding
+
+	var h struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	b, err := enc.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("decode header: %v", err)
+	}
+	if err := json.Unmarshal(b, &h); err != nil {
+		return nil, fmt.Errorf("decode header: %v", err)
+	}
+	if h.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported algorithm %q", h.Alg)
+	}
+	k, err := o.key(r, d, h.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("decode signature: %v", err)
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig); err != nil {
+		return nil, fmt.Errorf("bad signature: %v", err)
+	}
+
+	var cl claims
+	if b, err = enc.DecodeString(parts[1]); err != nil {
+		return nil, fmt.Errorf("decode claims: %v", err)
+	}
+	if err := json.Unmarshal(b, &cl); err != nil {
+		return nil, fmt.Errorf("decode claims: %v", err)
+	}
+	if cl.Issuer != d.Issuer {
+		return nil, fmt.Errorf("issued by %q instead of %q", cl.Issuer, d.Issuer)
+	}
+	if !cl.Audience.contains(o.ClientID) {
+		return nil, fmt.Errorf("issued for %q", cl.Audience)
+	}
+	if time.Now().Add(-clockSkew).Unix() > cl.Expires {
+		return nil, fmt.Errorf("expired")
+	}
+	return &cl, nil
+}
@@ -0,0 +1,274 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// flowCookie is the name of the cookie keeping the state of a sign in while
+// the user is at the provider, and flowMaxAge how long it's kept.
+const (
+	flowCookie = "identity_flow"
+	flowMaxAge = 10 * time.Minute
+)
+
+// OIDC signs in the users with an OpenID Connect provider using the
+// authorization code flow with PKCE. The endpoints of the provider are
+// discovered from its issuer URL.
+type OIDC struct {
+	Issuer       string // issuer URL, like https://accounts.google.com
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string   // absolute URL of CallbackPath in the application
+	Scopes       []string // "openid email profile" if empty
+	Admins       []string // emails of the administrators of the application
+	// TrustEmails accepts the emails in the ID tokens that don't have a true
+	// email_verified claim. It should only be set for issuers that only
+	// return verified emails but don't say so, like some corporate ones.
+	TrustEmails bool
+
+	// Key signs the cookie keeping the state of a sign in, at least 32 bytes.
+	Key []byte
+	// Store keeps the identity of the user once signed in.
+	Store Store
+	// Client returns the client used to call the provider for a request,
+	// http.DefaultClient if nil.
+	Client func(r *http.Request) *http.Client
+
+	mu   sync.Mutex
+	disc *discovery
+	keys *keySet
+}
+
+// discovery is the metadata of an OpenID Connect provider.
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+// flow is the state of a sign in, kept in a signed cookie.
+type flow struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"` // PKCE code verifier
+	Dest     string `json:"dest"`
+	Expires  int64  `json:"exp"`
+}
+
+func (o *OIDC) client(r *http.Request) *http.Client {
+	if o.Client == nil {
+		return http.DefaultClient
+	}
+	return o.Client(r)
+}
+
+// getJSON fetches a JSON document from the given URL and decodes it into v.
+func getJSON(c *http.Client, u string, v interface{}) error {
+	res, err := c.Get(u)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %v: %v", u, res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// discover returns the metadata of the provider, fetched once.
+func (o *OIDC) discover(r *http.Request) (*discovery, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.disc != nil {
+		return o.disc, nil
+	}
+	u := strings.TrimSuffix(o.Issuer, "/") + "/.well-known/openid-configuration"
+	var d discovery
+	if err := getJSON(o.client(r), u, &d); err != nil {
+		return nil, fmt.Errorf("discover %v: %v", o.Issuer, err)
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != strings.TrimSuffix(o.Issuer, "/") {
+		return nil, fmt.Errorf("discovered issuer %q instead of %q", d.Issuer, o.Issuer)
+	}
+	o.disc = &d
+	return o.disc, nil
+}
+
+func (o *OIDC) Current(r *http.Request) (*Identity, error) {
+	return o.Store.Load(r)
+}
+
+func (o *OIDC) LoginURL(r *http.Request, dest string) (string, error) {
+	return LoginPath + "?" + url.Values{"dest": {dest}}.Encode(), nil
+}
+
+func (o *OIDC) LogoutURL(r *http.Request, dest string) (string, error) {
+	return LogoutPath + "?" + url.Values{"dest": {dest}}.Encode(), nil
+}
+
+// ServeHTTP starts and completes the sign in with the provider, and signs
+// out the user.
+func (o *OIDC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var err error
+	switch r.URL.Path {
+	case LoginPath:
+		err = o.login(w, r)
+	case CallbackPath:
+		err = o.callback(w, r)
+	case LogoutPath:
+		err = o.logout(w, r)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%v: %v", r.URL.Path, err), http.StatusBadRequest)
+	}
+}
+
+// login redirects the user to the provider, keeping the state, nonce and
+// PKCE verifier of the sign in in a cookie.
+func (o *OIDC) login(w http.ResponseWriter, r *http.Request) error {
+	d, err := o.discover(r)
+	if err != nil {
+		return err
+	}
+	f := flow{
+		Dest:    localPath(r.FormValue("dest")),
+		Expires: time.Now().Add(flowMaxAge).Unix(),
+	}
+	for _, p := range []*string{&f.State, &f.Nonce, &f.Verifier} {
+		if *p, err = randomString(32); err != nil {
+			return err
+		}
+	}
+	v, err := sign(o.Key, f)
+	if err != nil {
+		return fmt.Errorf("sign flow: %v", err)
+	}
+	setCookie(w, secure(o.RedirectURL), flowCookie, v, time.Now().Add(flowMaxAge))
+
+	scopes := o.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	challenge := sha256.Sum256([]byte(f.Verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.ClientID},
+		"redirect_uri":          {o.RedirectURL},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {f.State},
+		"nonce":                 {f.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	http.Redirect(w, r, d.AuthorizationEndpoint+"?"+q.Encode(), http.StatusFound)
+	return nil
+}
+
+// callback exchanges the code sent back by the provider for an ID token,
+// verifies it and saves the identity of the user.
+func (o *OIDC) callback(w http.ResponseWriter, r *http.Request) error {
+	if e := r.FormValue("error"); len(e) > 0 {
+		return fmt.Errorf("provider error %q: %v", e, r.FormValue("error_description"))
+	}
+	c, err := r.Cookie(flowCookie)
+	if err != nil {
+		return fmt.Errorf("no sign in in progress")
+	}
+	setCookie(w, secure(o.RedirectURL), flowCookie, "", time.Unix(0, 0))
+	var f flow
+	if err := verify(o.Key, c.Value, &f); err != nil || time.Now().Unix() > f.Expires {
+		return fmt.Errorf("sign in expired, try again")
+	}
+	if r.FormValue("state") != f.State {
+		return fmt.Errorf("unexpected state")
+	}
+
+	d, err := o.discover(r)
+	if err != nil {
+		return err
+	}
+	res, err := o.client(r).PostForm(d.TokenEndpoint, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {r.FormValue("code")},
+		"redirect_uri":  {o.RedirectURL},
+		"client_id":     {o.ClientID},
+		"client_secret": {o.ClientSecret},
+		"code_verifier": {f.Verifier},
+	})
+	if err != nil {
+		return fmt.Errorf("exchange code: %v", err)
+	}
+	defer res.Body.Close()
+	var tok struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&tok); err != nil {
+		return fmt.Errorf("decode token response: %v", err)
+	}
+	if res.StatusCode != http.StatusOK || len(tok.Error) > 0 {
+		return fmt.Errorf("exchange code: %v %v", res.Status, tok.Error)
+	}
+
+	cl, err := o.verifyIDToken(r, d, tok.IDToken)
+	if err != nil {
+		return fmt.Errorf("verify ID token: %v", err)
+	}
+	if cl.Nonce != f.Nonce {
+		return fmt.Errorf("unexpected nonce in ID token")
+	}
+	verified := cl.EmailVerified != nil && *cl.EmailVerified
+	if len(cl.Email) == 0 || !verified && !o.TrustEmails {
+		return fmt.Errorf("the provider didn't return a verified email")
+	}
+	id := &Identity{
+		ID:       cl.Subject,
+		Email:    cl.Email,
+		Name:     cl.Name,
+		Admin:    isAdmin(o.Admins, cl.Email),
+		Provider: d.Issuer,
+	}
+	if err := o.Store.Save(w, r, id); err != nil {
+		return fmt.Errorf("save identity: %v", err)
+	}
+	http.Redirect(w, r, f.Dest, http.StatusFound)
+	return nil
+}
+
+// logout forgets the identity of the user, and signs out at the provider if
+// it supports it.
+func (o *OIDC) logout(w http.ResponseWriter, r *http.Request) error {
+	if err := o.Store.Clear(w, r); err != nil {
+		return fmt.Errorf("clear identity: %v", err)
+	}
+	dest := localPath(r.FormValue("dest"))
+	if d, err := o.discover(r); err == nil && len(d.EndSessionEndpoint) > 0 {
+		base, err := url.Parse(o.RedirectURL)
+		if err == nil {
+			u, _ := base.Parse(dest)
+			dest = d.EndSessionEndpoint + "?" + url.Values{
+				"client_id":                {o.ClientID},
+				"post_logout_redirect_uri": {u.String()},
+			}.Encode()
+		}
+	}
+	http.Redirect(w, r, dest, http.StatusFound)
+	return nil
+}
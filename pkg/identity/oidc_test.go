@@ -0,0 +1,321 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package identity_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/campoy/goconf/pkg/auth/authtest"
+	"github.com/campoy/goconf/pkg/identity"
+	"github.com/campoy/goconf/pkg/session"
+)
+
+var key = []byte("0123456789abcdef0123456789abcdef")
+
+// oidcTest signs in with an OIDC authenticator against a fake provider.
+type oidcTest struct {
+	srv *authtest.Server
+	o   *identity.OIDC
+	// rewrite, if not nil, rewrites the ID tokens returned by the provider.
+	rewrite func(tok string) string
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+	srv := authtest.NewServer()
+	t.Cleanup(srv.Close)
+	c := &oidcTest{srv: srv}
+	c.o = &identity.OIDC{
+		Issuer:       srv.URL,
+		ClientID:     srv.ClientID,
+		ClientSecret: srv.ClientSecret,
+		RedirectURL:  "https://app.example.com" + identity.CallbackPath,
+		Admins:       []string{"admin@example.com"},
+		Key:          key,
+		Store: &identity.SessionStore{Sessions: &session.Manager{
+			Keys:  [][]byte{key},
+			Store: &session.MemoryStore{},
+		}},
+		Client: func(r *http.Request) *http.Client {
+			return &http.Client{Transport: roundTripper(c.roundTrip)}
+		},
+	}
+	return c
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// roundTrip sends the request to the provider, rewriting the ID token in the
+// responses of its token endpoint.
+func (c *oidcTest) roundTrip(r *http.Request) (*http.Response, error) {
+	res, err := c.srv.Client().Transport.RoundTrip(r)
+	if err != nil || c.rewrite == nil || r.URL.Path != authtest.TokenPath {
+		return res, err
+	}
+	defer res.Body.Close()
+	var body map[string]interface{}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	if tok, ok := body["id_token"].(string); ok {
+		body["id_token"] = c.rewrite(tok)
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(b))
+	res.ContentLength = int64(len(b))
+	res.Header.Del("Content-Length")
+	return res, nil
+}
+
+// serve serves the request with the authenticator.
+func (c *oidcTest) serve(r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c.o.ServeHTTP(w, r)
+	return w
+}
+
+// login starts a sign in, and returns the URL of the provider the user is
+// sent to and the cookie keeping the flow.
+func (c *oidcTest) login(t *testing.T, dest string) (string, *http.Cookie) {
+	t.Helper()
+	w := c.serve(httptest.NewRequest("GET", identity.LoginPath+"?dest="+url.QueryEscape(dest), nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: got %v %s, want a redirect", w.Code, w.Body)
+	}
+	for _, ck := range w.Result().Cookies() {
+		if ck.Name == "identity_flow" {
+			return w.Header().Get("Location"), ck
+		}
+	}
+	t.Fatalf("login didn't set the flow cookie")
+	return "", nil
+}
+
+// authorize follows the user to the provider, and returns the query the
+// provider sends back to the callback.
+func (c *oidcTest) authorize(t *testing.T, authURL string) url.Values {
+	t.Helper()
+	client := &http.Client{
+		Transport:     c.srv.Client().Transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	res, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	res.Body.Close()
+	back, err := url.Parse(res.Header.Get("Location"))
+	if err != nil || back.Path != identity.CallbackPath {
+		t.Fatalf("authorize: got redirect to %q, want the callback", res.Header.Get("Location"))
+	}
+	return back.Query()
+}
+
+// callback serves the callback with the query and the flow cookie, if any.
+func (c *oidcTest) callback(q url.Values, flow *http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", identity.CallbackPath+"?"+q.Encode(), nil)
+	if flow != nil {
+		r.AddCookie(flow)
+	}
+	return c.serve(r)
+}
+
+// signIn signs in through the provider, and returns the response of the
+// callback.
+func (c *oidcTest) signIn(t *testing.T, dest string) *httptest.ResponseRecorder {
+	t.Helper()
+	authURL, flow := c.login(t, dest)
+	return c.callback(c.authorize(t, authURL), flow)
+}
+
+// current returns the identity of the user for the cookies set in w.
+func (c *oidcTest) current(t *testing.T, w *httptest.ResponseRecorder) *identity.Identity {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/", nil)
+	cs := make(map[string]*http.Cookie)
+	for _, ck := range w.Result().Cookies() {
+		cs[ck.Name] = ck
+	}
+	for _, ck := range cs {
+		if ck.MaxAge >= 0 && len(ck.Value) > 0 {
+			r.AddCookie(ck)
+		}
+	}
+	id, err := c.o.Current(r)
+	if err != nil {
+		t.Fatalf("current: %v", err)
+	}
+	return id
+}
+
+func TestSignIn(t *testing.T) {
+	c := newOIDCTest(t)
+	w := c.signIn(t, "/schedule?id=1")
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/schedule?id=1" {
+		t.Fatalf("callback: got %v %q %s, want a redirect to the destination", w.Code, w.Header().Get("Location"), w.Body)
+	}
+	want := identity.Identity{ID: "1", Email: "test@example.com", Name: "Test User", Provider: c.srv.URL}
+	if id := c.current(t, w); id == nil || *id != want {
+		t.Errorf("got identity %+v, want %+v", id, want)
+	}
+
+	c.srv.User = authtest.User{Subject: "2", Email: "admin@example.com"}
+	if id := c.current(t, c.signIn(t, "/")); id == nil || !id.Admin {
+		t.Errorf("got identity %+v, want an administrator", id)
+	}
+
+	// Only local destinations are followed.
+	if loc := c.signIn(t, "//evil.example.com/").Header().Get("Location"); loc != "/" {
+		t.Errorf("sign in to another site: redirected to %q, want /", loc)
+	}
+}
+
+func TestIDTokenClaims(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		edit  func(cl map[string]interface{})
+		trust bool // set TrustEmails
+		ok    bool
+	}{
+		{"another issuer", func(cl map[string]interface{}) { cl["iss"] = "https://evil.example.com" }, false, false},
+		{"another audience", func(cl map[string]interface{}) { cl["aud"] = "other" }, false, false},
+		{"several audiences", func(cl map[string]interface{}) { cl["aud"] = []string{"other", cl["aud"].(string)} }, false, true},
+		{"expired", func(cl map[string]interface{}) { cl["exp"] = time.Now().Add(-time.Hour).Unix() }, false, false},
+		{"expired within the clock skew", func(cl map[string]interface{}) { cl["exp"] = time.Now().Add(-time.Minute).Unix() }, false, true},
+		{"another nonce", func(cl map[string]interface{}) { cl["nonce"] = "other" }, false, false},
+		{"no nonce", func(cl map[string]interface{}) { delete(cl, "nonce") }, false, false},
+		{"unverified email", func(cl map[string]interface{}) { cl["email_verified"] = false }, false, false},
+		{"unverified email, trusted", func(cl map[string]interface{}) { cl["email_verified"] = false }, true, true},
+		{"no email_verified", func(cl map[string]interface{}) { delete(cl, "email_verified") }, false, false},
+		{"no email_verified, trusted", func(cl map[string]interface{}) { delete(cl, "email_verified") }, true, true},
+		{"no email, trusted", func(cl map[string]interface{}) { delete(cl, "email") }, true, false},
+	} {
+		c := newOIDCTest(t)
+		c.srv.IDTokenClaims = tc.edit
+		c.o.TrustEmails = tc.trust
+		w := c.signIn(t, "/")
+		id := c.current(t, w)
+		if tc.ok && (w.Code != http.StatusFound || id == nil) {
+			t.Errorf("%v: got %v %s, %+v, want signed in", tc.name, w.Code, w.Body, id)
+		}
+		if !tc.ok && (w.Code != http.StatusBadRequest || id != nil) {
+			t.Errorf("%v: got %v, %+v, want rejected", tc.name, w.Code, id)
+		}
+	}
+}
+
+func TestIDTokenSignature(t *testing.T) {
+	enc := base64.RawURLEncoding
+	header := func(h string) func(tok string) string {
+		return func(tok string) string {
+			return enc.EncodeToString([]byte(h)) + tok[strings.Index(tok, "."):]
+		}
+	}
+	for _, tc := range []struct {
+		name    string
+		rewrite func(tok string) string
+		want    string
+	}{
+		{"modified signature", func(tok string) string {
+			sig := []byte(tok[strings.LastIndex(tok, ".")+1:])
+			if sig[0] == 'A' {
+				sig[0] = 'B'
+			} else {
+				sig[0] = 'A'
+			}
+			return tok[:strings.LastIndex(tok, ".")+1] + string(sig)
+		}, "signature"},
+		{"modified claims", func(tok string) string {
+			parts := strings.Split(tok, ".")
+			b, _ := enc.DecodeString(parts[1])
+			b = bytes.Replace(b, []byte("test@example.com"), []byte("evil@example.com"), 1)
+			return parts[0] + "." + enc.EncodeToString(b) + "." + parts[2]
+		}, "signature"},
+		{"no signature", func(tok string) string {
+			return header(`{"alg":"none"}`)(tok[:strings.LastIndex(tok, ".")+1])
+		}, "algorithm"},
+		{"HMAC", header(`{"alg":"HS256","typ":"JWT"}`), "algorithm"},
+		{"unknown key", header(`{"alg":"RS256","typ":"JWT","kid":"other"}`), "key"},
+		{"malformed", func(string) string { return "not a token" }, "token"},
+	} {
+		c := newOIDCTest(t)
+		c.rewrite = tc.rewrite
+		w := c.signIn(t, "/")
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tc.want) {
+			t.Errorf("%v: got %v %q, want a 400 about the %v", tc.name, w.Code, w.Body, tc.want)
+		}
+		if id := c.current(t, w); id != nil {
+			t.Errorf("%v: signed in as %+v", tc.name, id)
+		}
+	}
+}
+
+func TestFlowCookie(t *testing.T) {
+	c := newOIDCTest(t)
+	authURL, flow := c.login(t, "/")
+	if !flow.Secure || !flow.HttpOnly {
+		t.Errorf("flow cookie isn't secure and HTTP only")
+	}
+	q := c.authorize(t, authURL)
+
+	tampered := *flow
+	tampered.Value = "A" + flow.Value[1:]
+	if tampered.Value == flow.Value {
+		tampered.Value = "B" + flow.Value[1:]
+	}
+	otherKey := newOIDCTest(t)
+	otherKey.o.Key = []byte("fedcba9876543210fedcba9876543210")
+	_, signedElsewhere := otherKey.login(t, "/")
+	// The flow of another sign in has another state and nonce.
+	_, another := c.login(t, "/")
+	wrongState := url.Values{"code": {q.Get("code")}, "state": {"other"}}
+
+	for _, tc := range []struct {
+		name string
+		q    url.Values
+		flow *http.Cookie
+	}{
+		{"no flow cookie", q, nil},
+		{"tampered flow cookie", q, &tampered},
+		{"flow cookie signed with another key", q, signedElsewhere},
+		{"flow cookie of another sign in", q, another},
+		{"another state", wrongState, flow},
+		{"provider error", url.Values{"error": {"access_denied"}, "state": {q.Get("state")}}, flow},
+	} {
+		w := c.callback(tc.q, tc.flow)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%v: got %v, want 400", tc.name, w.Code)
+		}
+		if id := c.current(t, w); id != nil {
+			t.Errorf("%v: signed in as %+v", tc.name, id)
+		}
+	}
+
+	// The callback clears the flow cookie, so it can't be replayed.
+	w := c.callback(q, flow)
+	if w.Code != http.StatusFound {
+		t.Fatalf("callback: got %v %s, want a redirect", w.Code, w.Body)
+	}
+	cleared := false
+	for _, ck := range w.Result().Cookies() {
+		cleared = cleared || ck.Name == "identity_flow" && len(ck.Value) == 0
+	}
+	if !cleared {
+		t.Errorf("callback didn't clear the flow cookie")
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+//go:build appengine
+// +build appengine
+
+package search
+
+import (
+	"fmt"
+	"strings"
+
+	"appengine"
+	aesearch "appengine/search"
+)
+
+// appEngineIndex is an Index backed by the App Engine search API.
+type appEngineIndex struct {
+	ctx appengine.Context
+	idx *aesearch.Index
+}
+
+// AppEngine returns an Index backed by the App Engine search index with the
+// given name, performing all its operations with the given context.
+func AppEngine(ctx appengine.Context, name string) (Index, error) {
+	idx, err := aesearch.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("open index %q: %v", name, err)
+	}
+	return &appEngineIndex{ctx, idx}, nil
+}
+
+// Put adds a document to the index, replacing any document with the same id.
+func (x *appEngineIndex) Put(id string, doc Document) error {
+	fs := make(aesearch.FieldList, 0, len(doc))
+	for name, text := range doc {
+		fs = append(fs, aesearch.Field{Name: name, Value: text})
+	}
+	_, err := x.idx.Put(x.ctx, id, &fs)
+	return err
+}
+
+// Delete removes a document from the index.
+func (x *appEngineIndex) Delete(id string) error {
+	return x.idx.Delete(x.ctx, id)
+}
+
+// Search returns at most limit documents matching all the words of the
+// query, the most relevant first. The words are searched with the stemming
+// of the App Engine search API.
+func (x *appEngineIndex) Search(query string, limit int) ([]Hit, error) {
+	var words []string
+	for _, t := range tokens(query) {
+		if _, ok := termOf(t.word); ok {
+			words = append(words, "~"+strings.ToLower(t.word))
+		}
+	}
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	terms := Terms(query)
+	it := x.idx.Search(x.ctx, strings.Join(words, " AND "), &aesearch.SearchOptions{
+		Limit: limit,
+		Sort: &aesearch.SortOptions{
+			Expressions: []aesearch.SortExpression{{Expr: "_score", Default: 0.0}},
+			Scorer:      aesearch.MatchScorer,
+		},
+		Expressions: []aesearch.FieldExpression{{Name: "score", Expr: "_score"}},
+	})
+
+	var hits []Hit
+	for {
+		var fs aesearch.FieldList
+		id, err := it.Next(&fs)
+		if err == aesearch.Done {
+			return hits, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("search %q: %v", query, err)
+		}
+
+		h := Hit{ID: id, Terms: terms}
+		doc := make(Document)
+		for _, f := range fs {
+			switch v := f.Value.(type) {
+			case float64:
+				if f.Name == "score" {
+					h.Score = v
+				}
+			case string:
+				doc[f.Name] = v
+			}
+		}
+		h.Snippet = Snippet(doc.text(), terms)
+		hits = append(hits, h)
+	}
+}
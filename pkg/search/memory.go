@@ -0,0 +1,142 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package search
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// BM25 ranking parameters.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// A Memory is an inverted index kept in memory, ranking the documents with
+// the BM25 function. It's safe for concurrent use.
+type Memory struct {
+	mu       sync.RWMutex
+	docs     map[string]*memDoc
+	postings map[string]map[string]int // term to document id to frequency
+	totalLen int
+}
+
+type memDoc struct {
+	text  string
+	terms map[string]int
+	len   int
+}
+
+// NewMemory returns a new empty in-memory index.
+func NewMemory() *Memory {
+	return &Memory{
+		docs:     make(map[string]*memDoc),
+		postings: make(map[string]map[string]int),
+	}
+}
+
+// Put adds a document to the index, replacing any document with the same id.
+func (m *Memory) Put(id string, doc Document) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.remove(id)
+	d := &memDoc{text: doc.text(), terms: make(map[string]int)}
+	for _, t := range Terms(d.text) {
+		d.terms[t]++
+		d.len++
+	}
+	for t, n := range d.terms {
+		ps, ok := m.postings[t]
+		if !ok {
+			ps = make(map[string]int)
+			m.postings[t] = ps
+		}
+		ps[id] = n
+	}
+	m.docs[id] = d
+	m.totalLen += d.len
+	return nil
+}
+
+// Delete removes a document from the index.
+func (m *Memory) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(id)
+	return nil
+}
+
+func (m *Memory) remove(id string) {
+	d, ok := m.docs[id]
+	if !ok {
+		return
+	}
+	for t := range d.terms {
+		delete(m.postings[t], id)
+		if len(m.postings[t]) == 0 {
+			delete(m.postings, t)
+		}
+	}
+	delete(m.docs, id)
+	m.totalLen -= d.len
+}
+
+// Search returns at most limit documents matching all the words of the
+// query, the most relevant first.
+func (m *Memory) Search(query string, limit int) ([]Hit, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	terms := Terms(query)
+	if len(terms) == 0 || len(m.docs) == 0 {
+		return nil, nil
+	}
+	n := float64(len(m.docs))
+	avgLen := float64(m.totalLen) / n
+
+	set := termSet(terms)
+	scores := make(map[string]float64)
+	matched := make(map[string]int) // number of terms in each document
+	for t := range set {
+		ps := m.postings[t]
+		idf := math.Log(1 + (n-float64(len(ps))+0.5)/(float64(len(ps))+0.5))
+		for id, freq := range ps {
+			tf := float64(freq)
+			norm := 1 - bm25B + bm25B*float64(m.docs[id].len)/avgLen
+			scores[id] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+			matched[id]++
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, s := range scores {
+		if matched[id] == len(set) {
+			hits = append(hits, Hit{ID: id, Score: s, Terms: terms})
+		}
+	}
+	sort.Sort(byScore(hits))
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	for i := range hits {
+		hits[i].Snippet = Snippet(m.docs[hits[i].ID].text, terms)
+	}
+	return hits, nil
+}
+
+// byScore sorts hits from higher to lower score, and by id on ties.
+type byScore []Hit
+
+func (h byScore) Len() int      { return len(h) }
+func (h byScore) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h byScore) Less(i, j int) bool {
+	if h[i].Score != h[j].Score {
+		return h[i].Score > h[j].Score
+	}
+	return h[i].ID < h[j].ID
+}
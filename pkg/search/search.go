@@ -0,0 +1,239 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+// The search package provides full-text indexes of documents with
+// tokenised, stemmed and ranked queries.
+//
+// Two implementations of Index are provided: an inverted index kept in
+// memory, useful for tests and standalone use, and on App Engine one backed
+// by the App Engine search API.
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// A Document is indexed as a set of named text fields.
+type Document map[string]string
+
+// text returns the text of all the fields of the document, in field name order.
+func (d Document) text() string {
+	names := make([]string, 0, len(d))
+	for n := range d {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	vs := make([]string, len(names))
+	for i, n := range names {
+		vs[i] = d[n]
+	}
+	return strings.Join(vs, " ")
+}
+
+// A Hit is a document matching a query.
+type Hit struct {
+	ID      string
+	Score   float64
+	Snippet string   // text of the document around the first match
+	Terms   []string // stemmed terms of the query, to highlight the snippet
+}
+
+// An Index is a full-text index of documents.
+type Index interface {
+	// Put adds a document to the index, replacing any document with the
+	// same id.
+	Put(id string, doc Document) error
+	// Delete removes a document from the index.
+	Delete(id string) error
+	// Search returns at most limit documents matching all the words of
+	// the query, the most relevant first.
+	Search(query string, limit int) ([]Hit, error)
+}
+
+// stopWords are ignored when indexing and searching.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "for": true, "from": true, "in": true, "is": true,
+	"it": true, "of": true, "on": true, "or": true, "the": true, "to": true,
+	"with": true,
+}
+
+// A token is a word of a text with its position.
+type token struct {
+	word       string // the word as it appears in the text
+	start, end int    // byte offsets of the word in the text
+}
+
+// tokens splits a text into words made of letters and digits.
+func tokens(text string) []token {
+	var ts []token
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case isWord && start < 0:
+			start = i
+		case !isWord && start >= 0:
+			ts = append(ts, token{text[start:i], start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		ts = append(ts, token{text[start:], start, len(text)})
+	}
+	return ts
+}
+
+// Terms returns the stemmed terms of a text, in order of appearance and
+// ignoring stop words.
+func Terms(text string) []string {
+	var terms []string
+	for _, t := range tokens(text) {
+		if term, ok := termOf(t.word); ok {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// termOf returns the stemmed term of a word, or false for stop words.
+func termOf(word string) (string, bool) {
+	w := strings.ToLower(word)
+	if stopWords[w] {
+		return "", false
+	}
+	return Stem(w), true
+}
+
+// suffixes are removed by Stem, the first one matching is used.
+var suffixes = []struct{ suffix, repl string }{
+	{"ational", "ate"},
+	{"ization", "ize"},
+	{"fulness", "ful"},
+	{"iveness", "ive"},
+	{"ousness", "ous"},
+	{"ements", ""},
+	{"ement", ""},
+	{"ments", ""},
+	{"ment", ""},
+	{"ingly", ""},
+	{"ings", ""},
+	{"ing", ""},
+	{"edly", ""},
+	{"ied", "y"},
+	{"ies", "y"},
+	{"sses", "ss"},
+	{"ness", ""},
+	{"ly", ""},
+	{"ed", ""},
+	{"es", ""},
+	{"s", ""},
+}
+
+// Stem reduces an English lowercase word to its stem by removing common
+// inflectional suffixes, so "conferences", "conference" and "conferencing"
+// share the stem "conferenc". Stems of at least three letters are kept.
+func Stem(w string) string {
+	for _, s := range suffixes {
+		if !strings.HasSuffix(w, s.suffix) {
+			continue
+		}
+		stem := w[:len(w)-len(s.suffix)] + s.repl
+		if len(stem) < 3 || strings.HasSuffix(w, "ss") && s.suffix == "s" {
+			return w
+		}
+		if strings.HasSuffix(stem, "e") && s.repl == "" {
+			stem = stem[:len(stem)-1]
+		}
+		// "programming" and "programmed" become "program".
+		if n := len(stem); strings.HasPrefix(s.suffix, "ing") || strings.HasPrefix(s.suffix, "ed") {
+			if stem[n-1] == stem[n-2] && !strings.ContainsRune("lsz", rune(stem[n-1])) {
+				stem = stem[:n-1]
+			}
+		}
+		return stem
+	}
+	if strings.HasSuffix(w, "e") && len(w) > 3 {
+		return w[:len(w)-1]
+	}
+	return w
+}
+
+// snippetWords is the number of words around the first match in a snippet.
+const snippetWords = 30
+
+// Snippet returns the part of the text around the first word matching any
+// of the terms, with at most snippetWords words. Ellipses are added where
+// the text has been cut.
+func Snippet(text string, terms []string) string {
+	ts := tokens(text)
+	if len(ts) <= snippetWords {
+		return text
+	}
+	set := termSet(terms)
+	first := 0
+	for i, t := range ts {
+		if term, ok := termOf(t.word); ok && set[term] {
+			first = i
+			break
+		}
+	}
+
+	from := first - snippetWords/3
+	if from < 0 {
+		from = 0
+	}
+	to := from + snippetWords
+	if to > len(ts) {
+		to, from = len(ts), len(ts)-snippetWords
+	}
+
+	start, end := ts[from].start, ts[to-1].end
+	s := text[start:end]
+	if start > 0 {
+		s = "…" + s
+	}
+	if end < len(text) {
+		s += "…"
+	}
+	return s
+}
+
+// A Fragment is a part of a text, that matches a query or not.
+type Fragment struct {
+	Text  string
+	Match bool
+}
+
+// Highlight splits the text in fragments, with the words matching any of the
+// terms in their own fragments with Match set.
+func Highlight(text string, terms []string) []Fragment {
+	set := termSet(terms)
+	var fs []Fragment
+	last := 0
+	for _, t := range tokens(text) {
+		if term, ok := termOf(t.word); !ok || !set[term] {
+			continue
+		}
+		if t.start > last {
+			fs = append(fs, Fragment{text[last:t.start], false})
+		}
+		fs = append(fs, Fragment{t.word, true})
+		last = t.end
+	}
+	if last < len(text) {
+		fs = append(fs, Fragment{text[last:], false})
+	}
+	return fs
+}
+
+func termSet(terms []string) map[string]bool {
+	set := make(map[string]bool, len(terms))
+	for _, t := range terms {
+		set[t] = true
+	}
+	return set
+}
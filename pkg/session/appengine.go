@@ -0,0 +1,91 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+//go:build appengine
+// +build appengine
+
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"appengine"
+	"appengine/datastore"
+)
+
+// Kind is the datastore kind of the sessions kept by Datastore, stored with
+// their id as key name.
+const Kind = "Session"
+
+// Datastore keeps the sessions in the App Engine datastore.
+type Datastore struct{}
+
+// storedSession is a session as stored in the datastore.
+type storedSession struct {
+	Values  []byte `datastore:",noindex"` // JSON encoded
+	Created time.Time
+	Seen    time.Time
+}
+
+func (Datastore) Get(r *http.Request, id string) (*Session, error) {
+	ctx := appengine.NewContext(r)
+	var ss storedSession
+	err := datastore.Get(ctx, datastore.NewKey(ctx, Kind, id, 0, nil), &ss)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{ID: id, Created: ss.Created, Seen: ss.Seen}
+	if err := json.Unmarshal(ss.Values, &s.Values); err != nil {
+		return nil, fmt.Errorf("decode session values: %v", err)
+	}
+	return s, nil
+}
+
+func (Datastore) Put(r *http.Request, s *Session) error {
+	ctx := appengine.NewContext(r)
+	b, err := json.Marshal(s.Values)
+	if err != nil {
+		return fmt.Errorf("encode session values: %v", err)
+	}
+	ss := &storedSession{Values: b, Created: s.Created, Seen: s.Seen}
+	_, err = datastore.Put(ctx, datastore.NewKey(ctx, Kind, s.ID, 0, nil), ss)
+	return err
+}
+
+func (Datastore) Delete(r *http.Request, id string) error {
+	ctx := appengine.NewContext(r)
+	return datastore.Delete(ctx, datastore.NewKey(ctx, Kind, id, 0, nil))
+}
+
+// deleteBatch is the number of sessions deleted at once.
+const deleteBatch = 500
+
+// DeleteExpired deletes the sessions not seen since the given time, and
+// returns how many were deleted.
+func DeleteExpired(ctx appengine.Context, since time.Time) (int, error) {
+	n := 0
+	for {
+		ks, err := datastore.NewQuery(Kind).
+			Filter("Seen <", since).
+			KeysOnly().
+			Limit(deleteBatch).
+			GetAll(ctx, nil)
+		if err != nil {
+			return n, fmt.Errorf("find expired sessions: %v", err)
+		}
+		if err := datastore.DeleteMulti(ctx, ks); err != nil {
+			return n, fmt.Errorf("delete expired sessions: %v", err)
+		}
+		n += len(ks)
+		if len(ks) < deleteBatch {
+			return n, nil
+		}
+	}
+}
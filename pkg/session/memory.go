@@ -0,0 +1,67 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package session
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A MemoryStore keeps the sessions in memory. Sessions not seen for MaxAge,
+// DefaultAbsoluteTimeout if zero, are deleted when others are saved.
+type MemoryStore struct {
+	MaxAge time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+func (m *MemoryStore) Get(r *http.Request, id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	s.Values = copyValues(s.Values)
+	return &s, nil
+}
+
+func (m *MemoryStore) Put(r *http.Request, s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sessions == nil {
+		m.sessions = make(map[string]Session)
+	}
+	maxAge := m.MaxAge
+	if maxAge == 0 {
+		maxAge = DefaultAbsoluteTimeout
+	}
+	for id, old := range m.sessions {
+		if time.Since(old.Seen) > maxAge {
+			delete(m.sessions, id)
+		}
+	}
+	c := *s
+	c.Values = copyValues(s.Values)
+	m.sessions[s.ID] = c
+	return nil
+}
+
+func (m *MemoryStore) Delete(r *http.Request, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+func copyValues(vs map[string]string) map[string]string {
+	c := make(map[string]string, len(vs))
+	for k, v := range vs {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,308 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+// The session package keeps per user state between the requests of a web
+// application in encrypted cookies.
+//
+// The sessions are kept entirely in the cookie, or only their id if the
+// Manager has a Store. Two implementations of Store are provided: one kept in
+// memory, useful for tests and standalone use, and on App Engine one backed
+// by the datastore.
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Default timeouts of the sessions.
+const (
+	DefaultIdleTimeout     = 30 * time.Minute
+	DefaultAbsoluteTimeout = 24 * time.Hour
+)
+
+// maxCookieSize is the size of the largest cookie accepted by all browsers.
+const maxCookieSize = 4000
+
+// A Session is the state kept for a user between requests.
+type Session struct {
+	ID      string
+	Values  map[string]string
+	Created time.Time
+	Seen    time.Time // time of the last request that refreshed the session
+
+	stale bool // whether the cookie was encrypted with an old key
+}
+
+// A Store keeps the sessions on the server, so they can be invalidated even
+// if their cookies were copied.
+type Store interface {
+	// Get returns the session with the given id, nil if there's none.
+	Get(r *http.Request, id string) (*Session, error)
+	// Put saves the session, replacing any with the same id.
+	Put(r *http.Request, s *Session) error
+	// Delete deletes the session with the given id.
+	Delete(r *http.Request, id string) error
+}
+
+// A Manager reads and writes the sessions of the requests.
+type Manager struct {
+	// Name is the name of the cookie, "session" if empty.
+	Name string
+	// Keys encrypt and authenticate the cookies with AES-GCM, so they can't
+	// be read or forged. Each key has 16, 24 or 32 bytes. The first one
+	// encrypts the cookies and all of them decrypt them, so keys are rotated
+	// by adding a new one first and removing the old one once the sessions
+	// encrypted with it have expired.
+	Keys [][]byte
+	// Store keeps the sessions, if not nil. Otherwise they're kept entirely
+	// in the cookie and can't be invalidated before they expire.
+	Store Store
+	// IdleTimeout is how long a session lasts without requests, and
+	// AbsoluteTimeout how long it lasts since it was created. The defaults
+	// are used if zero.
+	IdleTimeout     time.Duration
+	AbsoluteTimeout time.Duration
+	// Secure restricts the cookie to HTTPS. It can't be told from the
+	// requests, since front ends like App Engine's terminate TLS.
+	Secure bool
+}
+
+func (m *Manager) name() string {
+	if len(m.Name) == 0 {
+		return "session"
+	}
+	return m.Name
+}
+
+func (m *Manager) idleTimeout() time.Duration {
+	if m.IdleTimeout == 0 {
+		return DefaultIdleTimeout
+	}
+	return m.IdleTimeout
+}
+
+func (m *Manager) absoluteTimeout() time.Duration {
+	if m.AbsoluteTimeout == 0 {
+		return DefaultAbsoluteTimeout
+	}
+	return m.AbsoluteTimeout
+}
+
+// Expires returns when the session expires if there are no more requests.
+func (m *Manager) Expires(s *Session) time.Time {
+	idle := s.Seen.Add(m.idleTimeout())
+	if abs := s.Created.Add(m.absoluteTimeout()); abs.Before(idle) {
+		return abs
+	}
+	return idle
+}
+
+// New returns a new session with a random id. It isn't saved until Save is
+// called.
+func (m *Manager) New() (*Session, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("read random bytes: %v", err)
+	}
+	now := time.Now()
+	return &Session{
+		ID:      base64.RawURLEncoding.EncodeToString(b),
+		Values:  make(map[string]string),
+		Created: now,
+		Seen:    now,
+	}, nil
+}
+
+// Start starts a new session for a request without one, saving it and adding
+// its cookie to the request, so Get returns it for the rest of the request as
+// it will for the next ones.
+func (m *Manager) Start(w http.ResponseWriter, r *http.Request) (*Session, error) {
+	s, err := m.New()
+	if err != nil {
+		return nil, err
+	}
+	enc, err := m.save(w, r, s)
+	if err != nil {
+		return nil, err
+	}
+	var cs []string
+	for _, c := range r.Cookies() {
+		if c.Name != m.name() {
+			cs = append(cs, c.String())
+		}
+	}
+	cs = append(cs, (&http.Cookie{Name: m.name(), Value: enc}).String())
+	r.Header.Set("Cookie", strings.Join(cs, "; "))
+	return s, nil
+}
+
+// Get returns the session of the request, nil if it has none or it expired.
+func (m *Manager) Get(r *http.Request) (*Session, error) {
+	c, err := r.Cookie(m.name())
+	if err != nil {
+		return nil, nil
+	}
+	var s Session
+	stale, err := m.decrypt(c.Value, &s)
+	if err != nil {
+		return nil, nil
+	}
+	if m.Store != nil {
+		id := s.ID
+		st, err := m.Store.Get(r, id)
+		if err != nil {
+			return nil, fmt.Errorf("load session: %v", err)
+		}
+		if st == nil {
+			return nil, nil
+		}
+		s = *st
+	}
+	if time.Now().After(m.Expires(&s)) {
+		return nil, nil
+	}
+	s.stale = stale
+	return &s, nil
+}
+
+// Save saves the session and sets its cookie.
+func (m *Manager) Save(w http.ResponseWriter, r *http.Request, s *Session) error {
+	_, err := m.save(w, r, s)
+	return err
+}
+
+// save saves the session and sets its cookie, whose value it returns.
+func (m *Manager) save(w http.ResponseWriter, r *http.Request, s *Session) (string, error) {
+	v := s
+	if m.Store != nil {
+		if err := m.Store.Put(r, s); err != nil {
+			return "", fmt.Errorf("save session: %v", err)
+		}
+		v = &Session{ID: s.ID}
+	}
+	enc, err := m.encrypt(v)
+	if err != nil {
+		return "", err
+	}
+	if len(enc) > maxCookieSize {
+		return "", fmt.Errorf("session too large for a cookie: %v bytes", len(enc))
+	}
+	m.setCookie(w, enc, m.Expires(s))
+	s.stale = false
+	return enc, nil
+}
+
+// Touch extends the idle timeout of the session of the request, if it has
+// one. To avoid saving the session on every request, it's only saved when a
+// tenth of the idle timeout has passed since it was last extended, or when its
+// cookie was encrypted with an old key.
+func (m *Manager) Touch(w http.ResponseWriter, r *http.Request) error {
+	s, err := m.Get(r)
+	if err != nil || s == nil {
+		return err
+	}
+	if !s.stale && time.Since(s.Seen) < m.idleTimeout()/10 {
+		return nil
+	}
+	s.Seen = time.Now()
+	return m.Save(w, r, s)
+}
+
+// Destroy invalidates the session of the request, if it has one, and clears
+// its cookie.
+func (m *Manager) Destroy(w http.ResponseWriter, r *http.Request) error {
+	if m.Store != nil {
+		if c, err := r.Cookie(m.name()); err == nil {
+			var s Session
+			if _, err := m.decrypt(c.Value, &s); err == nil {
+				if err := m.Store.Delete(r, s.ID); err != nil {
+					return fmt.Errorf("delete session: %v", err)
+				}
+			}
+		}
+	}
+	m.setCookie(w, "", time.Unix(0, 0))
+	return nil
+}
+
+func (m *Manager) setCookie(w http.ResponseWriter, value string, exp time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.name(),
+		Value:    value,
+		Path:     "/",
+		Expires:  exp,
+		HttpOnly: true,
+		Secure:   m.Secure,
+	})
+}
+
+// gcm returns the AES-GCM cipher with the given key.
+func gcm(key []byte) (cipher.AEAD, error) {
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("bad session key: %v", err)
+	}
+	return cipher.NewGCM(b)
+}
+
+// encrypt encodes the session as JSON encrypted with the first key, using the
+// name of the cookie as additional data.
+func (m *Manager) encrypt(s *Session) (string, error) {
+	if len(m.Keys) == 0 {
+		return "", fmt.Errorf("no session keys")
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("encode session: %v", err)
+	}
+	aead, err := gcm(m.Keys[0])
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("read random bytes: %v", err)
+	}
+	out := aead.Seal(nonce, nonce, b, []byte(m.name()))
+	return base64.RawURLEncoding.EncodeToString(out), nil
+}
+
+var errBadCookie = errors.New("bad session cookie")
+
+// decrypt decrypts a session encrypted by encrypt with any of the keys, and
+// returns whether it wasn't the first one.
+func (m *Manager) decrypt(v string, s *Session) (stale bool, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return false, errBadCookie
+	}
+	for i, k := range m.Keys {
+		aead, err := gcm(k)
+		if err != nil {
+			return false, err
+		}
+		if len(b) < aead.NonceSize() {
+			return false, errBadCookie
+		}
+		nonce, ct := b[:aead.NonceSize()], b[aead.NonceSize():]
+		pt, err := aead.Open(nil, nonce, ct, []byte(m.name()))
+		if err != nil {
+			continue
+		}
+		if err := json.Unmarshal(pt, s); err != nil {
+			return false, errBadCookie
+		}
+		return i > 0, nil
+	}
+	return false, errBadCookie
+}
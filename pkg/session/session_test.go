@@ -0,0 +1,211 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD style
+// license that can be found in the LICENSE file.
+
+package session_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/campoy/goconf/pkg/session"
+)
+
+var (
+	oldKey = []byte("0123456789abcdef0123456789abcdef")
+	newKey = []byte("fedcba9876543210fedcba9876543210")
+)
+
+// save saves the session with m, and returns a request carrying the cookie
+// it set.
+func save(t *testing.T, m *session.Manager, s *session.Session) *http.Request {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if err := m.Save(w, httptest.NewRequest("GET", "/", nil), s); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	return next(w)
+}
+
+// next returns a request carrying the cookies set in the response, the last
+// one of each name as a browser would.
+func next(w *httptest.ResponseRecorder) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	cs := make(map[string]*http.Cookie)
+	for _, c := range w.Result().Cookies() {
+		cs[c.Name] = c
+	}
+	for _, c := range cs {
+		if c.MaxAge >= 0 && (c.Expires.IsZero() || c.Expires.After(time.Now())) {
+			r.AddCookie(c)
+		}
+	}
+	return r
+}
+
+func newSession(t *testing.T, m *session.Manager) *session.Session {
+	t.Helper()
+	s, err := m.New()
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	s.Values["user"] = "gopher"
+	return s
+}
+
+func TestCookie(t *testing.T) {
+	m := &session.Manager{Keys: [][]byte{oldKey}}
+	s := newSession(t, m)
+	r := save(t, m, s)
+
+	got, err := m.Get(r)
+	if err != nil || got == nil {
+		t.Fatalf("get: got %v, %v", got, err)
+	}
+	if got.ID != s.ID || got.Values["user"] != "gopher" {
+		t.Errorf("got session %+v, want %+v", got, s)
+	}
+
+	// Other keys can't decrypt it.
+	other := &session.Manager{Keys: [][]byte{newKey}}
+	if got, err := other.Get(r); err != nil || got != nil {
+		t.Errorf("get with another key: got %+v, %v, want no session", got, err)
+	}
+}
+
+func TestTamperedCookie(t *testing.T) {
+	m := &session.Manager{Keys: [][]byte{oldKey}}
+	r := save(t, m, newSession(t, m))
+	c, err := r.Cookie("session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := []byte(c.Value)
+	if i := len(b) / 2; b[i] == 'A' {
+		b[i] = 'B'
+	} else {
+		b[i] = 'A'
+	}
+	tampered := httptest.NewRequest("GET", "/", nil)
+	tampered.AddCookie(&http.Cookie{Name: "session", Value: string(b)})
+	if got, err := m.Get(tampered); err != nil || got != nil {
+		t.Errorf("tampered cookie: got %+v, %v, want no session", got, err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := &session.Manager{Keys: [][]byte{oldKey}}
+	s := newSession(t, old)
+	r := save(t, old, s)
+
+	// The new key is added first, the old one still decrypts the cookies.
+	rotated := &session.Manager{Keys: [][]byte{newKey, oldKey}}
+	got, err := rotated.Get(r)
+	if err != nil || got == nil || got.ID != s.ID {
+		t.Fatalf("get after adding a key: got %+v, %v, want %v", got, err, s.ID)
+	}
+
+	// Touching a session encrypted with an old key encrypts it again with
+	// the new one, even if it was just extended.
+	w := httptest.NewRecorder()
+	if err := rotated.Touch(w, r); err != nil {
+		t.Fatalf("touch: %v", err)
+	}
+	r = next(w)
+	if _, err := r.Cookie("session"); err != nil {
+		t.Fatalf("touch didn't encrypt the session again")
+	}
+
+	// Once the old key is removed, the sessions encrypted again still work.
+	onlyNew := &session.Manager{Keys: [][]byte{newKey}}
+	if got, err := onlyNew.Get(r); err != nil || got == nil || got.ID != s.ID {
+		t.Errorf("get after removing the old key: got %+v, %v, want %v", got, err, s.ID)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	m := &session.Manager{Keys: [][]byte{oldKey}, IdleTimeout: time.Hour}
+	s := newSession(t, m)
+	s.Seen = time.Now().Add(-2 * time.Hour)
+	if got, err := m.Get(save(t, m, s)); err != nil || got != nil {
+		t.Errorf("idle session: got %+v, %v, want no session", got, err)
+	}
+
+	// Touching a session extends it.
+	s.Seen = time.Now().Add(-50 * time.Minute)
+	r := save(t, m, s)
+	w := httptest.NewRecorder()
+	if err := m.Touch(w, r); err != nil {
+		t.Fatalf("touch: %v", err)
+	}
+	got, err := m.Get(next(w))
+	if err != nil || got == nil {
+		t.Fatalf("touched session: got %v, %v", got, err)
+	}
+	if time.Since(got.Seen) > time.Minute {
+		t.Errorf("touched session last seen %v ago", time.Since(got.Seen))
+	}
+}
+
+func TestAbsoluteTimeout(t *testing.T) {
+	m := &session.Manager{Keys: [][]byte{oldKey}, AbsoluteTimeout: time.Hour}
+	s := newSession(t, m)
+	s.Created = time.Now().Add(-2 * time.Hour)
+	s.Seen = time.Now()
+	if got, err := m.Get(save(t, m, s)); err != nil || got != nil {
+		t.Errorf("session past the absolute timeout: got %+v, %v, want no session", got, err)
+	}
+	if exp := m.Expires(s); exp.After(time.Now()) {
+		t.Errorf("expires at %v, want in the past", exp)
+	}
+}
+
+func TestStore(t *testing.T) {
+	m := &session.Manager{Keys: [][]byte{oldKey}, Store: &session.MemoryStore{}}
+	r := save(t, m, newSession(t, m))
+	got, err := m.Get(r)
+	if err != nil || got == nil || got.Values["user"] != "gopher" {
+		t.Fatalf("get: got %+v, %v", got, err)
+	}
+
+	// Destroying the session invalidates its cookie even if it was copied.
+	w := httptest.NewRecorder()
+	if err := m.Destroy(w, r); err != nil {
+		t.Fatalf("destroy: %v", err)
+	}
+	if _, err := next(w).Cookie("session"); err == nil {
+		t.Errorf("destroy didn't clear the cookie")
+	}
+	if got, err := m.Get(r); err != nil || got != nil {
+		t.Errorf("destroyed session: got %+v, %v, want no session", got, err)
+	}
+}
+
+func TestStart(t *testing.T) {
+	m := &session.Manager{Keys: [][]byte{oldKey}, Store: &session.MemoryStore{}, Secure: true}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "other", Value: "kept"})
+	r.AddCookie(&http.Cookie{Name: "session", Value: "invalid"})
+	w := httptest.NewRecorder()
+	s, err := m.Start(w, r)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	// The session is found in the same request, and in the next one.
+	for _, r := range []*http.Request{r, next(w)} {
+		if got, err := m.Get(r); err != nil || got == nil || got.ID != s.ID {
+			t.Errorf("get: got %+v, %v, want %v", got, err, s.ID)
+		}
+	}
+	if c, err := r.Cookie("other"); err != nil || c.Value != "kept" {
+		t.Errorf("other cookie: got %v, %v", c, err)
+	}
+	for _, c := range w.Result().Cookies() {
+		if !c.Secure || !c.HttpOnly {
+			t.Errorf("cookie %v isn't secure and HTTP only", c.Name)
+		}
+	}
+}
@@ -4,14 +4,21 @@
 
 // The tmpl package allows the user to use the include function in its templates,
 // which executes a template given its name and some data.
-// It also provides a date formatting function named date.
+// It also provides the date formatting functions date, dateIn and timeIn, and
+// a highlight function that marks the words of a search snippet matching the
+// query terms, and a csrfField function that emits the hidden field carrying
+// a CSRF token in forms.
 package tmpl
 
 import (
 	"bytes"
 	"html/template"
 	"io"
+	"sync"
 	"time"
+
+	"github.com/campoy/goconf/pkg/csrf"
+	"github.com/campoy/goconf/pkg/search"
 )
 
 var tmpl *template.Template
@@ -21,8 +28,12 @@ func init() {
 	// execTemplate.
 	tmpl = template.New("base").
 		Funcs(template.FuncMap{
-		"include": execTemplate,
-		"date":    dateFmt,
+		"include":   execTemplate,
+		"date":      dateFmt,
+		"dateIn":    dateIn,
+		"timeIn":    timeIn,
+		"highlight": highlight,
+		"csrfField": csrf.Field,
 	})
 }
 
@@ -41,6 +52,59 @@ func dateFmt(d time.Time) string {
 	return d.Format("2006 Jan 2")
 }
 
+// dateIn formats the date as seen in the given time zone, such as the one of
+// a conference venue. The date is shown in UTC if the zone is not valid.
+func dateIn(d time.Time, zone string) string {
+	return dateFmt(d.In(location(zone)))
+}
+
+// timeIn formats the date and time as seen in the given time zone, such as
+// the one of the viewer, followed by the abbreviation of the zone.
+func timeIn(d time.Time, zone string) string {
+	return d.In(location(zone)).Format("2006 Jan 2 15:04 MST")
+}
+
+// locations caches the time zones loaded by location, which reads them from
+// the zone database.
+var locations = struct {
+	sync.RWMutex
+	m map[string]*time.Location
+}{m: make(map[string]*time.Location)}
+
+// location returns the time zone with the given name, UTC if not valid.
+func location(zone string) *time.Location {
+	locations.RLock()
+	loc, ok := locations.m[zone]
+	locations.RUnlock()
+	if ok {
+		return loc
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		loc = time.UTC
+	}
+	locations.Lock()
+	locations.m[zone] = loc
+	locations.Unlock()
+	return loc
+}
+
+// highlight returns the HTML of the text with the words matching any of the
+// search terms enclosed in <b> tags.
+func highlight(text string, terms []string) template.HTML {
+	b := new(bytes.Buffer)
+	for _, f := range search.Highlight(text, terms) {
+		if f.Match {
+			b.WriteString("<b>")
+		}
+		template.HTMLEscape(b, []byte(f.Text))
+		if f.Match {
+			b.WriteString("</b>")
+		}
+	}
+	return template.HTML(b.String())
+}
+
 // ParseTemplates parses all the templates matching the given file pattern.
 // An error is returned if the parsing fails.
 func ParseTemplates(pattern string) error {
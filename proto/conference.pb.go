@@ -0,0 +1,911 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: proto/conference.proto
+
+package confpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Conference struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Id               string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name             string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Description      string                 `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+	City             string                 `protobuf:"bytes,4,opt,name=city,proto3" json:"city,omitempty"`
+	Topics           []string               `protobuf:"bytes,5,rep,name=topics,proto3" json:"topics,omitempty"`
+	MaxAttendees     int32                  `protobuf:"varint,6,opt,name=max_attendees,json=maxAttendees,proto3" json:"max_attendees,omitempty"`
+	TicketsAvailable int32                  `protobuf:"varint,7,opt,name=tickets_available,json=ticketsAvailable,proto3" json:"tickets_available,omitempty"`
+	StartDate        *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=start_date,json=startDate,proto3" json:"start_date,omitempty"`
+	EndDate          *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=end_date,json=endDate,proto3" json:"end_date,omitempty"`
+	Organizer        string                 `protobuf:"bytes,10,opt,name=organizer,proto3" json:"organizer,omitempty"`
+	Approved         bool                   `protobuf:"varint,11,opt,name=approved,proto3" json:"approved,omitempty"`
+	VenueId          string                 `protobuf:"bytes,12,opt,name=venue_id,json=venueId,proto3" json:"venue_id,omitempty"`
+	TimeZone         string                 `protobuf:"bytes,13,opt,name=time_zone,json=timeZone,proto3" json:"time_zone,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *Conference) Reset() {
+	*x = Conference{}
+	mi := &file_proto_conference_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Conference) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Conference) ProtoMessage() {}
+
+func (x *Conference) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_conference_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Conference.ProtoReflect.Descriptor instead.
+func (*Conference) Descriptor() ([]byte, []int) {
+	return file_proto_conference_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Conference) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Conference) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Conference) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Conference) GetCity() string {
+	if x != nil {
+		return x.City
+	}
+	return ""
+}
+
+func (x *Conference) GetTopics() []string {
+	if x != nil {
+		return x.Topics
+	}
+	return nil
+}
+
+func (x *Conference) GetMaxAttendees() int32 {
+	if x != nil {
+		return x.MaxAttendees
+	}
+	return 0
+}
+
+func (x *Conference) GetTicketsAvailable() int32 {
+	if x != nil {
+		return x.TicketsAvailable
+	}
+	return 0
+}
+
+func (x *Conference) GetStartDate() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartDate
+	}
+	return nil
+}
+
+func (x *Conference) GetEndDate() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EndDate
+	}
+	return nil
+}
+
+func (x *Conference) GetOrganizer() string {
+	if x != nil {
+		return x.Organizer
+	}
+	return ""
+}
+
+func (x *Conference) GetApproved() bool {
+	if x != nil {
+		return x.Approved
+	}
+	return false
+}
+
+func (x *Conference) GetVenueId() string {
+	if x != nil {
+		return x.VenueId
+	}
+	return ""
+}
+
+func (x *Conference) GetTimeZone() string {
+	if x != nil {
+		return x.TimeZone
+	}
+	return ""
+}
+
+type Ticket struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Id             string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	ConferenceId   string                 `protobuf:"bytes,2,opt,name=conference_id,json=conferenceId,proto3" json:"conference_id,omitempty"`
+	ConferenceName string                 `protobuf:"bytes,3,opt,name=conference_name,json=conferenceName,proto3" json:"conference_name,omitempty"`
+	Number         int32                  `protobuf:"varint,4,opt,name=number,proto3" json:"number,omitempty"`
+	State          string                 `protobuf:"bytes,5,opt,name=state,proto3" json:"state,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Ticket) Reset() {
+	*x = Ticket{}
+	mi := &file_proto_conference_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Ticket) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Ticket) ProtoMessage() {}
+
+func (x *Ticket) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_conference_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Ticket.ProtoReflect.Descriptor instead.
+func (*Ticket) Descriptor() ([]byte, []int) {
+	return file_proto_conference_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Ticket) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Ticket) GetConferenceId() string {
+	if x != nil {
+		return x.ConferenceId
+	}
+	return ""
+}
+
+func (x *Ticket) GetConferenceName() string {
+	if x != nil {
+		return x.ConferenceName
+	}
+	return ""
+}
+
+func (x *Ticket) GetNumber() int32 {
+	if x != nil {
+		return x.Number
+	}
+	return 0
+}
+
+func (x *Ticket) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+type UserProfile struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Name              string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Topics            []string               `protobuf:"bytes,2,rep,name=topics,proto3" json:"topics,omitempty"`
+	MainEmail         string                 `protobuf:"bytes,3,opt,name=main_email,json=mainEmail,proto3" json:"main_email,omitempty"`
+	NotificationEmail string                 `protobuf:"bytes,4,opt,name=notification_email,json=notificationEmail,proto3" json:"notification_email,omitempty"`
+	TimeZone          string                 `protobuf:"bytes,5,opt,name=time_zone,json=timeZone,proto3" json:"time_zone,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *UserProfile) Reset() {
+	*x = UserProfile{}
+	mi := &file_proto_conference_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserProfile) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserProfile) ProtoMessage() {}
+
+func (x *UserProfile) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_conference_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserProfile.ProtoReflect.Descriptor instead.
+func (*UserProfile) Descriptor() ([]byte, []int) {
+	return file_proto_conference_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *UserProfile) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *UserProfile) GetTopics() []string {
+	if x != nil {
+		return x.Topics
+	}
+	return nil
+}
+
+func (x *UserProfile) GetMainEmail() string {
+	if x != nil {
+		return x.MainEmail
+	}
+	return ""
+}
+
+func (x *UserProfile) GetNotificationEmail() string {
+	if x != nil {
+		return x.NotificationEmail
+	}
+	return ""
+}
+
+func (x *UserProfile) GetTimeZone() string {
+	if x != nil {
+		return x.TimeZone
+	}
+	return ""
+}
+
+type ListConferencesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Topic         string                 `protobuf:"bytes,1,opt,name=topic,proto3" json:"topic,omitempty"`
+	City          string                 `protobuf:"bytes,2,opt,name=city,proto3" json:"city,omitempty"`
+	Cursor        string                 `protobuf:"bytes,3,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	Limit         int32                  `protobuf:"varint,4,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListConferencesRequest) Reset() {
+	*x = ListConferencesRequest{}
+	mi := &file_proto_conference_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListConferencesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListConferencesRequest) ProtoMessage() {}
+
+func (x *ListConferencesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_conference_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListConferencesRequest.ProtoReflect.Descriptor instead.
+func (*ListConferencesRequest) Descriptor() ([]byte, []int) {
+	return file_proto_conference_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ListConferencesRequest) GetTopic() string {
+	if x != nil {
+		return x.Topic
+	}
+	return ""
+}
+
+func (x *ListConferencesRequest) GetCity() string {
+	if x != nil {
+		return x.City
+	}
+	return ""
+}
+
+func (x *ListConferencesRequest) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+func (x *ListConferencesRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type ListConferencesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Conferences   []*Conference          `protobuf:"bytes,1,rep,name=conferences,proto3" json:"conferences,omitempty"`
+	NextCursor    string                 `protobuf:"bytes,2,opt,name=next_cursor,json=nextCursor,proto3" json:"next_cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListConferencesResponse) Reset() {
+	*x = ListConferencesResponse{}
+	mi := &file_proto_conference_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListConferencesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListConferencesResponse) ProtoMessage() {}
+
+func (x *ListConferencesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_conference_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListConferencesResponse.ProtoReflect.Descriptor instead.
+func (*ListConferencesResponse) Descriptor() ([]byte, []int) {
+	return file_proto_conference_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListConferencesResponse) GetConferences() []*Conference {
+	if x != nil {
+		return x.Conferences
+	}
+	return nil
+}
+
+func (x *ListConferencesResponse) GetNextCursor() string {
+	if x != nil {
+		return x.NextCursor
+	}
+	return ""
+}
+
+type GetConferenceRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetConferenceRequest) Reset() {
+	*x = GetConferenceRequest{}
+	mi := &file_proto_conference_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetConferenceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetConferenceRequest) ProtoMessage() {}
+
+func (x *GetConferenceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_conference_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetConferenceRequest.ProtoReflect.Descriptor instead.
+func (*GetConferenceRequest) Descriptor() ([]byte, []int) {
+	return file_proto_conference_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetConferenceRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type ScheduleConferenceRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Conference    *Conference            `protobuf:"bytes,1,opt,name=conference,proto3" json:"conference,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ScheduleConferenceRequest) Reset() {
+	*x = ScheduleConferenceRequest{}
+	mi := &file_proto_conference_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ScheduleConferenceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScheduleConferenceRequest) ProtoMessage() {}
+
+func (x *ScheduleConferenceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_conference_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScheduleConferenceRequest.ProtoReflect.Descriptor instead.
+func (*ScheduleConferenceRequest) Descriptor() ([]byte, []int) {
+	return file_proto_conference_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ScheduleConferenceRequest) GetConference() *Conference {
+	if x != nil {
+		return x.Conference
+	}
+	return nil
+}
+
+type ListAvailableTicketsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ConferenceId  string                 `protobuf:"bytes,1,opt,name=conference_id,json=conferenceId,proto3" json:"conference_id,omitempty"`
+	Cursor        string                 `protobuf:"bytes,2,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	Limit         int32                  `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListAvailableTicketsRequest) Reset() {
+	*x = ListAvailableTicketsRequest{}
+	mi := &file_proto_conference_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListAvailableTicketsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListAvailableTicketsRequest) ProtoMessage() {}
+
+func (x *ListAvailableTicketsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_conference_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListAvailableTicketsRequest.ProtoReflect.Descriptor instead.
+func (*ListAvailableTicketsRequest) Descriptor() ([]byte, []int) {
+	return file_proto_conference_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListAvailableTicketsRequest) GetConferenceId() string {
+	if x != nil {
+		return x.ConferenceId
+	}
+	return ""
+}
+
+func (x *ListAvailableTicketsRequest) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+func (x *ListAvailableTicketsRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type ListAvailableTicketsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Tickets       []*Ticket              `protobuf:"bytes,1,rep,name=tickets,proto3" json:"tickets,omitempty"`
+	NextCursor    string                 `protobuf:"bytes,2,opt,name=next_cursor,json=nextCursor,proto3" json:"next_cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListAvailableTicketsResponse) Reset() {
+	*x = ListAvailableTicketsResponse{}
+	mi := &file_proto_conference_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListAvailableTicketsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListAvailableTicketsResponse) ProtoMessage() {}
+
+func (x *ListAvailableTicketsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_conference_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListAvailableTicketsResponse.ProtoReflect.Descriptor instead.
+func (*ListAvailableTicketsResponse) Descriptor() ([]byte, []int) {
+	return file_proto_conference_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ListAvailableTicketsResponse) GetTickets() []*Ticket {
+	if x != nil {
+		return x.Tickets
+	}
+	return nil
+}
+
+func (x *ListAvailableTicketsResponse) GetNextCursor() string {
+	if x != nil {
+		return x.NextCursor
+	}
+	return ""
+}
+
+type BuyTicketRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TicketId      string                 `protobuf:"bytes,1,opt,name=ticket_id,json=ticketId,proto3" json:"ticket_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BuyTicketRequest) Reset() {
+	*x = BuyTicketRequest{}
+	mi := &file_proto_conference_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BuyTicketRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BuyTicketRequest) ProtoMessage() {}
+
+func (x *BuyTicketRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_conference_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BuyTicketRequest.ProtoReflect.Descriptor instead.
+func (*BuyTicketRequest) Descriptor() ([]byte, []int) {
+	return file_proto_conference_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *BuyTicketRequest) GetTicketId() string {
+	if x != nil {
+		return x.TicketId
+	}
+	return ""
+}
+
+type GetUserProfileRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetUserProfileRequest) Reset() {
+	*x = GetUserProfileRequest{}
+	mi := &file_proto_conference_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetUserProfileRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetUserProfileRequest) ProtoMessage() {}
+
+func (x *GetUserProfileRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_conference_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetUserProfileRequest.ProtoReflect.Descriptor instead.
+func (*GetUserProfileRequest) Descriptor() ([]byte, []int) {
+	return file_proto_conference_proto_rawDescGZIP(), []int{10}
+}
+
+type UpdateUserProfileRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Profile       *UserProfile           `protobuf:"bytes,1,opt,name=profile,proto3" json:"profile,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateUserProfileRequest) Reset() {
+	*x = UpdateUserProfileRequest{}
+	mi := &file_proto_conference_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateUserProfileRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateUserProfileRequest) ProtoMessage() {}
+
+func (x *UpdateUserProfileRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_conference_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateUserProfileRequest.ProtoReflect.Descriptor instead.
+func (*UpdateUserProfileRequest) Descriptor() ([]byte, []int) {
+	return file_proto_conference_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *UpdateUserProfileRequest) GetProfile() *UserProfile {
+	if x != nil {
+		return x.Profile
+	}
+	return nil
+}
+
+var File_proto_conference_proto protoreflect.FileDescriptor
+
+const file_proto_conference_proto_rawDesc = "" +
+	"\n" +
+	"\x16proto/conference.proto\x12\tgoconf.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xb4\x03\n" +
+	"\n" +
+	"Conference\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12 \n" +
+	"\vdescription\x18\x03 \x01(\tR\vdescription\x12\x12\n" +
+	"\x04city\x18\x04 \x01(\tR\x04city\x12\x16\n" +
+	"\x06topics\x18\x05 \x03(\tR\x06topics\x12#\n" +
+	"\rmax_attendees\x18\x06 \x01(\x05R\fmaxAttendees\x12+\n" +
+	"\x11tickets_available\x18\a \x01(\x05R\x10ticketsAvailable\x129\n" +
+	"\n" +
+	"start_date\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\tstartDate\x125\n" +
+	"\bend_date\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\aendDate\x12\x1c\n" +
+	"\torganizer\x18\n" +
+	" \x01(\tR\torganizer\x12\x1a\n" +
+	"\bapproved\x18\v \x01(\bR\bapproved\x12\x19\n" +
+	"\bvenue_id\x18\f \x01(\tR\avenueId\x12\x1b\n" +
+	"\ttime_zone\x18\r \x01(\tR\btimeZone\"\x94\x01\n" +
+	"\x06Ticket\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12#\n" +
+	"\rconference_id\x18\x02 \x01(\tR\fconferenceId\x12'\n" +
+	"\x0fconference_name\x18\x03 \x01(\tR\x0econferenceName\x12\x16\n" +
+	"\x06number\x18\x04 \x01(\x05R\x06number\x12\x14\n" +
+	"\x05state\x18\x05 \x01(\tR\x05state\"\xa4\x01\n" +
+	"\vUserProfile\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x16\n" +
+	"\x06topics\x18\x02 \x03(\tR\x06topics\x12\x1d\n" +
+	"\n" +
+	"main_email\x18\x03 \x01(\tR\tmainEmail\x12-\n" +
+	"\x12notification_email\x18\x04 \x01(\tR\x11notificationEmail\x12\x1b\n" +
+	"\ttime_zone\x18\x05 \x01(\tR\btimeZone\"p\n" +
+	"\x16ListConferencesRequest\x12\x14\n" +
+	"\x05topic\x18\x01 \x01(\tR\x05topic\x12\x12\n" +
+	"\x04city\x18\x02 \x01(\tR\x04city\x12\x16\n" +
+	"\x06cursor\x18\x03 \x01(\tR\x06cursor\x12\x14\n" +
+	"\x05limit\x18\x04 \x01(\x05R\x05limit\"s\n" +
+	"\x17ListConferencesResponse\x127\n" +
+	"\vconferences\x18\x01 \x03(\v2\x15.goconf.v1.ConferenceR\vconferences\x12\x1f\n" +
+	"\vnext_cursor\x18\x02 \x01(\tR\n" +
+	"nextCursor\"&\n" +
+	"\x14GetConferenceRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"R\n" +
+	"\x19ScheduleConferenceRequest\x125\n" +
+	"\n" +
+	"conference\x18\x01 \x01(\v2\x15.goconf.v1.ConferenceR\n" +
+	"conference\"p\n" +
+	"\x1bListAvailableTicketsRequest\x12#\n" +
+	"\rconference_id\x18\x01 \x01(\tR\fconferenceId\x12\x16\n" +
+	"\x06cursor\x18\x02 \x01(\tR\x06cursor\x12\x14\n" +
+	"\x05limit\x18\x03 \x01(\x05R\x05limit\"l\n" +
+	"\x1cListAvailableTicketsResponse\x12+\n" +
+	"\atickets\x18\x01 \x03(\v2\x11.goconf.v1.TicketR\atickets\x12\x1f\n" +
+	"\vnext_cursor\x18\x02 \x01(\tR\n" +
+	"nextCursor\"/\n" +
+	"\x10BuyTicketRequest\x12\x1b\n" +
+	"\tticket_id\x18\x01 \x01(\tR\bticketId\"\x17\n" +
+	"\x15GetUserProfileRequest\"L\n" +
+	"\x18UpdateUserProfileRequest\x120\n" +
+	"\aprofile\x18\x01 \x01(\v2\x16.goconf.v1.UserProfileR\aprofile2\xcd\x04\n" +
+	"\x11ConferenceService\x12X\n" +
+	"\x0fListConferences\x12!.goconf.v1.ListConferencesRequest\x1a\".goconf.v1.ListConferencesResponse\x12G\n" +
+	"\rGetConference\x12\x1f.goconf.v1.GetConferenceRequest\x1a\x15.goconf.v1.Conference\x12Q\n" +
+	"\x12ScheduleConference\x12$.goconf.v1.ScheduleConferenceRequest\x1a\x15.goconf.v1.Conference\x12g\n" +
+	"\x14ListAvailableTickets\x12&.goconf.v1.ListAvailableTicketsRequest\x1a'.goconf.v1.ListAvailableTicketsResponse\x12;\n" +
+	"\tBuyTicket\x12\x1b.goconf.v1.BuyTicketRequest\x1a\x11.goconf.v1.Ticket\x12J\n" +
+	"\x0eGetUserProfile\x12 .goconf.v1.GetUserProfileRequest\x1a\x16.goconf.v1.UserProfile\x12P\n" +
+	"\x11UpdateUserProfile\x12#.goconf.v1.UpdateUserProfileRequest\x1a\x16.goconf.v1.UserProfileB'Z%github.com/campoy/goconf/proto;confpbb\x06proto3"
+
+var (
+	file_proto_conference_proto_rawDescOnce sync.Once
+	file_proto_conference_proto_rawDescData []byte
+)
+
+func file_proto_conference_proto_rawDescGZIP() []byte {
+	file_proto_conference_proto_rawDescOnce.Do(func() {
+		file_proto_conference_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_conference_proto_rawDesc), len(file_proto_conference_proto_rawDesc)))
+	})
+	return file_proto_conference_proto_rawDescData
+}
+
+var file_proto_conference_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_proto_conference_proto_goTypes = []any{
+	(*Conference)(nil),                   // 0: goconf.v1.Conference
+	(*Ticket)(nil),                       // 1: goconf.v1.Ticket
+	(*UserProfile)(nil),                  // 2: goconf.v1.UserProfile
+	(*ListConferencesRequest)(nil),       // 3: goconf.v1.ListConferencesRequest
+	(*ListConferencesResponse)(nil),      // 4: goconf.v1.ListConferencesResponse
+	(*GetConferenceRequest)(nil),         // 5: goconf.v1.GetConferenceRequest
+	(*ScheduleConferenceRequest)(nil),    // 6: goconf.v1.ScheduleConferenceRequest
+	(*ListAvailableTicketsRequest)(nil),  // 7: goconf.v1.ListAvailableTicketsRequest
+	(*ListAvailableTicketsResponse)(nil), // 8: goconf.v1.ListAvailableTicketsResponse
+	(*BuyTicketRequest)(nil),             // 9: goconf.v1.BuyTicketRequest
+	(*GetUserProfileRequest)(nil),        // 10: goconf.v1.GetUserProfileRequest
+	(*UpdateUserProfileRequest)(nil),     // 11: goconf.v1.UpdateUserProfileRequest
+	(*timestamppb.Timestamp)(nil),        // 12: google.protobuf.Timestamp
+}
+var file_proto_conference_proto_depIdxs = []int32{
+	12, // 0: goconf.v1.Conference.start_date:type_name -> google.protobuf.Timestamp
+	12, // 1: goconf.v1.Conference.end_date:type_name -> google.protobuf.Timestamp
+	0,  // 2: goconf.v1.ListConferencesResponse.conferences:type_name -> goconf.v1.Conference
+	0,  // 3: goconf.v1.ScheduleConferenceRequest.conference:type_name -> goconf.v1.Conference
+	1,  // 4: goconf.v1.ListAvailableTicketsResponse.tickets:type_name -> goconf.v1.Ticket
+	2,  // 5: goconf.v1.UpdateUserProfileRequest.profile:type_name -> goconf.v1.UserProfile
+	3,  // 6: goconf.v1.ConferenceService.ListConferences:input_type -> goconf.v1.ListConferencesRequest
+	5,  // 7: goconf.v1.ConferenceService.GetConference:input_type -> goconf.v1.GetConferenceRequest
+	6,  // 8: goconf.v1.ConferenceService.ScheduleConference:input_type -> goconf.v1.ScheduleConferenceRequest
+	7,  // 9: goconf.v1.ConferenceService.ListAvailableTickets:input_type -> goconf.v1.ListAvailableTicketsRequest
+	9,  // 10: goconf.v1.ConferenceService.BuyTicket:input_type -> goconf.v1.BuyTicketRequest
+	10, // 11: goconf.v1.ConferenceService.GetUserProfile:input_type -> goconf.v1.GetUserProfileRequest
+	11, // 12: goconf.v1.ConferenceService.UpdateUserProfile:input_type -> goconf.v1.UpdateUserProfileRequest
+	4,  // 13: goconf.v1.ConferenceService.ListConferences:output_type -> goconf.v1.ListConferencesResponse
+	0,  // 14: goconf.v1.ConferenceService.GetConference:output_type -> goconf.v1.Conference
+	0,  // 15: goconf.v1.ConferenceService.ScheduleConference:output_type -> goconf.v1.Conference
+	8,  // 16: goconf.v1.ConferenceService.ListAvailableTickets:output_type -> goconf.v1.ListAvailableTicketsResponse
+	1,  // 17: goconf.v1.ConferenceService.BuyTicket:output_type -> goconf.v1.Ticket
+	2,  // 18: goconf.v1.ConferenceService.GetUserProfile:output_type -> goconf.v1.UserProfile
+	2,  // 19: goconf.v1.ConferenceService.UpdateUserProfile:output_type -> goconf.v1.UserProfile
+	13, // [13:20] is the sub-list for method output_type
+	6,  // [6:13] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_proto_conference_proto_init() }
+func file_proto_conference_proto_init() {
+	if File_proto_conference_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_conference_proto_rawDesc), len(file_proto_conference_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_conference_proto_goTypes,
+		DependencyIndexes: file_proto_conference_proto_depIdxs,
+		MessageInfos:      file_proto_conference_proto_msgTypes,
+	}.Build()
+	File_proto_conference_proto = out.File
+	file_proto_conference_proto_goTypes = nil
+	file_proto_conference_proto_depIdxs = nil
+}
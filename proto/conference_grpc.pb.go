@@ -0,0 +1,349 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: proto/conference.proto
+
+package confpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ConferenceService_ListConferences_FullMethodName      = "/goconf.v1.ConferenceService/ListConferences"
+	ConferenceService_GetConference_FullMethodName        = "/goconf.v1.ConferenceService/GetConference"
+	ConferenceService_ScheduleConference_FullMethodName   = "/goconf.v1.ConferenceService/ScheduleConference"
+	ConferenceService_ListAvailableTickets_FullMethodName = "/goconf.v1.ConferenceService/ListAvailableTickets"
+	ConferenceService_BuyTicket_FullMethodName            = "/goconf.v1.ConferenceService/BuyTicket"
+	ConferenceService_GetUserProfile_FullMethodName       = "/goconf.v1.ConferenceService/GetUserProfile"
+	ConferenceService_UpdateUserProfile_FullMethodName    = "/goconf.v1.ConferenceService/UpdateUserProfile"
+)
+
+// ConferenceServiceClient is the client API for ConferenceService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ConferenceServiceClient interface {
+	ListConferences(ctx context.Context, in *ListConferencesRequest, opts ...grpc.CallOption) (*ListConferencesResponse, error)
+	GetConference(ctx context.Context, in *GetConferenceRequest, opts ...grpc.CallOption) (*Conference, error)
+	ScheduleConference(ctx context.Context, in *ScheduleConferenceRequest, opts ...grpc.CallOption) (*Conference, error)
+	ListAvailableTickets(ctx context.Context, in *ListAvailableTicketsRequest, opts ...grpc.CallOption) (*ListAvailableTicketsResponse, error)
+	BuyTicket(ctx context.Context, in *BuyTicketRequest, opts ...grpc.CallOption) (*Ticket, error)
+	GetUserProfile(ctx context.Context, in *GetUserProfileRequest, opts ...grpc.CallOption) (*UserProfile, error)
+	UpdateUserProfile(ctx context.Context, in *UpdateUserProfileRequest, opts ...grpc.CallOption) (*UserProfile, error)
+}
+
+type conferenceServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewConferenceServiceClient(cc grpc.ClientConnInterface) ConferenceServiceClient {
+	return &conferenceServiceClient{cc}
+}
+
+func (c *conferenceServiceClient) ListConferences(ctx context.Context, in *ListConferencesRequest, opts ...grpc.CallOption) (*ListConferencesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListConferencesResponse)
+	err := c.cc.Invoke(ctx, ConferenceService_ListConferences_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *conferenceServiceClient) GetConference(ctx context.Context, in *GetConferenceRequest, opts ...grpc.CallOption) (*Conference, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Conference)
+	err := c.cc.Invoke(ctx, ConferenceService_GetConference_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *conferenceServiceClient) ScheduleConference(ctx context.Context, in *ScheduleConferenceRequest, opts ...grpc.CallOption) (*Conference, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Conference)
+	err := c.cc.Invoke(ctx, ConferenceService_ScheduleConference_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *conferenceServiceClient) ListAvailableTickets(ctx context.Context, in *ListAvailableTicketsRequest, opts ...grpc.CallOption) (*ListAvailableTicketsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListAvailableTicketsResponse)
+	err := c.cc.Invoke(ctx, ConferenceService_ListAvailableTickets_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *conferenceServiceClient) BuyTicket(ctx context.Context, in *BuyTicketRequest, opts ...grpc.CallOption) (*Ticket, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Ticket)
+	err := c.cc.Invoke(ctx, ConferenceService_BuyTicket_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *conferenceServiceClient) GetUserProfile(ctx context.Context, in *GetUserProfileRequest, opts ...grpc.CallOption) (*UserProfile, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UserProfile)
+	err := c.cc.Invoke(ctx, ConferenceService_GetUserProfile_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *conferenceServiceClient) UpdateUserProfile(ctx context.Context, in *UpdateUserProfileRequest, opts ...grpc.CallOption) (*UserProfile, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UserProfile)
+	err := c.cc.Invoke(ctx, ConferenceService_UpdateUserProfile_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ConferenceServiceServer is the server API for ConferenceService service.
+// All implementations must embed UnimplementedConferenceServiceServer
+// for forward compatibility.
+type ConferenceServiceServer interface {
+	ListConferences(context.Context, *ListConferencesRequest) (*ListConferencesResponse, error)
+	GetConference(context.Context, *GetConferenceRequest) (*Conference, error)
+	ScheduleConference(context.Context, *ScheduleConferenceRequest) (*Conference, error)
+	ListAvailableTickets(context.Context, *ListAvailableTicketsRequest) (*ListAvailableTicketsResponse, error)
+	BuyTicket(context.Context, *BuyTicketRequest) (*Ticket, error)
+	GetUserProfile(context.Context, *GetUserProfileRequest) (*UserProfile, error)
+	UpdateUserProfile(context.Context, *UpdateUserProfileRequest) (*UserProfile, error)
+	mustEmbedUnimplementedConferenceServiceServer()
+}
+
+// UnimplementedConferenceServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedConferenceServiceServer struct{}
+
+func (UnimplementedConferenceServiceServer) ListConferences(context.Context, *ListConferencesRequest) (*ListConferencesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListConferences not implemented")
+}
+func (UnimplementedConferenceServiceServer) GetConference(context.Context, *GetConferenceRequest) (*Conference, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetConference not implemented")
+}
+func (UnimplementedConferenceServiceServer) ScheduleConference(context.Context, *ScheduleConferenceRequest) (*Conference, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ScheduleConference not implemented")
+}
+func (UnimplementedConferenceServiceServer) ListAvailableTickets(context.Context, *ListAvailableTicketsRequest) (*ListAvailableTicketsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAvailableTickets not implemented")
+}
+func (UnimplementedConferenceServiceServer) BuyTicket(context.Context, *BuyTicketRequest) (*Ticket, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BuyTicket not implemented")
+}
+func (UnimplementedConferenceServiceServer) GetUserProfile(context.Context, *GetUserProfileRequest) (*UserProfile, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUserProfile not implemented")
+}
+func (UnimplementedConferenceServiceServer) UpdateUserProfile(context.Context, *UpdateUserProfileRequest) (*UserProfile, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateUserProfile not implemented")
+}
+func (UnimplementedConferenceServiceServer) mustEmbedUnimplementedConferenceServiceServer() {}
+func (UnimplementedConferenceServiceServer) testEmbeddedByValue()                           {}
+
+// UnsafeConferenceServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ConferenceServiceServer will
+// result in compilation errors.
+type UnsafeConferenceServiceServer interface {
+	mustEmbedUnimplementedConferenceServiceServer()
+}
+
+func RegisterConferenceServiceServer(s grpc.ServiceRegistrar, srv ConferenceServiceServer) {
+	// If the following call pancis, it indicates UnimplementedConferenceServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ConferenceService_ServiceDesc, srv)
+}
+
+func _ConferenceService_ListConferences_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListConferencesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConferenceServiceServer).ListConferences(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ConferenceService_ListConferences_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConferenceServiceServer).ListConferences(ctx, req.(*ListConferencesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ConferenceService_GetConference_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetConferenceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConferenceServiceServer).GetConference(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ConferenceService_GetConference_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConferenceServiceServer).GetConference(ctx, req.(*GetConferenceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ConferenceService_ScheduleConference_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScheduleConferenceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConferenceServiceServer).ScheduleConference(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ConferenceService_ScheduleConference_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConferenceServiceServer).ScheduleConference(ctx, req.(*ScheduleConferenceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ConferenceService_ListAvailableTickets_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAvailableTicketsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConferenceServiceServer).ListAvailableTickets(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ConferenceService_ListAvailableTickets_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConferenceServiceServer).ListAvailableTickets(ctx, req.(*ListAvailableTicketsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ConferenceService_BuyTicket_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BuyTicketRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConferenceServiceServer).BuyTicket(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ConferenceService_BuyTicket_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConferenceServiceServer).BuyTicket(ctx, req.(*BuyTicketRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ConferenceService_GetUserProfile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUserProfileRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConferenceServiceServer).GetUserProfile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ConferenceService_GetUserProfile_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConferenceServiceServer).GetUserProfile(ctx, req.(*GetUserProfileRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ConferenceService_UpdateUserProfile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateUserProfileRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConferenceServiceServer).UpdateUserProfile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ConferenceService_UpdateUserProfile_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConferenceServiceServer).UpdateUserProfile(ctx, req.(*UpdateUserProfileRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ConferenceService_ServiceDesc is the grpc.ServiceDesc for ConferenceService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ConferenceService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "goconf.v1.ConferenceService",
+	HandlerType: (*ConferenceServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListConferences",
+			Handler:    _ConferenceService_ListConferences_Handler,
+		},
+		{
+			MethodName: "GetConference",
+			Handler:    _ConferenceService_GetConference_Handler,
+		},
+		{
+			MethodName: "ScheduleConference",
+			Handler:    _ConferenceService_ScheduleConference_Handler,
+		},
+		{
+			MethodName: "ListAvailableTickets",
+			Handler:    _ConferenceService_ListAvailableTickets_Handler,
+		},
+		{
+			MethodName: "BuyTicket",
+			Handler:    _ConferenceService_BuyTicket_Handler,
+		},
+		{
+			MethodName: "GetUserProfile",
+			Handler:    _ConferenceService_GetUserProfile_Handler,
+		},
+		{
+			MethodName: "UpdateUserProfile",
+			Handler:    _ConferenceService_UpdateUserProfile_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/conference.proto",
+}